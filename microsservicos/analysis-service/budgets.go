@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	budgetStatusOk       = "ok"
+	budgetStatusWarning  = "warning"  // atingiu algum limite de alerta abaixo de 100%
+	budgetStatusExceeded = "exceeded" // gasto maior ou igual ao limite
+)
+
+// BudgetUsage mostra quanto do orçamento já foi usado no período que contém a
+// data de referência e quanto deve ser gasto até o fim dele, mantido o ritmo
+type BudgetUsage struct {
+	BudgetId          string    `json:"budgetId"`
+	Category          string    `json:"category"`
+	Period            string    `json:"period"`
+	PeriodStart       string    `json:"periodStart"` // YYYY-MM-DD, UTC
+	PeriodEnd         string    `json:"periodEnd"`   // exclusivo
+	Limit             float64   `json:"limit"`
+	Spent             float64   `json:"spent"`
+	Remaining         float64   `json:"remaining"`
+	UsedPercent       float64   `json:"usedPercent"`
+	Projected         float64   `json:"projected"`        // extrapolação linear até o fim do período
+	ProjectedOverrun  float64   `json:"projectedOverrun"` // quanto a projeção passa do limite
+	ThresholdsReached []float64 `json:"thresholdsReached"`
+	Status            string    `json:"status"`
+}
+
+type BudgetReport struct {
+	GroupId string        `json:"groupId"`
+	AsOf    string        `json:"asOf"`
+	Budgets []BudgetUsage `json:"budgets"`
+}
+
+// handleBudgets responde o uso dos orçamentos do grupo. asOf (ms, RFC3339 ou
+// YYYY-MM-DD) escolhe o período de referência e o estado do grupo naquele
+// instante; o padrão é agora.
+func (app *AppConfig) handleBudgets(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(userUIDKey).(string)
+	token := r.Context().Value(rawTokenKey).(string)
+	groupId := chi.URLParam(r, "groupId")
+	period, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asOf := time.Now()
+	if !period.AsOf.IsZero() {
+		asOf = period.AsOf
+	}
+
+	var report BudgetReport
+	err = app.withGroup(r.Context(), token, uid, groupId, period.AsOf, func(g *Group, _ *balanceSheet) {
+		report = budgetReport(g, asOf)
+	})
+	if err != nil {
+		writeFetchError(w, err, "Erro ao buscar grupo")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func budgetReport(g *Group, asOf time.Time) BudgetReport {
+	report := BudgetReport{GroupId: g.Id, AsOf: asOf.UTC().Format(time.RFC3339), Budgets: []BudgetUsage{}}
+	for _, b := range g.Budgets {
+		start, end := budgetPeriodBounds(b.Period, asOf)
+		// O orçamento de uma categoria pai inclui o gasto das subcategorias
+		names := categorySubtree(g, b.Category)
+		spent := 0.0
+		for _, exp := range g.Expenses {
+			if exp.DeletedAt != "" || !names[normalizeCategory(exp.Category)] {
+				continue
+			}
+			if at := time.UnixMilli(int64(exp.Date)); !at.Before(start) && at.Before(end) && !at.After(asOf) {
+				spent += exp.Value
+			}
+		}
+
+		usage := BudgetUsage{
+			BudgetId:          b.Id,
+			Category:          b.Category,
+			Period:            b.Period,
+			PeriodStart:       start.Format(time.DateOnly),
+			PeriodEnd:         end.Format(time.DateOnly),
+			Limit:             b.Limit,
+			Spent:             roundCents(spent),
+			Remaining:         roundCents(max(b.Limit-spent, 0)),
+			ThresholdsReached: []float64{},
+			Status:            budgetStatusOk,
+		}
+		if b.Limit > 0 {
+			usage.UsedPercent = roundCents(spent / b.Limit * 100)
+		}
+		projected := spent
+		if elapsed := asOf.Sub(start); elapsed > 0 && asOf.Before(end) {
+			projected = spent * float64(end.Sub(start)) / float64(elapsed)
+		}
+		usage.Projected = roundCents(projected)
+		usage.ProjectedOverrun = roundCents(max(projected-b.Limit, 0))
+		for _, t := range b.Thresholds {
+			if usage.Spent >= roundCents(t*b.Limit) {
+				usage.ThresholdsReached = append(usage.ThresholdsReached, t)
+				usage.Status = budgetStatusWarning
+			}
+		}
+		if usage.Spent >= b.Limit {
+			usage.Status = budgetStatusExceeded
+		}
+		report.Budgets = append(report.Budgets, usage)
+	}
+	sort.Slice(report.Budgets, func(i, j int) bool {
+		if report.Budgets[i].Category != report.Budgets[j].Category {
+			return report.Budgets[i].Category < report.Budgets[j].Category
+		}
+		return report.Budgets[i].Period < report.Budgets[j].Period
+	})
+	return report
+}
+
+// budgetPeriodBounds devolve o início (inclusivo) e o fim (exclusivo) do mês ou
+// da semana (segunda a domingo) que contém t, em UTC, como no serviço de grupos
+func budgetPeriodBounds(period string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == granularityWeek {
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	}
+	start := day.AddDate(0, 0, 1-day.Day())
+	return start, start.AddDate(0, 1, 0)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+func TestBudgetReportRollsUpSubcategories(t *testing.T) {
+	march := float64(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli())
+	g := &Group{
+		Id: "g1",
+		Categories: map[string]groupsclient.Category{
+			"casa": {Id: "casa", Name: "Casa"},
+			"luz":  {Id: "luz", Name: "Luz", ParentId: "casa"},
+			"agua": {Id: "agua", Name: "Água", ParentId: "luz"},
+		},
+		Expenses: map[string]groupsclient.Expense{
+			"e1": {Category: "casa", Value: 100, Date: march},
+			"e2": {Category: "LUZ", Value: 50, Date: march},
+			"e3": {Category: "Água", Value: 25, Date: march},
+			"e4": {Category: "Luz", Value: 30, Date: march, DeletedAt: "2026-03-11T00:00:00Z"},
+		},
+		Budgets: map[string]groupsclient.Budget{
+			"b1": {Id: "b1", Category: "Casa", Period: "month", Limit: 200, Thresholds: []float64{0.8, 1}},
+			"b2": {Id: "b2", Category: "Luz", Period: "month", Limit: 50},
+			"b3": {Id: "b3", Category: "Mercado", Period: "month", Limit: 50},
+		},
+	}
+	report := budgetReport(g, time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		budgetId string
+		spent    float64
+		status   string
+	}{
+		{"b1", 175, budgetStatusWarning},
+		{"b2", 75, budgetStatusExceeded},
+		{"b3", 0, budgetStatusOk},
+	}
+	for _, tt := range tests {
+		var usage *BudgetUsage
+		for i := range report.Budgets {
+			if report.Budgets[i].BudgetId == tt.budgetId {
+				usage = &report.Budgets[i]
+			}
+		}
+		if usage == nil {
+			t.Errorf("orçamento %s ausente do relatório", tt.budgetId)
+			continue
+		}
+		if usage.Spent != tt.spent || usage.Status != tt.status {
+			t.Errorf("%s: gasto %v (%s), quer %v (%s)", tt.budgetId, usage.Spent, usage.Status, tt.spent, tt.status)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"shared/bus"
+)
+
+// busFromEnv conecta ao barramento em EVENT_BUS_URL (nats://host:porta). Sem
+// ele a análise continua buscando os grupos por HTTP a cada requisição; o
+// barramento em memória não atravessa processos.
+func busFromEnv() bus.Bus {
+	raw := os.Getenv("EVENT_BUS_URL")
+	if raw == "" {
+		return nil
+	}
+	b, err := bus.Connect(raw, "analysis-service")
+	if err != nil {
+		log.Fatalf("EVENT_BUS_URL inválido: %v", err)
+	}
+	return b
+}
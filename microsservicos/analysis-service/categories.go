@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"analysis/groupsclient"
+)
+
+// normalizeCategory compara nomes sem diferenciar maiúsculas e espaços extras,
+// como o serviço de grupos
+func normalizeCategory(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// rootCategory devolve o nome da categoria raiz da hierarquia a que name
+// pertence. Nomes que não são categorias gerenciadas ficam como estão.
+func rootCategory(g *Group, name string) string {
+	key := normalizeCategory(name)
+	var current groupsclient.Category
+	found := false
+	for _, c := range g.Categories {
+		if normalizeCategory(c.Name) == key {
+			current, found = c, true
+			break
+		}
+	}
+	if !found {
+		return name
+	}
+	// O limite de passos protege contra hierarquias inconsistentes
+	for steps := 0; current.ParentId != "" && steps < len(g.Categories); steps++ {
+		parent, exists := g.Categories[current.ParentId]
+		if !exists {
+			break
+		}
+		current = parent
+	}
+	return current.Name
+}
+
+// categorySubtree devolve os nomes normalizados de name e de todas as
+// categorias abaixo dela na hierarquia
+func categorySubtree(g *Group, name string) map[string]bool {
+	key := normalizeCategory(name)
+	names := map[string]bool{key: true}
+	rootId := ""
+	for id, c := range g.Categories {
+		if normalizeCategory(c.Name) == key {
+			rootId = id
+			break
+		}
+	}
+	if rootId == "" {
+		return names
+	}
+	for _, c := range g.Categories {
+		// O limite de passos protege contra hierarquias inconsistentes
+		for parent, steps := c.ParentId, 0; parent != "" && steps < len(g.Categories); parent, steps = g.Categories[parent].ParentId, steps+1 {
+			if parent == rootId {
+				names[normalizeCategory(c.Name)] = true
+				break
+			}
+		}
+	}
+	return names
+}
+
+// rollupCategories soma o gasto de cada categoria na sua categoria raiz
+func rollupCategories(g *Group, summary map[string]float64) map[string]float64 {
+	rollup := make(map[string]float64, len(summary))
+	for cat, val := range summary {
+		rollup[rootCategory(g, cat)] += val
+	}
+	for cat, val := range rollup {
+		rollup[cat] = roundCents(val)
+	}
+	return rollup
+}
+
+// applyCategoryEvent reproduz CategorySet, CategoryRemoved e CategoriesMerged
+// do serviço de grupos, incluindo a troca de nomes nas despesas e orçamentos
+func applyCategoryEvent(g *Group, e groupEvent) error {
+	if g.Categories == nil {
+		g.Categories = map[string]groupsclient.Category{}
+	}
+	switch e.Type {
+	case "CategorySet":
+		var p struct {
+			Category     groupsclient.Category `json:"category"`
+			PreviousName string                `json:"previousName"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		g.Categories[p.Category.Id] = p.Category
+		names := map[string]bool{normalizeCategory(p.Category.Name): true}
+		if p.PreviousName != "" {
+			names[normalizeCategory(p.PreviousName)] = true
+		}
+		renameCategory(g, names, p.Category.Name)
+	case "CategoryRemoved":
+		var p struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		removed, exists := g.Categories[p.Id]
+		if !exists {
+			return errUnknownRecord
+		}
+		delete(g.Categories, p.Id)
+		reparentCategories(g, p.Id, removed.ParentId)
+	case "CategoriesMerged":
+		var p struct {
+			TargetId  string   `json:"targetId"`
+			SourceIds []string `json:"sourceIds"`
+			Names     []string `json:"names"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		target, exists := g.Categories[p.TargetId]
+		if !exists {
+			return errUnknownRecord
+		}
+		names := map[string]bool{}
+		for _, name := range p.Names {
+			names[name] = true
+		}
+		for id, b := range g.Budgets {
+			if !names[normalizeCategory(b.Category)] || b.Category == target.Name {
+				continue
+			}
+			for _, other := range g.Budgets {
+				if other.Category == target.Name && other.Period == b.Period {
+					delete(g.Budgets, id)
+					break
+				}
+			}
+		}
+		renameCategory(g, names, target.Name)
+		for _, id := range p.SourceIds {
+			delete(g.Categories, id)
+			reparentCategories(g, id, target.Id)
+		}
+	}
+	return nil
+}
+
+func renameCategory(g *Group, names map[string]bool, to string) {
+	for id, exp := range g.Expenses {
+		if names[normalizeCategory(exp.Category)] {
+			exp.Category = to
+			g.Expenses[id] = exp
+		}
+	}
+	for id, b := range g.Budgets {
+		if names[normalizeCategory(b.Category)] {
+			b.Category = to
+			g.Budgets[id] = b
+		}
+	}
+}
+
+func reparentCategories(g *Group, removedId, parentId string) {
+	for id, c := range g.Categories {
+		if c.ParentId == removedId {
+			c.ParentId = parentId
+			g.Categories[id] = c
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	kindExpense = "expense"
+	kindPayment = "payment"
+
+	// Status dos pagamentos; vazio (pagamentos antigos) vale confirmed
+	paymentPending   = "pending"
+	paymentConfirmed = "confirmed"
+	paymentDisputed  = "disputed"
+	paymentCancelled = "cancelled"
+)
+
+// contribution é uma despesa ou pagamento que entra no saldo do grupo. É a base
+// comum de calculateGroupAnalysis e da explicação de saldo.
+type contribution struct {
+	Kind        string
+	Id          string
+	At          time.Time
+	Description string
+	Category    string
+	Value       float64
+	PayerId     string
+	Payers      map[string]float64 // só despesas: quanto cada um pagou
+	TargetId    string             // só pagamentos
+	Pending     bool               // só pagamentos: aguardando confirmação de quem recebeu
+	Shares      map[string]float64 // só despesas: parte consumida por membro
+}
+
+// groupContributions lista, em ordem cronológica, as despesas e pagamentos que
+// contam para o saldo: itens na lixeira ou fora do período ficam de fora.
+func groupContributions(group *Group, period Period) []contribution {
+	var list []contribution
+	for _, exp := range group.Expenses {
+		if exp.DeletedAt != "" || !period.includesExpense(exp) {
+			continue
+		}
+		list = append(list, expenseContribution(group, exp))
+	}
+	for _, pay := range group.Payments {
+		if !paymentCounts(pay) || !period.includesPayment(pay) {
+			continue
+		}
+		list = append(list, paymentContribution(pay))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].At.Equal(list[j].At) {
+			return list[i].At.Before(list[j].At)
+		}
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+func expenseContribution(group *Group, exp Expense) contribution {
+	return contribution{
+		Kind:        kindExpense,
+		Id:          exp.Id,
+		At:          time.UnixMilli(int64(exp.Date)).UTC(),
+		Description: exp.Description,
+		Category:    exp.Category,
+		Value:       exp.Value,
+		PayerId:     exp.PayerId,
+		Payers:      expensePayers(exp),
+		Shares:      expenseShares(group, exp),
+	}
+}
+
+// paymentCounts indica se o pagamento entra na planilha: confirmados contam no
+// saldo e pendentes à parte; contestados, cancelados e na lixeira ficam de fora
+func paymentCounts(pay Payment) bool {
+	if pay.DeletedAt != "" {
+		return false
+	}
+	switch pay.Status {
+	case "", paymentConfirmed, paymentPending:
+		return true
+	}
+	return false
+}
+
+// expensePayers devolve quanto cada pessoa pagou; despesas sem Payers
+// (inclusive as antigas) foram pagas inteiras por PayerId
+func expensePayers(exp Expense) map[string]float64 {
+	if len(exp.Payers) > 0 {
+		return exp.Payers
+	}
+	return map[string]float64{exp.PayerId: exp.Value}
+}
+
+func paymentContribution(pay Payment) contribution {
+	at, _ := time.Parse(time.RFC3339Nano, pay.Date)
+	return contribution{
+		Kind:     kindPayment,
+		Id:       pay.Id,
+		At:       at.UTC(),
+		Value:    pay.Value,
+		PayerId:  pay.PayerId,
+		TargetId: pay.TargetId,
+		Pending:  pay.Status == paymentPending,
+	}
+}
+
+// effectOn é quanto a contribuição altera o saldo do usuário
+// (positivo = passa a ter mais a receber).
+func (c contribution) effectOn(uid string) float64 {
+	if c.Pending {
+		return 0
+	}
+	effect := 0.0
+	switch c.Kind {
+	case kindExpense:
+		effect += c.Payers[uid] - c.Shares[uid]
+	case kindPayment:
+		if c.PayerId == uid {
+			effect += c.Value
+		}
+		if c.TargetId == uid {
+			effect -= c.Value
+		}
+	}
+	return effect
+}
+
+// involves indica se a contribuição mexe no saldo do usuário, mesmo que o efeito líquido seja zero
+func (c contribution) involves(uid string) bool {
+	if c.PayerId == uid || c.TargetId == uid {
+		return true
+	}
+	if _, ok := c.Payers[uid]; ok {
+		return true
+	}
+	_, ok := c.Shares[uid]
+	return ok
+}
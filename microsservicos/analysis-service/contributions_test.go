@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"analysis/groupsclient"
+)
+
+func TestExpenseContributionPayers(t *testing.T) {
+	g := &Group{MemberIds: map[string]bool{"ana": true, "bia": true, "caio": true}}
+	tests := []struct {
+		name       string
+		expense    groupsclient.Expense
+		wantEffect map[string]float64
+	}{
+		{"pagador único", groupsclient.Expense{Id: "e1", PayerId: "ana", Value: 90},
+			map[string]float64{"ana": 60, "bia": -30, "caio": -30}},
+		{"cada pagador é creditado pelo que pagou", groupsclient.Expense{
+			Id: "e1", PayerId: "ana", Value: 90, Payers: map[string]float64{"ana": 60, "bia": 30},
+		}, map[string]float64{"ana": 30, "bia": 0, "caio": -30}},
+		{"pagador de fora da divisão", groupsclient.Expense{
+			Id: "e1", PayerId: "ana", Value: 90, Payers: map[string]float64{"ana": 50, "caio": 40},
+			Split: map[string]float64{"ana": 1, "bia": 1},
+		}, map[string]float64{"ana": 5, "bia": -45, "caio": 40}},
+	}
+	for _, tt := range tests {
+		c := expenseContribution(g, tt.expense)
+		total := 0.0
+		for uid, want := range tt.wantEffect {
+			got := roundCents(c.effectOn(uid))
+			if got != want {
+				t.Errorf("%s: efeito em %s = %v, quer %v", tt.name, uid, got, want)
+			}
+			if !c.involves(uid) {
+				t.Errorf("%s: %s deveria estar envolvido", tt.name, uid)
+			}
+			total += got
+		}
+		if roundCents(total) != 0 {
+			t.Errorf("%s: efeitos somam %v, quer 0", tt.name, total)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// BalanceLine é uma despesa ou pagamento que mexe no saldo do usuário.
+// Amount é o efeito arredondado em centavos; RoundingAdjustment é o que precisa
+// ser somado para que Subtotal (arredondado a partir da soma exata) feche.
+type BalanceLine struct {
+	Kind               string  `json:"kind"` // expense ou payment
+	Id                 string  `json:"id"`
+	Date               string  `json:"date"`
+	Description        string  `json:"description,omitempty"`
+	Category           string  `json:"category,omitempty"`
+	Value              float64 `json:"value"`
+	PayerId            string  `json:"payerId"`
+	TargetId           string  `json:"targetId,omitempty"`
+	Paid               float64 `json:"paid,omitempty"` // quanto o usuário pagou da despesa
+	Share              float64 `json:"share"`          // parte do usuário na despesa
+	Amount             float64 `json:"amount"`
+	RoundingAdjustment float64 `json:"roundingAdjustment"`
+	Subtotal           float64 `json:"subtotal"`
+}
+
+type BalanceExplanation struct {
+	GroupId string        `json:"groupId"`
+	UserId  string        `json:"userId"`
+	Lines   []BalanceLine `json:"lines"`
+	Balance float64       `json:"balance"` // myBalance da análise do grupo, arredondado em centavos
+	Period  *PeriodInfo   `json:"period,omitempty"`
+}
+
+// handleExplainBalance lista tudo o que compõe o saldo de um membro no grupo.
+// Parâmetros: userId (padrão: o próprio usuário), from/to/asOf e format=csv.
+func (app *AppConfig) handleExplainBalance(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(userUIDKey).(string)
+	token := r.Context().Value(rawTokenKey).(string)
+	groupId := chi.URLParam(r, "groupId")
+	period, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "Parâmetro format inválido", http.StatusBadRequest)
+		return
+	}
+	userId := r.URL.Query().Get("userId")
+	if userId == "" {
+		userId = uid
+	}
+
+	var explanation BalanceExplanation
+	isMember := false
+	err = app.withGroup(r.Context(), token, uid, groupId, period.AsOf, func(g *Group, _ *balanceSheet) {
+		explanation = explainBalance(g, userId, period)
+		isMember = g.MemberIds[userId]
+	})
+	if err != nil {
+		writeFetchError(w, err, "Erro ao buscar grupo")
+		return
+	}
+	if !isMember && len(explanation.Lines) == 0 {
+		http.Error(w, "Usuário não encontrado no grupo", http.StatusNotFound)
+		return
+	}
+
+	if format == "csv" {
+		writeExplanationCSV(w, explanation)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+}
+
+// explainBalance percorre as mesmas contribuições de calculateGroupAnalysis,
+// acumulando o saldo exato e mostrando o arredondamento de cada passo.
+func explainBalance(group *Group, userId string, period Period) BalanceExplanation {
+	explanation := BalanceExplanation{
+		GroupId: group.Id,
+		UserId:  userId,
+		Lines:   []BalanceLine{},
+		Period:  period.info(),
+	}
+	exact, shown := 0.0, 0.0
+	for _, c := range groupContributions(group, period) {
+		// Pagamentos pendentes ainda não mexem no saldo
+		if c.Pending || !c.involves(userId) {
+			continue
+		}
+		effect := c.effectOn(userId)
+		exact += effect
+		line := BalanceLine{
+			Kind:        c.Kind,
+			Id:          c.Id,
+			Date:        c.At.Format(time.RFC3339),
+			Description: c.Description,
+			Category:    c.Category,
+			Value:       c.Value,
+			PayerId:     c.PayerId,
+			Paid:        roundCents(c.Payers[userId]),
+			TargetId:    c.TargetId,
+			Share:       roundCents(c.Shares[userId]),
+			Amount:      roundCents(effect),
+			Subtotal:    roundCents(exact),
+		}
+		line.RoundingAdjustment = roundCents(line.Subtotal - shown - line.Amount)
+		shown = line.Subtotal
+		explanation.Lines = append(explanation.Lines, line)
+	}
+	explanation.Balance = roundCents(exact)
+	return explanation
+}
+
+// csvText neutraliza textos livres que uma planilha interpretaria como
+// fórmula (=, +, -, @, tab ou CR no início), prefixando-os com um apóstrofo.
+// Os valores numéricos não passam por aqui, para continuarem números.
+func csvText(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func writeExplanationCSV(w http.ResponseWriter, e BalanceExplanation) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="saldo-%s-%s.csv"`, e.GroupId, e.UserId))
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	out := csv.NewWriter(w)
+	out.Write([]string{"data", "tipo", "id", "descricao", "categoria", "valor", "pagador", "destinatario", "parte", "efeito", "ajuste_arredondamento", "subtotal"})
+	for _, l := range e.Lines {
+		out.Write([]string{
+			l.Date, l.Kind, csvText(l.Id), csvText(l.Description), csvText(l.Category), money(l.Value),
+			csvText(l.PayerId), csvText(l.TargetId),
+			money(l.Share), money(l.Amount), money(l.RoundingAdjustment), money(l.Subtotal),
+		})
+	}
+	out.Write([]string{"", "saldo", "", "", "", "", "", "", "", "", "", money(e.Balance)})
+	out.Flush()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+
+	"analysis/groupsclient"
+)
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"pizza", "pizza"},
+		{"", ""},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.in); got != tt.want {
+			t.Errorf("csvText(%q) = %q, quer %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteExplanationCSV(t *testing.T) {
+	e := BalanceExplanation{
+		GroupId: "g1",
+		UserId:  "ana",
+		Lines: []BalanceLine{{
+			Kind: kindExpense, Id: "e1", Description: "=1+1", Category: "@mercado", Value: 10,
+			PayerId: "bia", Share: 5, Amount: -5, Subtotal: -5,
+		}},
+		Balance: -5,
+	}
+	w := httptest.NewRecorder()
+	writeExplanationCSV(w, e)
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := rows[1]
+	// Textos são neutralizados; valores negativos continuam números
+	if line[3] != "'=1+1" || line[4] != "'@mercado" || line[9] != "-5.00" || rows[2][11] != "-5.00" {
+		t.Errorf("linha = %q, saldo = %q", line, rows[2])
+	}
+}
+
+func TestExplainBalance(t *testing.T) {
+	g := &Group{
+		Id:        "g1",
+		MemberIds: map[string]bool{"ana": true, "bia": true, "caio": true},
+		Expenses: map[string]groupsclient.Expense{
+			"e1": {Id: "e1", PayerId: "ana", Value: 10, Date: 1_000},
+			"e2": {Id: "e2", PayerId: "ana", Value: 10, Date: 2_000},
+			"e3": {Id: "e3", PayerId: "bia", Value: 10, Date: 3_000, Split: map[string]float64{"bia": 1}},
+		},
+		Payments: map[string]groupsclient.Payment{
+			"p1": {Id: "p1", PayerId: "bia", TargetId: "ana", Value: 5, Date: "1970-01-01T00:00:04Z"},
+			"p2": {Id: "p2", PayerId: "caio", TargetId: "ana", Value: 5, Date: "1970-01-01T00:00:05Z", Status: paymentPending},
+		},
+	}
+	tests := []struct {
+		userId      string
+		wantIds     []string
+		wantAmounts []float64
+		wantAdjust  []float64
+		wantBalance float64
+	}{
+		// 10 - 3,333... duas vezes: o segundo passo mostra o centavo de arredondamento
+		{"ana", []string{"e1", "e2", "p1"}, []float64{6.67, 6.67, -5}, []float64{0, -0.01, 0}, 8.33},
+		{"bia", []string{"e1", "e2", "e3", "p1"}, []float64{-3.33, -3.33, 0, 5}, []float64{0, -0.01, 0, 0}, -1.67},
+		// O pagamento pendente de caio ainda não entra
+		{"caio", []string{"e1", "e2"}, []float64{-3.33, -3.33}, []float64{0, -0.01}, -6.67},
+	}
+	for _, tt := range tests {
+		e := explainBalance(g, tt.userId, Period{})
+		if e.Balance != tt.wantBalance {
+			t.Errorf("%s: saldo %v, quer %v", tt.userId, e.Balance, tt.wantBalance)
+		}
+		if len(e.Lines) != len(tt.wantIds) {
+			t.Errorf("%s: %d linhas, quer %d", tt.userId, len(e.Lines), len(tt.wantIds))
+			continue
+		}
+		for i, l := range e.Lines {
+			if l.Id != tt.wantIds[i] || l.Amount != tt.wantAmounts[i] || l.RoundingAdjustment != tt.wantAdjust[i] {
+				t.Errorf("%s: linha %d = %s %v (ajuste %v), quer %s %v (ajuste %v)", tt.userId, i,
+					l.Id, l.Amount, l.RoundingAdjustment, tt.wantIds[i], tt.wantAmounts[i], tt.wantAdjust[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package groupsclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen é devolvido sem chamar o serviço enquanto o circuito está aberto
+var ErrCircuitOpen = errors.New("serviço de grupos indisponível (circuito aberto)")
+
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// breaker abre o circuito depois de threshold falhas seguidas. Aberto, recusa
+// chamadas por cooldown; depois deixa passar uma única chamada de teste, que
+// fecha o circuito se der certo ou o reabre se falhar.
+type breaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow informa se a chamada pode seguir
+func (b *breaker) allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = stateHalfOpen
+		return nil
+	case stateHalfOpen:
+		// Já existe uma chamada de teste em andamento
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record registra o resultado de uma chamada liberada por allow
+func (b *breaker) record(success bool) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.state, b.failures = stateClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = stateOpen, b.now()
+	}
+}
+
+// release devolve a vaga de uma chamada liberada por allow sem registrar
+// resultado, como quando quem chamou desistiu. Uma chamada de teste liberada
+// volta o circuito a aberto, e a próxima chamada faz um novo teste.
+func (b *breaker) release() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen {
+		b.state = stateOpen
+	}
+}
+
+func (b *breaker) stateName() string {
+	if b == nil {
+		return "closed"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
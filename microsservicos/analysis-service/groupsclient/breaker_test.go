@@ -0,0 +1,131 @@
+package groupsclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	// Cada passo: "ok"/"falha" liberam uma chamada e registram o resultado,
+	// "desiste" libera e devolve a vaga, "espera" passa o cooldown
+	tests := []struct {
+		name      string
+		steps     []string
+		wantState string
+		wantAllow bool
+	}{
+		{"começa fechado", nil, "closed", true},
+		{"abaixo do limite continua fechado", []string{"falha", "falha"}, "closed", true},
+		{"sucesso zera as falhas", []string{"falha", "falha", "ok", "falha", "falha"}, "closed", true},
+		{"abre no limite", []string{"falha", "falha", "falha"}, "open", false},
+		{"depois do cooldown libera um teste", []string{"falha", "falha", "falha", "espera"}, "open", true},
+		{"teste bem-sucedido fecha", []string{"falha", "falha", "falha", "espera", "ok"}, "closed", true},
+		{"teste com falha reabre", []string{"falha", "falha", "falha", "espera", "falha"}, "open", false},
+		{"cancelamento não conta como falha", []string{"falha", "falha", "desiste", "desiste"}, "closed", true},
+		{"cancelamento não fecha o circuito", []string{"falha", "falha", "falha", "espera", "desiste"}, "open", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			b := newBreaker(3, time.Minute)
+			b.now = func() time.Time { return now }
+			for _, step := range tt.steps {
+				if step == "espera" {
+					now = now.Add(time.Minute)
+					continue
+				}
+				if err := b.allow(); err != nil {
+					t.Fatalf("passo %s: allow() = %v", step, err)
+				}
+				switch step {
+				case "ok":
+					b.record(true)
+				case "falha":
+					b.record(false)
+				case "desiste":
+					b.release()
+				}
+			}
+			if got := b.stateName(); got != tt.wantState {
+				t.Errorf("estado = %s, quer %s", got, tt.wantState)
+			}
+			if err := b.allow(); (err == nil) != tt.wantAllow {
+				t.Errorf("allow() = %v, quer liberado = %v", err, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestHalfOpenProbeIsOnlyOne(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.allow()
+	b.record(false)
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("teste recusado: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("segunda chamada durante o teste = %v, quer ErrCircuitOpen", err)
+	}
+}
+
+func TestClientRecordsEveryCall(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("lento") != "" {
+			<-r.Context().Done()
+			return
+		}
+		if failing.Load() {
+			http.Error(w, "indisponível", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	opts := DefaultOptions
+	opts.MaxRetries = 0
+	opts.BreakerThreshold = 2
+	opts.BreakerCooldown = time.Millisecond
+	c := New(server.URL, opts)
+
+	// Quem desiste não conta como falha, mesmo repetidas vezes
+	for range 3 {
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		_, err := c.get(ctx, "token", "/api/group-ids?lento=1", nil)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("get cancelado = %v", err)
+		}
+	}
+	if got := c.CircuitState(); got != "closed" {
+		t.Fatalf("estado depois de cancelamentos = %s, quer closed", got)
+	}
+
+	// Pedido que nem pode ser montado não prende o teste do circuito meio aberto
+	failing.Store(true)
+	c.GroupIds(t.Context(), "token")
+	c.GroupIds(t.Context(), "token")
+	if got := c.CircuitState(); got != "open" {
+		t.Fatalf("estado depois de 2 falhas = %s, quer open", got)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := c.get(t.Context(), "token", "/%zz", nil); !errors.Is(err, errInvalidRequest) {
+		t.Fatalf("pedido inválido = %v, quer errInvalidRequest", err)
+	}
+	failing.Store(false)
+	if _, err := c.GroupIds(t.Context(), "token"); err != nil {
+		t.Fatalf("GroupIds depois do cooldown = %v", err)
+	}
+	if got := c.CircuitState(); got != "closed" {
+		t.Errorf("estado depois do teste bem-sucedido = %s, quer closed", got)
+	}
+}
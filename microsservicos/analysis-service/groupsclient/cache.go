@@ -0,0 +1,84 @@
+package groupsclient
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cache guarda o último snapshot de cada grupo com o ETag devolvido pelo
+// serviço de grupos. O snapshot nunca é servido sem revalidar: a requisição
+// condicional (If-None-Match) é feita com o token do usuário, então o serviço de
+// grupos continua verificando se ele é membro; um 304 só evita baixar e
+// decodificar o grupo de novo.
+type cache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedGroup
+	maxEntries int
+
+	hits      atomic.Int64 // 304: snapshot reaproveitado
+	misses    atomic.Int64 // 200: grupo baixado (novo ou alterado)
+	evictions atomic.Int64
+}
+
+type cachedGroup struct {
+	etag     string
+	group    Group
+	storedAt time.Time
+}
+
+type CacheMetrics struct {
+	Entries   int     `json:"entries"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hitRate"`
+}
+
+func newCache(maxEntries int) *cache {
+	return &cache{entries: make(map[string]cachedGroup), maxEntries: maxEntries}
+}
+
+func (c *cache) get(groupId string) (cachedGroup, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[groupId]
+	return entry, ok
+}
+
+// put guarda uma cópia do snapshot; se o cache estiver cheio, descarta o mais
+// antigo
+func (c *cache) put(groupId, etag string, group Group) {
+	if etag == "" || c.maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[groupId]; !exists && len(c.entries) >= c.maxEntries {
+		oldestId, oldest := "", time.Time{}
+		for id, entry := range c.entries {
+			if oldestId == "" || entry.storedAt.Before(oldest) {
+				oldestId, oldest = id, entry.storedAt
+			}
+		}
+		delete(c.entries, oldestId)
+		c.evictions.Add(1)
+	}
+	c.entries[groupId] = cachedGroup{etag: etag, group: group.Clone(), storedAt: time.Now()}
+}
+
+func (c *cache) metrics() CacheMetrics {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	m := CacheMetrics{
+		Entries:   entries,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+	if total := m.Hits + m.Misses; total > 0 {
+		m.HitRate = float64(m.Hits) / float64(total)
+	}
+	return m
+}
@@ -0,0 +1,134 @@
+package groupsclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCachePut(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxEntries    int
+		puts          []string
+		noETag        bool // respostas sem ETag não entram no cache
+		wantIds       []string
+		wantEvictions int64
+	}{
+		{"guarda até o limite", 3, []string{"a", "b", "c"}, false, []string{"a", "b", "c"}, 0},
+		{"descarta o mais antigo", 2, []string{"a", "b", "c"}, false, []string{"b", "c"}, 1},
+		{"regravar não descarta", 2, []string{"a", "b", "a"}, false, []string{"a", "b"}, 0},
+		{"sem ETag não guarda", 2, []string{"a"}, true, nil, 0},
+		{"cache desativado", 0, []string{"a"}, false, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCache(tt.maxEntries)
+			for _, id := range tt.puts {
+				etag := `"1"`
+				if tt.noETag {
+					etag = ""
+				}
+				c.put(id, etag, Group{Id: id})
+			}
+			m := c.metrics()
+			if m.Entries != len(tt.wantIds) || m.Evictions != tt.wantEvictions {
+				t.Fatalf("métricas = %+v, quer %d grupos e %d descartes", m, len(tt.wantIds), tt.wantEvictions)
+			}
+			for _, id := range tt.wantIds {
+				if entry, ok := c.get(id); !ok || entry.group.Id != id {
+					t.Errorf("grupo %s fora do cache", id)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupRevalidatesCache(t *testing.T) {
+	var version atomic.Int64
+	version.Store(1)
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "Não autorizado", http.StatusUnauthorized)
+			return
+		}
+		etag := `"` + strconv.FormatInt(version.Load(), 10) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(Group{Id: "g1", Version: version.Load()})
+	}))
+	defer server.Close()
+	c := New(server.URL, DefaultOptions)
+
+	steps := []struct {
+		name        string
+		token       string
+		bump        bool
+		wantVersion int64
+		wantErr     bool
+		wantHits    int64
+		wantMisses  int64
+	}{
+		{"primeira busca baixa o grupo", "token", false, 1, false, 0, 1},
+		{"sem mudanças reaproveita o snapshot", "token", false, 1, false, 1, 1},
+		{"grupo alterado baixa de novo", "token", true, 2, false, 1, 2},
+		// O snapshot nunca é servido sem o serviço de grupos autorizar o token
+		{"token inválido não usa o cache", "outro", false, 0, true, 1, 2},
+	}
+	for _, s := range steps {
+		if s.bump {
+			version.Add(1)
+		}
+		before := requests.Load()
+		group, err := c.Group(t.Context(), s.token, "g1")
+		if requests.Load() == before {
+			t.Errorf("%s: nenhuma requisição ao serviço de grupos", s.name)
+		}
+		if (err != nil) != s.wantErr {
+			t.Fatalf("%s: erro = %v", s.name, err)
+		}
+		if err == nil && group.Version != s.wantVersion {
+			t.Errorf("%s: versão = %d, quer %d", s.name, group.Version, s.wantVersion)
+		}
+		if m := c.CacheMetrics(); m.Hits != s.wantHits || m.Misses != s.wantMisses {
+			t.Errorf("%s: métricas = %+v, quer %d hits e %d misses", s.name, m, s.wantHits, s.wantMisses)
+		}
+	}
+}
+
+// Quem recebe o grupo (o store da análise) aplica eventos sobre os mapas dele;
+// isso não pode vazar para o snapshot em cache
+func TestGroupReturnsCopies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		json.NewEncoder(w).Encode(Group{Id: "g1", Version: 1, Expenses: map[string]Expense{"e1": {Id: "e1", Value: 10}}})
+	}))
+	defer server.Close()
+	c := New(server.URL, DefaultOptions)
+
+	for i := range 3 {
+		group, err := c.Group(t.Context(), "token", "g1")
+		if err != nil {
+			t.Fatalf("busca %d: %v", i, err)
+		}
+		if len(group.Expenses) != 1 {
+			t.Fatalf("busca %d: %d despesas, quer 1", i, len(group.Expenses))
+		}
+		group.Expenses["extra"+strconv.Itoa(i)] = Expense{Id: "extra"}
+	}
+	if entry, _ := c.cache.get("g1"); len(entry.group.Expenses) != 1 {
+		t.Errorf("snapshot em cache com %d despesas, quer 1", len(entry.group.Expenses))
+	}
+}
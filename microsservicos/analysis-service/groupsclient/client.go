@@ -0,0 +1,319 @@
+// Package groupsclient é o cliente HTTP do serviço de grupos usado pela análise:
+// conexões reaproveitadas, cache de grupos com revalidação por ETag, novas
+// tentativas com jitter para leituras e um circuit breaker compartilhado.
+package groupsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Options struct {
+	Timeout          time.Duration // por tentativa
+	Concurrency      int           // buscas simultâneas em Groups
+	CacheSize        int
+	MaxRetries       int // novas tentativas para GETs
+	RetryBaseDelay   time.Duration
+	BreakerThreshold int // falhas seguidas até abrir o circuito (0 desativa)
+	BreakerCooldown  time.Duration
+}
+
+var DefaultOptions = Options{
+	Timeout:          10 * time.Second,
+	Concurrency:      8,
+	CacheSize:        1000,
+	MaxRetries:       2,
+	RetryBaseDelay:   100 * time.Millisecond,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+type Client struct {
+	baseURL string
+	http    *http.Client
+	opts    Options
+	cache   *cache
+	breaker *breaker
+}
+
+// errInvalidRequest indica um pedido que nem chegou a ser enviado; repetir não adianta
+var errInvalidRequest = errors.New("pedido inválido")
+
+// StatusError é uma resposta do serviço de grupos com status inesperado
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("status code %d", e.Code)
+	}
+	return fmt.Sprintf("status code %d: %s", e.Code, e.Body)
+}
+
+func New(baseURL string, opts Options) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = max(opts.Concurrency, 1)
+	transport.IdleConnTimeout = 90 * time.Second
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: opts.Timeout, Transport: transport},
+		opts:    opts,
+		cache:   newCache(opts.CacheSize),
+		breaker: newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}
+}
+
+func (c *Client) CacheMetrics() CacheMetrics {
+	return c.cache.metrics()
+}
+
+// CircuitState devolve "closed", "open" ou "half-open"
+func (c *Client) CircuitState() string {
+	return c.breaker.stateName()
+}
+
+// Group busca o grupo revalidando o snapshot em cache, se houver. Despesas e
+// pagamentos na lixeira vêm junto, com DeletedAt preenchido, para o store
+// poder aplicar eventos sobre eles (restauração, por exemplo).
+func (c *Client) Group(ctx context.Context, token, groupId string) (*Group, error) {
+	cached, isCached := c.cache.get(groupId)
+	header := http.Header{}
+	if isCached {
+		header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := c.get(ctx, token, "/api/groups/"+groupId+"?includeDeleted=true", header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		c.cache.hits.Add(1)
+		// Uma cópia: quem recebe o grupo pode alterá-lo sem afetar o cache
+		group := cached.group.Clone()
+		return &group, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var group Group
+	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+		return nil, err
+	}
+	c.cache.misses.Add(1)
+	c.cache.put(groupId, resp.Header.Get("ETag"), group)
+	return &group, nil
+}
+
+// GroupAt busca o grupo como ele estava no instante at, reconstruído pelo
+// serviço de grupos a partir do ledger. Estados passados não usam o cache.
+func (c *Client) GroupAt(ctx context.Context, token, groupId string, at time.Time) (*Group, error) {
+	path := "/api/groups/" + groupId + "?at=" + strconv.FormatInt(at.UnixMilli(), 10)
+	resp, err := c.get(ctx, token, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var group Group
+	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (c *Client) GroupIds(ctx context.Context, token string) ([]string, error) {
+	resp, err := c.get(ctx, token, "/api/group-ids", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var ids []string
+	if err := json.NewDecoder(resp.Body).Decode(&ids); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar resposta JSON: %v", err)
+	}
+	return ids, nil
+}
+
+// Groups busca todos os grupos do usuário em paralelo, com no máximo
+// Concurrency requisições simultâneas. Grupos que falharem vão para a lista de
+// falhas; grupos que o usuário não acessa mais (403/404, índice desatualizado)
+// são ignorados. Só devolve erro se não conseguir listar os grupos.
+func (c *Client) Groups(ctx context.Context, token string) ([]Group, []GroupFailure, error) {
+	ids, err := c.GroupIds(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, failures := c.GroupsByIds(ctx, token, ids)
+	return groups, failures, nil
+}
+
+// GroupsByIds busca os grupos informados em paralelo; ver Groups
+func (c *Client) GroupsByIds(ctx context.Context, token string, ids []string) ([]Group, []GroupFailure) {
+	return c.fetchAll(ids, func(id string) (*Group, error) { return c.Group(ctx, token, id) })
+}
+
+// GroupsAt busca em paralelo os grupos como estavam no instante at; grupos que
+// ainda não existiam (404) são ignorados, como em Groups
+func (c *Client) GroupsAt(ctx context.Context, token string, ids []string, at time.Time) ([]Group, []GroupFailure) {
+	return c.fetchAll(ids, func(id string) (*Group, error) { return c.GroupAt(ctx, token, id, at) })
+}
+
+func (c *Client) fetchAll(ids []string, fetch func(id string) (*Group, error)) ([]Group, []GroupFailure) {
+	groups := make([]*Group, len(ids))
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, max(c.opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			groups[i], errs[i] = fetch(id)
+		}()
+	}
+	wg.Wait()
+
+	result := make([]Group, 0, len(ids))
+	failures := []GroupFailure{}
+	for i, group := range groups {
+		var status *StatusError
+		switch {
+		case errors.As(errs[i], &status) && (status.Code == http.StatusForbidden || status.Code == http.StatusNotFound):
+			continue
+		case errs[i] != nil:
+			failures = append(failures, GroupFailure{GroupId: ids[i], Error: errs[i].Error()})
+		default:
+			result = append(result, *group)
+		}
+	}
+	return result, failures
+}
+
+// PostPayment registra um pagamento. Não há novas tentativas automáticas: quem
+// chama repete a operação com a mesma idempotencyKey.
+func (c *Client) PostPayment(ctx context.Context, token, groupId, idempotencyKey string, body PaymentRequest) (*Payment, error) {
+	var payment Payment
+	if err := c.post(ctx, token, "/api/groups/"+groupId+"/payments", idempotencyKey, body, http.StatusOK, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// PostSettlement lança as compensações de um acerto entre grupos, já
+// confirmadas. Como em PostPayment, quem chama repete com a mesma idempotencyKey.
+func (c *Client) PostSettlement(ctx context.Context, token, idempotencyKey string, body SettlementRequest) (*SettlementResult, error) {
+	var result SettlementResult
+	if err := c.post(ctx, token, "/api/settlements", idempotencyKey, body, http.StatusCreated, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) post(ctx context.Context, token, path, idempotencyKey string, body any, want int, out any) error {
+	data, _ := json.Marshal(body)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Idempotency-Key", idempotencyKey)
+	resp, err := c.send(ctx, "POST", token, path, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		return statusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// get faz um GET com novas tentativas (backoff exponencial com jitter) para
+// erros de rede, 429 e 5xx. Cada tentativa passa pelo circuit breaker.
+func (c *Client) get(ctx context.Context, token, path string, header http.Header) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.opts.RetryBaseDelay << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(rand.N(delay + 1)):
+			}
+		}
+		resp, err := c.send(ctx, "GET", token, path, header, nil)
+		if errors.Is(err, ErrCircuitOpen) || errors.Is(err, errInvalidRequest) || ctx.Err() != nil {
+			return nil, err
+		}
+		if err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		if err == nil {
+			lastErr = statusError(resp)
+			resp.Body.Close()
+		} else {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// send faz uma chamada passando pelo circuit breaker. Toda chamada liberada
+// registra um resultado: erros de rede e 5xx contam como falha do serviço de
+// grupos; pedidos cancelados por quem chamou e pedidos que nem chegaram a ser
+// montados não contam nem como falha nem como sucesso.
+func (c *Client) send(ctx context.Context, method, token, path string, header http.Header, body []byte) (*http.Response, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		c.breaker.release()
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.http.Do(req)
+	if ctx.Err() != nil {
+		// Quem chamou desistiu; não é culpa do serviço de grupos
+		c.breaker.release()
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, ctx.Err()
+	}
+	c.breaker.record(err == nil && resp.StatusCode < 500)
+	return resp, err
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
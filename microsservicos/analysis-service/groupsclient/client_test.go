@@ -0,0 +1,44 @@
+package groupsclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupsAt(t *testing.T) {
+	at := time.UnixMilli(1_700_000_000_000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("at"); got != "1700000000000" {
+			t.Errorf("at = %q, quer 1700000000000", got)
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/groups/")
+		switch id {
+		case "novo":
+			http.Error(w, "O grupo ainda não existia nesta data", http.StatusNotFound)
+		case "importado":
+			http.Error(w, "Histórico indisponível para esta data", http.StatusUnprocessableEntity)
+		default:
+			json.NewEncoder(w).Encode(Group{Id: id, Version: 3})
+		}
+	}))
+	defer server.Close()
+
+	opts := DefaultOptions
+	opts.RetryBaseDelay = time.Millisecond
+	c := New(server.URL, opts)
+	groups, failures := c.GroupsAt(t.Context(), "token", []string{"g1", "novo", "importado"}, at)
+	if len(groups) != 1 || groups[0].Id != "g1" {
+		t.Errorf("grupos = %+v, quer só g1", groups)
+	}
+	if len(failures) != 1 || failures[0].GroupId != "importado" {
+		t.Errorf("falhas = %+v, quer só importado", failures)
+	}
+	// Estados passados não entram no cache
+	if m := c.CacheMetrics(); m.Entries != 0 {
+		t.Errorf("cache com %d grupos, quer vazio", m.Entries)
+	}
+}
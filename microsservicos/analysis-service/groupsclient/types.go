@@ -0,0 +1,111 @@
+package groupsclient
+
+import "maps"
+
+// Modelos devolvidos pelo serviço de grupos (apenas os campos usados na análise)
+
+type Group struct {
+	Id          string              `json:"id"`
+	Name        string              `json:"name"`
+	MemberIds   map[string]bool     `json:"memberIds"`
+	Expenses    map[string]Expense  `json:"expenses"`
+	Payments    map[string]Payment  `json:"payments"`
+	Description string              `json:"description"`
+	Version     int64               `json:"version"` // sequência do último evento aplicado
+	Budgets     map[string]Budget   `json:"budgets,omitempty"`
+	Categories  map[string]Category `json:"categories,omitempty"`
+}
+
+// Clone copia o grupo com mapas próprios, para que aplicar eventos em uma cópia
+// (como faz o store da análise) não altere as outras. Os mapas dentro de cada
+// despesa (Split, Payers) são compartilhados: eles nunca são alterados no lugar.
+func (g Group) Clone() Group {
+	g.MemberIds = maps.Clone(g.MemberIds)
+	g.Expenses = maps.Clone(g.Expenses)
+	g.Payments = maps.Clone(g.Payments)
+	g.Budgets = maps.Clone(g.Budgets)
+	g.Categories = maps.Clone(g.Categories)
+	return g
+}
+
+type Expense struct {
+	Id          string  `json:"id"`
+	Value       float64 `json:"value"`
+	PayerId     string  `json:"payerId"`
+	Category    string  `json:"category"`
+	Description string  `json:"description"`
+	Date        float64 `json:"date"` // milissegundos desde a época
+	DeletedAt   string  `json:"deletedAt,omitempty"`
+	// Pesos da divisão por membro; vazio divide igualmente entre todos os membros.
+	// Em despesas com recibo, o groups-service já grava aqui a divisão por item.
+	Split map[string]float64 `json:"split,omitempty"`
+	// Quanto cada um pagou, se mais de uma pessoa pagou; vazio: PayerId pagou tudo
+	Payers map[string]float64 `json:"payers,omitempty"`
+}
+
+type Payment struct {
+	Id        string  `json:"id"`
+	GroupId   string  `json:"groupId,omitempty"`
+	Value     float64 `json:"value"`
+	PayerId   string  `json:"payerId"`
+	TargetId  string  `json:"targetId"`
+	Date      string  `json:"date"` // RFC3339
+	DeletedAt string  `json:"deletedAt,omitempty"`
+	// pending, confirmed, disputed ou cancelled; vazio (pagamentos antigos) vale confirmed
+	Status string `json:"status,omitempty"`
+}
+
+// Budget é o orçamento de uma categoria por mês ("month") ou semana ("week")
+type Budget struct {
+	Id         string    `json:"id"`
+	Category   string    `json:"category"`
+	Period     string    `json:"period"`
+	Limit      float64   `json:"limit"`
+	Thresholds []float64 `json:"thresholds"` // frações do limite que geram alerta
+}
+
+// Category é uma categoria gerenciada do grupo; despesas a referenciam pelo nome
+type Category struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+	ParentId string `json:"parentId,omitempty"`
+}
+
+// PaymentRequest espelha o corpo aceito por POST /api/groups/{uid}/payments
+type PaymentRequest struct {
+	TargetId     string  `json:"targetId"`
+	Value        float64 `json:"value"`
+	PayerId      string  `json:"payerId,omitempty"`
+	SettlementId string  `json:"settlementId,omitempty"`
+}
+
+// Compensation quita, sem transferência de dinheiro, a dívida entre duas
+// pessoas em um grupo
+type Compensation struct {
+	GroupId  string  `json:"groupId"`
+	PayerId  string  `json:"payerId"`
+	TargetId string  `json:"targetId"`
+	Value    float64 `json:"value"`
+}
+
+// SettlementRequest lança as compensações de um acerto entre grupos; somadas,
+// as dos dois sentidos devem ter o mesmo total
+type SettlementRequest struct {
+	SettlementId   string         `json:"settlementId"`
+	CounterpartyId string         `json:"counterpartyId"`
+	Compensations  []Compensation `json:"compensations"`
+}
+
+// SettlementResult traz as compensações lançadas; as que já existiam ficam de fora
+type SettlementResult struct {
+	SettlementId string    `json:"settlementId"`
+	Payments     []Payment `json:"payments"`
+}
+
+// GroupFailure descreve um grupo que não pôde ser buscado
+type GroupFailure struct {
+	GroupId string `json:"groupId"`
+	Error   string `json:"error"`
+}
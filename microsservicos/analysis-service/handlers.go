@@ -2,37 +2,22 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"math"
 	"net/http"
 	"sort"
-	"time"
+
+	"analysis/groupsclient"
 
 	"github.com/go-chi/chi/v5"
 )
 
-type Group struct {
-	Id          string             `json:"id"`
-	Name        string             `json:"name"`
-	MemberIds   map[string]bool    `json:"memberIds"`
-	Expenses    map[string]Expense `json:"expenses"`
-	Payments    map[string]Payment `json:"payments"`
-	Description string             `json:"description"`
-}
-
-type Expense struct {
-	Id       string  `json:"id"`
-	Value    float64 `json:"value"`
-	PayerId  string  `json:"payerId"`
-	Category string  `json:"category"`
-}
-
-type Payment struct {
-	Id       string  `json:"id"`
-	Value    float64 `json:"value"`
-	PayerId  string  `json:"payerId"`
-	TargetId string  `json:"targetId"`
-}
+// Modelos do serviço de grupos
+type (
+	Group   = groupsclient.Group
+	Expense = groupsclient.Expense
+	Payment = groupsclient.Payment
+)
 
 // --- Estruturas de Resposta da Análise ---
 
@@ -42,21 +27,44 @@ type Debt struct {
 }
 
 type GroupAnalysis struct {
-	GroupId         string             `json:"groupId"`
-	GroupName       string             `json:"groupName"`
-	MyBalance       float64            `json:"myBalance"`       // Positivo = Receber, Negativo = Dever
-	TotalSpent      float64            `json:"totalSpent"`      // Total gasto pelo grupo
-	MyTotalSpent    float64            `json:"myTotalSpent"`    // Total gasto por mim (share)
-	OwedBy          []Debt             `json:"owedBy"`          // Quem me deve
-	OweTo           []Debt             `json:"oweTo"`           // A quem eu devo
-	CategorySummary map[string]float64 `json:"categorySummary"` // Gastos por categoria
+	GroupId          string             `json:"groupId"`
+	GroupName        string             `json:"groupName"`
+	MyBalance        float64            `json:"myBalance"`        // Positivo = Receber, Negativo = Dever
+	MyPendingBalance float64            `json:"myPendingBalance"` // Quanto MyBalance muda quando os pendentes forem confirmados
+	TotalSpent       float64            `json:"totalSpent"`       // Total gasto pelo grupo
+	MyTotalSpent     float64            `json:"myTotalSpent"`     // Total gasto por mim (share)
+	OwedBy           []Debt             `json:"owedBy"`           // Quem me deve
+	OweTo            []Debt             `json:"oweTo"`            // A quem eu devo
+	CategorySummary  map[string]float64 `json:"categorySummary"`  // Gastos por categoria
+	CategoryRollup   map[string]float64 `json:"categoryRollup"`   // Gastos somados na categoria raiz
+	Period           *PeriodInfo        `json:"period,omitempty"` // Período considerado, se restrito
+	Members          []MemberSummary    `json:"members"`          // Resumo de cada membro
+	// DebtMatrix[devedor][credor] é quanto um membro deve diretamente a outro,
+	// já compensando o que um deve ao outro (sem a simplificação de OwedBy/OweTo)
+	DebtMatrix map[string]map[string]float64 `json:"debtMatrix"`
+}
+
+type MemberSummary struct {
+	UserId           string  `json:"userId"`
+	TotalPaid        float64 `json:"totalPaid"`        // Soma das despesas que pagou
+	TotalConsumed    float64 `json:"totalConsumed"`    // Soma das suas partes nas despesas
+	PaymentsSent     float64 `json:"paymentsSent"`     // Reembolsos feitos
+	PaymentsReceived float64 `json:"paymentsReceived"` // Reembolsos recebidos
+	PendingSent      float64 `json:"pendingSent"`      // Reembolsos feitos aguardando confirmação
+	PendingReceived  float64 `json:"pendingReceived"`  // Reembolsos a confirmar
+	NetBalance       float64 `json:"netBalance"`       // Positivo = Receber, Negativo = Dever
 }
 
 type GeneralAnalysis struct {
-	TotalBalance    float64            `json:"totalBalance"`
-	TotalOwedByMe   float64            `json:"totalOwedByMe"`
-	TotalOwedToMe   float64            `json:"totalOwedToMe"`
-	CategorySummary map[string]float64 `json:"categorySummary"`
+	TotalBalance        float64            `json:"totalBalance"`
+	TotalPendingBalance float64            `json:"totalPendingBalance"` // Quanto TotalBalance muda quando os pendentes forem confirmados
+	TotalOwedByMe       float64            `json:"totalOwedByMe"`
+	TotalOwedToMe       float64            `json:"totalOwedToMe"`
+	CategorySummary     map[string]float64 `json:"categorySummary"`
+	CategoryRollup      map[string]float64 `json:"categoryRollup"`
+	Period              *PeriodInfo        `json:"period,omitempty"`
+	// Grupos que não puderam ser buscados e ficaram fora dos totais
+	FailedGroups []groupsclient.GroupFailure `json:"failedGroups"`
 }
 
 // --- Handlers ---
@@ -65,16 +73,22 @@ func (app *AppConfig) handleGroupAnalysis(w http.ResponseWriter, r *http.Request
 	uid := r.Context().Value(userUIDKey).(string)
 	token := r.Context().Value(rawTokenKey).(string)
 	groupId := chi.URLParam(r, "groupId")
-
-	// 1. Buscar dados no Microsserviço de Grupos
-	group, err := app.fetchGroup(groupId, token)
+	period, err := parsePeriod(r)
 	if err != nil {
-		http.Error(w, "Erro ao buscar grupo: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// 1. Buscar dados (store materializado ou Microsserviço de Grupos)
 	// 2. Processar Análise
-	analysis := calculateGroupAnalysis(group, uid)
+	var analysis GroupAnalysis
+	err = app.withGroup(r.Context(), token, uid, groupId, period.AsOf, func(g *Group, sheet *balanceSheet) {
+		analysis = analyzeGroup(g, sheet, uid, period)
+	})
+	if err != nil {
+		writeFetchError(w, err, "Erro ao buscar grupo")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(analysis)
@@ -83,28 +97,43 @@ func (app *AppConfig) handleGroupAnalysis(w http.ResponseWriter, r *http.Request
 func (app *AppConfig) handleGeneralAnalysis(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(userUIDKey).(string)
 	token := r.Context().Value(rawTokenKey).(string)
+	period, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// 1. Buscar todos os grupos do usuário
-	groups, err := app.fetchMyGroups(token)
+	var stats []GroupAnalysis
+	// Grupos que falharem são informados em failedGroups em vez de derrubar a análise
+	failures, err := app.withMyGroups(r.Context(), token, uid, period.AsOf, func(g *Group, sheet *balanceSheet) {
+		stats = append(stats, analyzeGroup(g, sheet, uid, period))
+	})
 	if err != nil {
-		http.Error(w, "Erro ao buscar grupos: "+err.Error(), http.StatusInternalServerError)
+		writeFetchError(w, err, "Erro ao buscar grupos")
 		return
 	}
 
 	// 2. Processar Análise Geral
 	generalStats := GeneralAnalysis{
 		CategorySummary: make(map[string]float64),
+		CategoryRollup:  make(map[string]float64),
+		Period:          period.info(),
+		FailedGroups:    failures,
 	}
 
-	for _, grp := range groups {
-		stats := calculateGroupAnalysis(&grp, uid)
+	for _, stats := range stats {
 
 		generalStats.TotalBalance += stats.MyBalance
+		generalStats.TotalPendingBalance += stats.MyPendingBalance
 
 		// Agregar categorias
 		for cat, val := range stats.CategorySummary {
 			generalStats.CategorySummary[cat] += val
 		}
+		for cat, val := range stats.CategoryRollup {
+			generalStats.CategoryRollup[cat] += val
+		}
 
 		// Agregar totais de dívidas globais
 		for _, d := range stats.OwedBy {
@@ -121,58 +150,170 @@ func (app *AppConfig) handleGeneralAnalysis(w http.ResponseWriter, r *http.Reque
 
 // --- Lógica de Negócio ---
 
-func calculateGroupAnalysis(group *Group, myUid string) GroupAnalysis {
-	analysis := GroupAnalysis{
-		GroupId:         group.Id,
-		GroupName:       group.Name,
-		CategorySummary: make(map[string]float64),
-		OwedBy:          []Debt{},
-		OweTo:           []Debt{},
+func calculateGroupAnalysis(group *Group, myUid string, period Period) GroupAnalysis {
+	if len(group.MemberIds) == 0 {
+		return newBalanceSheet(nil).analysis(group, myUid, period)
 	}
-
-	memberCount := float64(len(group.MemberIds))
-	if memberCount == 0 {
-		return analysis
+	sheet := newBalanceSheet(group.MemberIds)
+	for _, c := range groupContributions(group, period) {
+		sheet.add(c, 1)
 	}
+	return sheet.analysis(group, myUid, period)
+}
 
+// balanceSheet acumula os totais da análise de um grupo. Como tudo é soma,
+// uma contribuição pode ser desfeita com add(c, -1), o que permite manter a
+// planilha atualizada evento a evento (ver groupStore).
+type balanceSheet struct {
+	totalSpent float64
+	categories map[string]float64
 	// Saldo líquido de cada pessoa (Net Balance)
 	// Positivo = Pagou mais do que devia (tem a receber)
 	// Negativo = Consumiu mais do que pagou (tem a pagar)
-	balances := make(map[string]float64)
+	balances map[string]float64
+	// Efeito no saldo dos pagamentos que aguardam confirmação
+	pending map[string]float64
+	// Totais por membro e dívidas diretas entre pares (owes[devedor][credor])
+	members map[string]*MemberSummary
+	owes    map[string]map[string]float64
+}
 
+func newBalanceSheet(memberIds map[string]bool) *balanceSheet {
+	s := &balanceSheet{
+		categories: make(map[string]float64),
+		balances:   make(map[string]float64),
+		pending:    make(map[string]float64),
+		members:    make(map[string]*MemberSummary),
+		owes:       make(map[string]map[string]float64),
+	}
 	// Inicializar balanço com 0 para todos os membros
-	for mId := range group.MemberIds {
-		balances[mId] = 0
+	for mId := range memberIds {
+		s.balances[mId] = 0
+		s.member(mId)
 	}
+	return s
+}
 
-	// 1. Processar Despesas
-	for _, exp := range group.Expenses {
-		analysis.TotalSpent += exp.Value
-		analysis.CategorySummary[exp.Category] += exp.Value
+func (s *balanceSheet) member(id string) *MemberSummary {
+	if s.members[id] == nil {
+		s.members[id] = &MemberSummary{UserId: id}
+	}
+	return s.members[id]
+}
 
-		splitAmount := exp.Value / memberCount
+func (s *balanceSheet) addOwed(debtor, creditor string, amount float64) {
+	if debtor == creditor {
+		return
+	}
+	if s.owes[debtor] == nil {
+		s.owes[debtor] = make(map[string]float64)
+	}
+	s.owes[debtor][creditor] += amount
+}
 
-		// O pagador "ganha" crédito pelo valor total
-		balances[exp.PayerId] += exp.Value
+// add soma a contribuição à planilha (sign = 1) ou a desfaz (sign = -1)
+func (s *balanceSheet) add(c contribution, sign float64) {
+	value := sign * c.Value
+	switch c.Kind {
+	// 1. Processar Despesas
+	case kindExpense:
+		s.totalSpent += value
+		s.categories[c.Category] += value
+
+		// Cada pagador "ganha" crédito pelo que pagou
+		for payerId, paid := range c.Payers {
+			s.balances[payerId] += sign * paid
+			s.member(payerId).TotalPaid += sign * paid
+		}
 
-		// Todos os membros (incluindo pagador) "perdem" a parte dividida
-		for mId := range group.MemberIds {
-			balances[mId] -= splitAmount
+		// Todos os membros (incluindo pagadores) "perdem" a parte dividida, devida
+		// a cada pagador na proporção do que ele pagou
+		for mId, share := range c.Shares {
+			s.balances[mId] -= sign * share
+			s.member(mId).TotalConsumed += sign * share
+			for payerId, paid := range c.Payers {
+				if c.Value != 0 {
+					s.addOwed(mId, payerId, sign*share*paid/c.Value)
+				}
+			}
 		}
-	}
 
 	// 2. Processar Pagamentos (Reembolsos diretos)
 	// Se A deve a B, e A paga B:
 	// A (PayerId) ganha crédito (+), B (TargetId) perde crédito (-)
-	for _, pay := range group.Payments {
-		balances[pay.PayerId] += pay.Value
-		balances[pay.TargetId] -= pay.Value
+	case kindPayment:
+		if c.Pending {
+			// Fica à parte até quem recebeu confirmar
+			s.pending[c.PayerId] += value
+			s.pending[c.TargetId] -= value
+			s.member(c.PayerId).PendingSent += value
+			s.member(c.TargetId).PendingReceived += value
+			return
+		}
+		s.balances[c.PayerId] += value
+		s.balances[c.TargetId] -= value
+		s.member(c.PayerId).PaymentsSent += value
+		s.member(c.TargetId).PaymentsReceived += value
+		// Quem recebeu o reembolso passa a "dever" esse valor de volta a quem pagou
+		s.addOwed(c.TargetId, c.PayerId, value)
+	}
+}
+
+// analysis monta a análise do grupo do ponto de vista de myUid
+func (s *balanceSheet) analysis(group *Group, myUid string, period Period) GroupAnalysis {
+	analysis := GroupAnalysis{
+		GroupId:         group.Id,
+		GroupName:       group.Name,
+		TotalSpent:      roundCents(s.totalSpent),
+		CategorySummary: make(map[string]float64),
+		OwedBy:          []Debt{},
+		OweTo:           []Debt{},
+		Period:          period.info(),
+		Members:         []MemberSummary{},
+		DebtMatrix:      make(map[string]map[string]float64),
 	}
+	for cat, val := range s.categories {
+		// Categorias cujas despesas foram todas desfeitas
+		if val = roundCents(val); val != 0 {
+			analysis.CategorySummary[cat] = val
+		}
+	}
+	analysis.CategoryRollup = rollupCategories(group, analysis.CategorySummary)
 
-	analysis.MyBalance = balances[myUid]
-	// Meu gasto real = (Total gasto pelo grupo / pessoas) ou apenas a soma das minhas shares
-	// Simplificação: MyTotalSpent é o quanto eu "consumi" do grupo
-	analysis.MyTotalSpent = analysis.TotalSpent / memberCount
+	analysis.MyBalance = s.balances[myUid]
+	analysis.MyPendingBalance = roundCents(s.pending[myUid])
+	// MyTotalSpent é o quanto eu "consumi" do grupo (soma das minhas partes)
+	if me, ok := s.members[myUid]; ok {
+		analysis.MyTotalSpent = me.TotalConsumed
+	}
+
+	for id, m := range s.members {
+		analysis.Members = append(analysis.Members, MemberSummary{
+			UserId:           id,
+			TotalPaid:        roundCents(m.TotalPaid),
+			TotalConsumed:    roundCents(m.TotalConsumed),
+			PaymentsSent:     roundCents(m.PaymentsSent),
+			PaymentsReceived: roundCents(m.PaymentsReceived),
+			PendingSent:      roundCents(m.PendingSent),
+			PendingReceived:  roundCents(m.PendingReceived),
+			NetBalance:       roundCents(s.balances[id]),
+		})
+	}
+	sort.Slice(analysis.Members, func(i, j int) bool { return analysis.Members[i].UserId < analysis.Members[j].UserId })
+
+	// Compensar as dívidas em cada par: só o saldo líquido fica na matriz
+	for debtor, creditors := range s.owes {
+		for creditor, amount := range creditors {
+			net := roundCents(amount - s.owes[creditor][debtor])
+			if net <= 0 {
+				continue
+			}
+			if analysis.DebtMatrix[debtor] == nil {
+				analysis.DebtMatrix[debtor] = make(map[string]float64)
+			}
+			analysis.DebtMatrix[debtor][creditor] = net
+		}
+	}
 
 	// 3. Resolver Dívidas (Algoritmo Simplificado)
 	// Separa quem deve (debitors) de quem tem a receber (creditors)
@@ -183,9 +324,9 @@ func calculateGroupAnalysis(group *Group, myUid string) GroupAnalysis {
 	var debtors []person
 	var creditors []person
 
-	for id, val := range balances {
+	for id, val := range s.balances {
 		// Arredondar para evitar problemas de ponto flutuante
-		val = math.Round(val*100) / 100
+		val = roundCents(val)
 		if val < 0 {
 			debtors = append(debtors, person{id, -val}) // Armazena positivo para facilitar cálculo
 		} else if val > 0 {
@@ -232,51 +373,56 @@ func calculateGroupAnalysis(group *Group, myUid string) GroupAnalysis {
 	return analysis
 }
 
-// --- Integração HTTP com Serviço de Grupos ---
-
-func (app *AppConfig) fetchGroup(groupId, token string) (*Group, error) {
-	url := fmt.Sprintf("%s/api/groups/%s", app.GroupsServiceURL, groupId)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// expenseShares devolve quanto cada membro consumiu da despesa: proporcional
+// aos pesos de Split, se houver, ou em partes iguais entre os membros
+func expenseShares(group *Group, exp Expense) map[string]float64 {
+	if total := splitTotal(exp.Split); total > 0 {
+		shares := make(map[string]float64, len(exp.Split))
+		for mId, weight := range exp.Split {
+			if weight > 0 {
+				shares[mId] = exp.Value * weight / total
+			}
+		}
+		return shares
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	shares := make(map[string]float64, len(group.MemberIds))
+	if len(group.MemberIds) == 0 {
+		return shares
 	}
-
-	var group Group
-	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
-		return nil, err
+	split := exp.Value / float64(len(group.MemberIds))
+	for mId := range group.MemberIds {
+		shares[mId] = split
 	}
-	return &group, nil
+	return shares
 }
 
-func (app *AppConfig) fetchMyGroups(token string) ([]Group, error) {
-	url := fmt.Sprintf("%s/api/groups", app.GroupsServiceURL)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+func splitTotal(split map[string]float64) float64 {
+	total := 0.0
+	for _, weight := range split {
+		if weight > 0 {
+			total += weight
+		}
 	}
-	defer resp.Body.Close()
+	return total
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code %d", resp.StatusCode)
-	}
+// --- Integração HTTP com Serviço de Grupos ---
 
-	var groups []Group
-	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
-		return nil, fmt.Errorf("erro ao decodificar resposta JSON: %v", err)
+// writeFetchError traduz falhas ao buscar dados no serviço de grupos
+func writeFetchError(w http.ResponseWriter, err error, msg string) {
+	var status *groupsclient.StatusError
+	switch {
+	// 422: o serviço de grupos não tem histórico para o asOf pedido
+	case errors.As(err, &status) && (status.Code == http.StatusForbidden || status.Code == http.StatusNotFound ||
+		status.Code == http.StatusUnprocessableEntity):
+		http.Error(w, msg+": "+err.Error(), status.Code)
+	case errors.Is(err, groupsclient.ErrCircuitOpen):
+		http.Error(w, msg+": "+err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, msg+": "+err.Error(), http.StatusInternalServerError)
 	}
-
-	return groups, nil
 }
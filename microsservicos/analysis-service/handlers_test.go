@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"analysis/groupsclient"
+)
+
+func TestCalculateGroupAnalysis(t *testing.T) {
+	members := map[string]bool{"ana": true, "bia": true, "caio": true}
+	tests := []struct {
+		name        string
+		expenses    []groupsclient.Expense
+		payments    []groupsclient.Payment
+		wantNet     map[string]float64
+		wantPending map[string]float64
+		wantMatrix  map[string]map[string]float64
+		wantOweTo   map[string][]Debt // do ponto de vista de cada membro
+	}{
+		{
+			name:       "divisão igual",
+			expenses:   []groupsclient.Expense{{Id: "e1", PayerId: "ana", Value: 90}},
+			wantNet:    map[string]float64{"ana": 60, "bia": -30, "caio": -30},
+			wantMatrix: map[string]map[string]float64{"bia": {"ana": 30}, "caio": {"ana": 30}},
+			wantOweTo:  map[string][]Debt{"bia": {{"ana", 30}}, "ana": {}},
+		},
+		{
+			name: "dívidas em sentidos opostos se compensam no par",
+			expenses: []groupsclient.Expense{
+				{Id: "e1", PayerId: "ana", Value: 60, Split: map[string]float64{"ana": 1, "bia": 1}},
+				{Id: "e2", PayerId: "bia", Value: 20, Split: map[string]float64{"ana": 1, "bia": 1}},
+			},
+			wantNet:    map[string]float64{"ana": 20, "bia": -20, "caio": 0},
+			wantMatrix: map[string]map[string]float64{"bia": {"ana": 20}},
+			wantOweTo:  map[string][]Debt{"bia": {{"ana", 20}}, "caio": {}},
+		},
+		{
+			name: "vários pagadores e pesos",
+			expenses: []groupsclient.Expense{{
+				Id: "e1", PayerId: "ana", Value: 100,
+				Payers: map[string]float64{"ana": 75, "bia": 25},
+				Split:  map[string]float64{"ana": 1, "bia": 1, "caio": 2},
+			}},
+			wantNet: map[string]float64{"ana": 50, "bia": 0, "caio": -50},
+			// Cada parte é devida a quem pagou, na proporção do que pagou; entre ana e
+			// bia só fica o líquido (18,75 - 6,25)
+			wantMatrix: map[string]map[string]float64{"bia": {"ana": 12.5}, "caio": {"ana": 37.5, "bia": 12.5}},
+			wantOweTo:  map[string][]Debt{"caio": {{"ana", 50}}, "bia": {}},
+		},
+		{
+			name:     "pagamento confirmado quita e pendente fica à parte",
+			expenses: []groupsclient.Expense{{Id: "e1", PayerId: "ana", Value: 90}},
+			payments: []groupsclient.Payment{
+				{Id: "p1", PayerId: "bia", TargetId: "ana", Value: 30, Status: paymentConfirmed},
+				{Id: "p2", PayerId: "caio", TargetId: "ana", Value: 30, Status: paymentPending},
+				{Id: "p3", PayerId: "caio", TargetId: "ana", Value: 10, Status: paymentDisputed},
+				{Id: "p4", PayerId: "caio", TargetId: "ana", Value: 10, DeletedAt: "2026-01-01T00:00:00Z"},
+			},
+			wantNet:     map[string]float64{"ana": 30, "bia": 0, "caio": -30},
+			wantPending: map[string]float64{"ana": -30, "caio": 30},
+			wantMatrix:  map[string]map[string]float64{"caio": {"ana": 30}},
+			wantOweTo:   map[string][]Debt{"caio": {{"ana", 30}}, "bia": {}},
+		},
+	}
+	for _, tt := range tests {
+		g := &Group{Id: "g1", MemberIds: members, Expenses: map[string]groupsclient.Expense{}, Payments: map[string]groupsclient.Payment{}}
+		for _, exp := range tt.expenses {
+			g.Expenses[exp.Id] = exp
+		}
+		for _, pay := range tt.payments {
+			g.Payments[pay.Id] = pay
+		}
+		for uid := range members {
+			a := calculateGroupAnalysis(g, uid, Period{})
+			if roundCents(a.MyBalance) != tt.wantNet[uid] {
+				t.Errorf("%s: saldo de %s = %v, quer %v", tt.name, uid, a.MyBalance, tt.wantNet[uid])
+			}
+			if a.MyPendingBalance != tt.wantPending[uid] {
+				t.Errorf("%s: pendente de %s = %v, quer %v", tt.name, uid, a.MyPendingBalance, tt.wantPending[uid])
+			}
+			if !reflect.DeepEqual(a.DebtMatrix, tt.wantMatrix) {
+				t.Errorf("%s: matriz = %v, quer %v", tt.name, a.DebtMatrix, tt.wantMatrix)
+			}
+			if want, ok := tt.wantOweTo[uid]; ok && !reflect.DeepEqual(a.OweTo, want) {
+				t.Errorf("%s: %s deve a %v, quer %v", tt.name, uid, a.OweTo, want)
+			}
+			for _, m := range a.Members {
+				if m.NetBalance != tt.wantNet[m.UserId] {
+					t.Errorf("%s: resumo de %s com saldo %v, quer %v", tt.name, m.UserId, m.NetBalance, tt.wantNet[m.UserId])
+				}
+			}
+		}
+	}
+}
+
+// Desfazer todas as contribuições com add(c, -1) zera a planilha, como o store
+// faz ao aplicar edições e exclusões
+func TestBalanceSheetUndo(t *testing.T) {
+	g := &Group{
+		Id:        "g1",
+		MemberIds: map[string]bool{"ana": true, "bia": true},
+		Expenses: map[string]groupsclient.Expense{
+			"e1": {Id: "e1", PayerId: "ana", Value: 33.33, Category: "mercado"},
+		},
+		Payments: map[string]groupsclient.Payment{
+			"p1": {Id: "p1", PayerId: "bia", TargetId: "ana", Value: 10},
+		},
+	}
+	sheet := newBalanceSheet(g.MemberIds)
+	contributions := groupContributions(g, Period{})
+	for _, c := range contributions {
+		sheet.add(c, 1)
+	}
+	for _, c := range contributions {
+		sheet.add(c, -1)
+	}
+	a := sheet.analysis(g, "ana", Period{})
+	if a.TotalSpent != 0 || len(a.CategorySummary) != 0 || len(a.DebtMatrix) != 0 || roundCents(a.MyBalance) != 0 {
+		t.Errorf("planilha desfeita = %+v, quer zerada", a)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 
+	"analysis/groupsclient"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -16,6 +18,10 @@ import (
 type AppConfig struct {
 	GroupsServiceURL string
 	JWTSecret        []byte
+
+	Groups *groupsclient.Client
+	// Grupos materializados a partir dos eventos; nil sem EVENT_BUS_URL
+	Store *groupStore
 }
 
 func main() {
@@ -29,13 +35,22 @@ func main() {
 	if config.GroupsServiceURL == "" {
 		log.Fatal("GROUPS_SERVICE_URL é obrigatório")
 	}
+	config.Groups = groupsclient.New(config.GroupsServiceURL, groupsOptionsFromEnv())
+	if events := busFromEnv(); events != nil {
+		config.Store = newGroupStore(
+			durationFromEnv("STORE_MAX_AGE", defaultStoreMaxAge),
+			intFromEnv("STORE_MAX_GROUPS", defaultStoreMaxGroups),
+		)
+		events.Subscribe("groups.>", config.Store.handleMessage)
+		log.Println("Análise materializada a partir dos eventos do serviço de grupos")
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key"},
 		AllowCredentials: false,
 	}))
 
@@ -43,7 +58,14 @@ func main() {
 	r.Use(config.authMiddleware)
 
 	r.Get("/api/analysis/group/{groupId}", config.handleGroupAnalysis)
+	r.Get("/api/analysis/group/{groupId}/explain", config.handleExplainBalance)
+	r.Get("/api/analysis/group/{groupId}/budgets", config.handleBudgets)
 	r.Get("/api/analysis/general", config.handleGeneralAnalysis)
+	r.Get("/api/analysis/trends", config.handleTrends)
+	r.Get("/api/analysis/settlement", config.handleGetSettlement)
+	r.Post("/api/analysis/settlement", config.handlePostSettlement)
+	r.Get("/api/analysis/metrics/cache", config.handleCacheMetrics)
+	r.Get("/api/analysis/metrics/store", config.handleStoreMetrics)
 
 	port := os.Getenv("PORT")
 	if port == "" {
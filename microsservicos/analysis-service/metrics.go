@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+// groupsOptionsFromEnv lê a configuração do cliente do serviço de grupos,
+// partindo de groupsclient.DefaultOptions
+func groupsOptionsFromEnv() groupsclient.Options {
+	opts := groupsclient.DefaultOptions
+	opts.CacheSize = intFromEnv("GROUP_CACHE_SIZE", opts.CacheSize)
+	opts.Concurrency = intFromEnv("GROUP_FETCH_CONCURRENCY", opts.Concurrency)
+	opts.MaxRetries = intFromEnv("GROUPS_MAX_RETRIES", opts.MaxRetries)
+	opts.BreakerThreshold = intFromEnv("GROUPS_BREAKER_THRESHOLD", opts.BreakerThreshold)
+	opts.BreakerCooldown = durationFromEnv("GROUPS_BREAKER_COOLDOWN", opts.BreakerCooldown)
+	opts.Timeout = durationFromEnv("GROUPS_TIMEOUT", opts.Timeout)
+	return opts
+}
+
+func intFromEnv(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("%s inválido (%q), usando %d", name, raw, fallback)
+		return fallback
+	}
+	return n
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("%s inválido (%q), usando %s", name, raw, fallback)
+		return fallback
+	}
+	return d
+}
+
+type clientMetrics struct {
+	groupsclient.CacheMetrics
+	Circuit string `json:"circuit"` // closed, open ou half-open
+}
+
+func (app *AppConfig) handleCacheMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clientMetrics{
+		CacheMetrics: app.Groups.CacheMetrics(),
+		Circuit:      app.Groups.CircuitState(),
+	})
+}
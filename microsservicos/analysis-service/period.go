@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Period restringe a análise às despesas e pagamentos feitos entre From e To
+// (inclusive). Limites zerados significam período aberto. AsOf, se informado,
+// escolhe o estado do grupo naquele instante (reconstruído pelo serviço de
+// grupos a partir do ledger): edições, exclusões e lançamentos posteriores não
+// contam, qualquer que seja a data dos itens.
+type Period struct {
+	From time.Time
+	To   time.Time
+	AsOf time.Time
+}
+
+type PeriodInfo struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	AsOf string `json:"asOf,omitempty"`
+}
+
+// parseBound aceita milissegundos desde a época, RFC3339 ou uma data
+// (YYYY-MM-DD). Datas sem horário valem pelo dia inteiro: o início do dia como
+// limite inferior e o fim do dia como limite superior.
+func parseBound(raw string, upper bool) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		if upper {
+			return t.Add(24*time.Hour - time.Millisecond), nil
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("data inválida: %s", raw)
+}
+
+// parsePeriod lê os parâmetros from, to e asOf
+func parsePeriod(r *http.Request) (Period, error) {
+	var p Period
+	query := r.URL.Query()
+	bounds := []struct {
+		name  string
+		upper bool
+		dest  *time.Time
+	}{
+		{"from", false, &p.From},
+		{"to", true, &p.To},
+		{"asOf", true, &p.AsOf},
+	}
+	for _, b := range bounds {
+		raw := query.Get(b.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseBound(raw, b.upper)
+		if err != nil {
+			return p, err
+		}
+		*b.dest = t
+	}
+	if !p.From.IsZero() && !p.To.IsZero() && p.From.After(p.To) {
+		return p, fmt.Errorf("from deve ser anterior a to")
+	}
+	// O estado de um instante futuro é o estado atual
+	if p.AsOf.After(time.Now()) {
+		p.AsOf = time.Time{}
+	}
+	return p, nil
+}
+
+func (p Period) isOpen() bool {
+	return p.From.IsZero() && p.To.IsZero()
+}
+
+func (p Period) contains(t time.Time) bool {
+	if !p.From.IsZero() && t.Before(p.From) {
+		return false
+	}
+	if !p.To.IsZero() && t.After(p.To) {
+		return false
+	}
+	return true
+}
+
+// includesExpense usa a data da despesa (milissegundos)
+func (p Period) includesExpense(exp Expense) bool {
+	return p.isOpen() || p.contains(time.UnixMilli(int64(exp.Date)))
+}
+
+// includesPayment usa a data do pagamento (RFC3339); datas ilegíveis só entram
+// quando o período é aberto.
+func (p Period) includesPayment(pay Payment) bool {
+	if p.isOpen() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, pay.Date)
+	return err == nil && p.contains(t)
+}
+
+func (p Period) info() *PeriodInfo {
+	if p.isOpen() && p.AsOf.IsZero() {
+		return nil
+	}
+	info := &PeriodInfo{}
+	if !p.AsOf.IsZero() {
+		info.AsOf = p.AsOf.UTC().Format(time.RFC3339Nano)
+	}
+	if !p.From.IsZero() {
+		info.From = p.From.UTC().Format(time.RFC3339Nano)
+	}
+	if !p.To.IsZero() {
+		info.To = p.To.UTC().Format(time.RFC3339Nano)
+	}
+	return info
+}
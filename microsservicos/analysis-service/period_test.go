@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	endOf := func(t time.Time) time.Time { return t.Add(24*time.Hour - time.Millisecond) }
+	tests := []struct {
+		query   string
+		want    Period
+		wantErr bool
+	}{
+		{"", Period{}, false},
+		{"from=2026-03-01&to=2026-03-31", Period{From: day(2026, 3, 1), To: endOf(day(2026, 3, 31))}, false},
+		// asOf não filtra por data: escolhe o estado do grupo
+		{"asOf=2026-03-10", Period{AsOf: endOf(day(2026, 3, 10))}, false},
+		{"to=2026-03-31&asOf=2026-03-10", Period{To: endOf(day(2026, 3, 31)), AsOf: endOf(day(2026, 3, 10))}, false},
+		{"asOf=1700000000000", Period{AsOf: time.UnixMilli(1_700_000_000_000)}, false},
+		// O estado de um instante futuro é o atual
+		{"asOf=2999-01-01", Period{}, false},
+		{"from=2026-04-01&to=2026-03-01", Period{}, true},
+		{"asOf=ontem", Period{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePeriod(httptest.NewRequest("GET", "/?"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: erro = %v, quer erro %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) || !got.AsOf.Equal(tt.want.AsOf) {
+			t.Errorf("%q: %+v, quer %+v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+// GroupPosition é a dívida direta entre mim e outra pessoa em um grupo.
+// Amount positivo = a outra pessoa me deve; negativo = eu devo a ela.
+type GroupPosition struct {
+	GroupId   string  `json:"groupId"`
+	GroupName string  `json:"groupName"`
+	Amount    float64 `json:"amount"`
+}
+
+// Allocation é o pagamento que, registrado no grupo, zera a dívida dele.
+// Compensation indica que o valor é quitado contra dívidas no sentido oposto
+// em outros grupos, sem transferência de dinheiro.
+type Allocation struct {
+	GroupId      string  `json:"groupId"`
+	PayerId      string  `json:"payerId"`
+	TargetId     string  `json:"targetId"`
+	Amount       float64 `json:"amount"`
+	Compensation bool    `json:"compensation,omitempty"`
+	PaymentId    string  `json:"paymentId,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// Counterparty reúne as dívidas com uma pessoa em todos os grupos em comum e
+// propõe uma única transferência do valor líquido.
+type Counterparty struct {
+	UserId      string          `json:"userId"`
+	Net         float64         `json:"net"` // positivo = a pessoa me deve
+	PayerId     string          `json:"payerId,omitempty"`
+	TargetId    string          `json:"targetId,omitempty"`
+	Groups      []GroupPosition `json:"groups"`
+	Allocations []Allocation    `json:"allocations"`
+}
+
+type CrossGroupSettlement struct {
+	Counterparties []Counterparty `json:"counterparties"`
+	// Transferências necessárias acertando grupo a grupo e acertando pelo líquido
+	TransfersPerGroup int `json:"transfersPerGroup"`
+	TransfersNetted   int `json:"transfersNetted"`
+	// Grupos que não puderam ser buscados e ficaram fora da compensação
+	FailedGroups []groupsclient.GroupFailure `json:"failedGroups"`
+}
+
+type SettlementRequest struct {
+	CounterpartyId string `json:"counterpartyId"`
+}
+
+type RecordedSettlement struct {
+	Id           string       `json:"id"`
+	Counterparty Counterparty `json:"counterparty"`
+}
+
+// withPendingConfirmed devolve uma cópia do grupo em que os pagamentos pendentes
+// valem como confirmados, ou nil se não houver nenhum. O acerto não deve propor
+// de novo uma transferência que só aguarda a confirmação de quem recebeu.
+func withPendingConfirmed(g *Group) *Group {
+	var payments map[string]Payment
+	for id, pay := range g.Payments {
+		if pay.Status != paymentPending {
+			continue
+		}
+		if payments == nil {
+			payments = make(map[string]Payment, len(g.Payments))
+			for id, pay := range g.Payments {
+				payments[id] = pay
+			}
+		}
+		pay.Status = paymentConfirmed
+		payments[id] = pay
+	}
+	if payments == nil {
+		return nil
+	}
+	copied := *g
+	copied.Payments = payments
+	return &copied
+}
+
+// handleGetSettlement mostra as dívidas com cada pessoa compensadas entre todos
+// os grupos em comum. É uma visão opcional: a análise geral continua por grupo.
+func (app *AppConfig) handleGetSettlement(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(userUIDKey).(string)
+	token := r.Context().Value(rawTokenKey).(string)
+
+	var analyses []GroupAnalysis
+	failures, err := app.withMyGroups(r.Context(), token, uid, time.Time{}, func(g *Group, sheet *balanceSheet) {
+		if pending := withPendingConfirmed(g); pending != nil {
+			sheet = nil
+			g = pending
+		}
+		analyses = append(analyses, analyzeGroup(g, sheet, uid, Period{}))
+	})
+	if err != nil {
+		writeFetchError(w, err, "Erro ao buscar grupos")
+		return
+	}
+	settlement := CrossGroupSettlement{Counterparties: []Counterparty{}, FailedGroups: failures}
+	for _, c := range crossGroupPositions(analyses, uid) {
+		settlement.TransfersPerGroup += len(c.Allocations)
+		if c.PayerId != "" {
+			settlement.TransfersNetted++
+		}
+		// Mostra o que o POST lançaria: compensações e o restante a transferir
+		c.Allocations = planSettlement(c)
+		settlement.Counterparties = append(settlement.Counterparties, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlement)
+}
+
+// handlePostSettlement registra o acerto líquido com uma pessoa. As dívidas nos
+// dois sentidos são quitadas umas contra as outras por compensações, e só o
+// valor líquido vira uma transferência. Tudo é lançado pendente: a contraparte
+// confirma cada compensação e quem recebe confirma a transferência. Pode ser
+// chamado por qualquer um dos dois lados. Repetir a chamada só lança o que
+// ainda não foi lançado.
+func (app *AppConfig) handlePostSettlement(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(userUIDKey).(string)
+	token := r.Context().Value(rawTokenKey).(string)
+
+	var req SettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CounterpartyId == "" {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	groups, failures, err := app.Groups.Groups(r.Context(), token)
+	if err != nil {
+		writeFetchError(w, err, "Erro ao buscar grupos")
+		return
+	}
+	if len(failures) > 0 {
+		// Sem todos os grupos o valor líquido estaria errado
+		http.Error(w, "Não foi possível buscar todos os grupos; tente novamente", http.StatusServiceUnavailable)
+		return
+	}
+	// O acerto usa os grupos recém-buscados, não o store
+	analyses := make([]GroupAnalysis, 0, len(groups))
+	for i := range groups {
+		group := &groups[i]
+		if pending := withPendingConfirmed(group); pending != nil {
+			group = pending
+		}
+		analyses = append(analyses, calculateGroupAnalysis(group, uid, Period{}))
+	}
+	var counterparty *Counterparty
+	for _, c := range crossGroupPositions(analyses, uid) {
+		if c.UserId == req.CounterpartyId {
+			counterparty = &c
+			break
+		}
+	}
+	if counterparty == nil || len(counterparty.Allocations) == 0 {
+		http.Error(w, "Nada a acertar com este usuário", http.StatusUnprocessableEntity)
+		return
+	}
+
+	settlementId := r.Header.Get("Idempotency-Key")
+	if settlementId == "" {
+		settlementId = newSettlementId()
+	}
+	counterparty.Allocations = planSettlement(*counterparty)
+	failed := app.postCompensations(r, token, settlementId, counterparty)
+	for i := range counterparty.Allocations {
+		a := &counterparty.Allocations[i]
+		if a.Compensation || failed {
+			// Sem as compensações o líquido não quita os grupos; nada é transferido
+			continue
+		}
+		payment, err := app.Groups.PostPayment(r.Context(), token, a.GroupId, settlementId+"-"+a.GroupId, groupsclient.PaymentRequest{
+			TargetId:     a.TargetId,
+			Value:        a.Amount,
+			PayerId:      a.PayerId,
+			SettlementId: settlementId,
+		})
+		if err != nil {
+			a.Error = err.Error()
+			failed = true
+			continue
+		}
+		a.PaymentId = payment.Id
+	}
+
+	status := http.StatusCreated
+	if failed {
+		// Os grupos já lançados não são desfeitos; repetir a chamada lança o restante
+		status = http.StatusBadGateway
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(RecordedSettlement{Id: settlementId, Counterparty: *counterparty})
+}
+
+// postCompensations lança as compensações do acerto e marca nas alocações o
+// pagamento criado em cada grupo. Devolve true se o lançamento falhou.
+func (app *AppConfig) postCompensations(r *http.Request, token, settlementId string, c *Counterparty) bool {
+	req := groupsclient.SettlementRequest{SettlementId: settlementId, CounterpartyId: c.UserId}
+	for _, a := range c.Allocations {
+		if a.Compensation {
+			req.Compensations = append(req.Compensations, groupsclient.Compensation{
+				GroupId: a.GroupId, PayerId: a.PayerId, TargetId: a.TargetId, Value: a.Amount,
+			})
+		}
+	}
+	if len(req.Compensations) == 0 {
+		return false
+	}
+	result, err := app.Groups.PostSettlement(r.Context(), token, settlementId+"-compensations", req)
+	paymentIds := map[string]string{}
+	if err == nil {
+		for _, p := range result.Payments {
+			paymentIds[p.GroupId] = p.Id
+		}
+	}
+	for i := range c.Allocations {
+		a := &c.Allocations[i]
+		switch {
+		case !a.Compensation:
+		case err != nil:
+			a.Error = err.Error()
+		default:
+			a.PaymentId = paymentIds[a.GroupId]
+		}
+	}
+	return err != nil
+}
+
+// planSettlement divide as alocações do acerto com uma pessoa. As dívidas no
+// sentido menor são compensadas inteiras, contra o mesmo total no sentido
+// maior (começando pelas menores, para sobrarem menos grupos); o que sobra no
+// sentido maior soma o valor líquido e é a transferência de fato.
+func planSettlement(c Counterparty) []Allocation {
+	var theirs, mine []Allocation
+	var theirTotal, myTotal float64
+	for _, a := range c.Allocations {
+		if a.PayerId == c.UserId {
+			theirs = append(theirs, a)
+			theirTotal += a.Amount
+		} else {
+			mine = append(mine, a)
+			myTotal += a.Amount
+		}
+	}
+	larger, smaller := theirs, mine
+	if roundCents(myTotal) > roundCents(theirTotal) {
+		larger, smaller = mine, theirs
+	}
+
+	plan := make([]Allocation, 0, len(c.Allocations)+1)
+	var remaining float64
+	for _, a := range smaller {
+		a.Compensation = true
+		plan = append(plan, a)
+		remaining = roundCents(remaining + a.Amount)
+	}
+	sort.Slice(larger, func(i, j int) bool {
+		if larger[i].Amount != larger[j].Amount {
+			return larger[i].Amount < larger[j].Amount
+		}
+		return larger[i].GroupId < larger[j].GroupId
+	})
+	for _, a := range larger {
+		offset := min(a.Amount, remaining)
+		if offset > 0 {
+			compensation := a
+			compensation.Amount, compensation.Compensation = offset, true
+			plan = append(plan, compensation)
+			remaining = roundCents(remaining - offset)
+		}
+		if rest := roundCents(a.Amount - offset); rest > 0 {
+			a.Amount = rest
+			plan = append(plan, a)
+		}
+	}
+	sort.SliceStable(plan, func(i, j int) bool {
+		if plan[i].GroupId != plan[j].GroupId {
+			return plan[i].GroupId < plan[j].GroupId
+		}
+		return plan[i].Compensation && !plan[j].Compensation
+	})
+	return plan
+}
+
+// crossGroupPositions usa a matriz de dívidas de cada grupo para somar, por
+// pessoa, quanto ela me deve (ou eu devo a ela) em todos os grupos.
+func crossGroupPositions(analyses []GroupAnalysis, myUid string) []Counterparty {
+	byUser := map[string]*Counterparty{}
+	for _, analysis := range analyses {
+		positions := map[string]float64{}
+		for creditor, amount := range analysis.DebtMatrix[myUid] {
+			positions[creditor] -= amount
+		}
+		for debtor, creditors := range analysis.DebtMatrix {
+			if amount, ok := creditors[myUid]; ok {
+				positions[debtor] += amount
+			}
+		}
+		for userId, amount := range positions {
+			if math.Abs(amount) < 0.01 {
+				continue
+			}
+			c := byUser[userId]
+			if c == nil {
+				c = &Counterparty{UserId: userId, Groups: []GroupPosition{}, Allocations: []Allocation{}}
+				byUser[userId] = c
+			}
+			c.Net += amount
+			c.Groups = append(c.Groups, GroupPosition{GroupId: analysis.GroupId, GroupName: analysis.GroupName, Amount: amount})
+			a := Allocation{GroupId: analysis.GroupId, PayerId: userId, TargetId: myUid, Amount: roundCents(amount)}
+			if amount < 0 {
+				a.PayerId, a.TargetId, a.Amount = myUid, userId, roundCents(-amount)
+			}
+			c.Allocations = append(c.Allocations, a)
+		}
+	}
+
+	list := make([]Counterparty, 0, len(byUser))
+	for _, c := range byUser {
+		c.Net = roundCents(c.Net)
+		switch {
+		case c.Net > 0:
+			c.PayerId, c.TargetId = c.UserId, myUid
+		case c.Net < 0:
+			c.PayerId, c.TargetId = myUid, c.UserId
+		}
+		sort.Slice(c.Groups, func(i, j int) bool { return c.Groups[i].GroupId < c.Groups[j].GroupId })
+		sort.Slice(c.Allocations, func(i, j int) bool { return c.Allocations[i].GroupId < c.Allocations[j].GroupId })
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return math.Abs(list[i].Net) > math.Abs(list[j].Net) })
+	return list
+}
+
+func newSettlementId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
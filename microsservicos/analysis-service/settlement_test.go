@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPlanSettlement(t *testing.T) {
+	// "eu" é quem chama; "bia" é a contraparte
+	owes := func(groupId, payer, target string, amount float64) Allocation {
+		return Allocation{GroupId: groupId, PayerId: payer, TargetId: target, Amount: amount}
+	}
+	compensation := func(a Allocation) Allocation {
+		a.Compensation = true
+		return a
+	}
+	tests := []struct {
+		name        string
+		allocations []Allocation
+		want        []Allocation
+	}{
+		{
+			"um sentido só: tudo é transferência",
+			[]Allocation{owes("g1", "bia", "eu", 30), owes("g2", "bia", "eu", 20)},
+			[]Allocation{owes("g1", "bia", "eu", 30), owes("g2", "bia", "eu", 20)},
+		},
+		{
+			"dívidas opostas: compensa e transfere só o líquido",
+			[]Allocation{owes("g1", "bia", "eu", 100), owes("g2", "eu", "bia", 40)},
+			[]Allocation{
+				compensation(owes("g1", "bia", "eu", 40)),
+				owes("g1", "bia", "eu", 60),
+				compensation(owes("g2", "eu", "bia", 40)),
+			},
+		},
+		{
+			"compensa primeiro as menores dívidas do sentido maior",
+			[]Allocation{owes("g1", "eu", "bia", 50), owes("g2", "eu", "bia", 10), owes("g3", "bia", "eu", 25)},
+			[]Allocation{
+				compensation(owes("g1", "eu", "bia", 15)),
+				owes("g1", "eu", "bia", 35),
+				compensation(owes("g2", "eu", "bia", 10)),
+				compensation(owes("g3", "bia", "eu", 25)),
+			},
+		},
+		{
+			"líquido zero: só compensações",
+			[]Allocation{owes("g1", "bia", "eu", 12.5), owes("g2", "eu", "bia", 12.5)},
+			[]Allocation{compensation(owes("g1", "bia", "eu", 12.5)), compensation(owes("g2", "eu", "bia", 12.5))},
+		},
+		{
+			"centavos",
+			[]Allocation{owes("g1", "bia", "eu", 10.1), owes("g2", "eu", "bia", 0.2), owes("g3", "eu", "bia", 0.1)},
+			[]Allocation{
+				compensation(owes("g1", "bia", "eu", 0.3)),
+				owes("g1", "bia", "eu", 9.8),
+				compensation(owes("g2", "eu", "bia", 0.2)),
+				compensation(owes("g3", "eu", "bia", 0.1)),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planSettlement(Counterparty{UserId: "bia", Allocations: tt.allocations})
+			if !reflect.DeepEqual(plan, tt.want) {
+				t.Fatalf("plano = %+v, esperado %+v", plan, tt.want)
+			}
+			// As compensações se anulam e as transferências somam o líquido
+			var compensated, transferred, gross float64
+			for _, a := range plan {
+				sign := 1.0
+				if a.PayerId == "eu" {
+					sign = -1
+				}
+				if a.Compensation {
+					compensated += sign * a.Amount
+				} else {
+					transferred += sign * a.Amount
+				}
+			}
+			for _, a := range tt.allocations {
+				if a.PayerId == "eu" {
+					gross -= a.Amount
+				} else {
+					gross += a.Amount
+				}
+			}
+			if math.Abs(compensated) > 0.005 {
+				t.Errorf("compensações somam %v, esperado 0", compensated)
+			}
+			if math.Abs(transferred-gross) > 0.005 {
+				t.Errorf("transferências somam %v, esperado o líquido %v", transferred, gross)
+			}
+		})
+	}
+}
+
+func TestCrossGroupPositions(t *testing.T) {
+	analyses := []GroupAnalysis{
+		{GroupId: "g1", DebtMatrix: map[string]map[string]float64{"bia": {"eu": 100}, "caio": {"bia": 5}}},
+		{GroupId: "g2", DebtMatrix: map[string]map[string]float64{"eu": {"bia": 40, "caio": 0.004}}},
+	}
+	counterparties := crossGroupPositions(analyses, "eu")
+	if len(counterparties) != 1 {
+		t.Fatalf("contrapartes = %+v, esperado só bia (caio fica abaixo de um centavo)", counterparties)
+	}
+	c := counterparties[0]
+	if c.UserId != "bia" || c.Net != 60 || c.PayerId != "bia" || c.TargetId != "eu" {
+		t.Errorf("contraparte = %+v, esperado bia devendo 60 para eu", c)
+	}
+	want := []Allocation{
+		{GroupId: "g1", PayerId: "bia", TargetId: "eu", Amount: 100},
+		{GroupId: "g2", PayerId: "eu", TargetId: "bia", Amount: 40},
+	}
+	if !reflect.DeepEqual(c.Allocations, want) {
+		t.Errorf("alocações = %+v, esperado %+v", c.Allocations, want)
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+const (
+	defaultStoreMaxAge    = 5 * time.Minute
+	defaultStoreMaxGroups = 1000
+)
+
+// groupEvent espelha o Event do ledger do serviço de grupos
+type groupEvent struct {
+	Seq     int64           `json:"seq"`
+	Type    string          `json:"type"`
+	GroupId string          `json:"groupId"`
+	At      int64           `json:"at"`
+	Data    json.RawMessage `json:"data"`
+}
+
+var errUnknownRecord = errors.New("registro ausente no snapshot")
+
+// paymentEventStatus é o status que cada resposta a um pagamento pendente grava
+var paymentEventStatus = map[string]string{
+	"PaymentConfirmed": paymentConfirmed,
+	"PaymentDisputed":  paymentDisputed,
+	"PaymentCancelled": paymentCancelled,
+}
+
+// materializedGroup é o grupo mantido pela análise: o snapshot na versão do
+// último evento aplicado e a planilha de saldos já calculada.
+type materializedGroup struct {
+	group     Group
+	sheet     *balanceSheet
+	stale     bool      // houve lacuna ou evento desconhecido: buscar de novo
+	checkedAt time.Time // último evento aplicado ou busca por HTTP
+	usedAt    atomic.Int64
+}
+
+// groupStore guarda os grupos consultados e os mantém atualizados com os
+// eventos publicados pelo serviço de grupos. Um evento com sequência maior que
+// a esperada (evento perdido) marca o grupo como desatualizado; como eventos
+// também podem se perder sem que outro chegue, entradas sem novidade há mais de
+// maxAge são revalidadas por HTTP (normalmente um 304 barato). Com mais de
+// maxGroups grupos, o consultado há mais tempo é descartado.
+type groupStore struct {
+	mu        sync.RWMutex
+	groups    map[string]*materializedGroup
+	maxAge    time.Duration
+	maxGroups int
+
+	applied   atomic.Int64
+	gaps      atomic.Int64
+	evictions atomic.Int64
+}
+
+type StoreMetrics struct {
+	Groups    int   `json:"groups"`
+	Applied   int64 `json:"applied"` // eventos aplicados
+	Gaps      int64 `json:"gaps"`    // lacunas/eventos não aplicáveis detectados
+	Evictions int64 `json:"evictions"`
+}
+
+func newGroupStore(maxAge time.Duration, maxGroups int) *groupStore {
+	return &groupStore{groups: map[string]*materializedGroup{}, maxAge: maxAge, maxGroups: max(maxGroups, 1)}
+}
+
+// insert guarda o grupo, descartando o consultado há mais tempo se o store
+// estiver cheio. Deve ser chamado com s.mu travado para escrita.
+func (s *groupStore) insert(groupId string, m *materializedGroup) {
+	if _, exists := s.groups[groupId]; !exists && len(s.groups) >= s.maxGroups {
+		oldestId, oldest := "", int64(0)
+		for id, g := range s.groups {
+			if used := g.usedAt.Load(); oldestId == "" || used < oldest {
+				oldestId, oldest = id, used
+			}
+		}
+		delete(s.groups, oldestId)
+		s.evictions.Add(1)
+	}
+	m.usedAt.Store(time.Now().UnixNano())
+	s.groups[groupId] = m
+}
+
+// handleMessage recebe os eventos do barramento (assunto groups.{groupId})
+func (s *groupStore) handleMessage(subject string, data []byte) {
+	var e groupEvent
+	if err := json.Unmarshal(data, &e); err != nil || e.GroupId == "" {
+		log.Printf("Evento inválido em %s: %v", subject, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, exists := s.groups[e.GroupId]
+	if !exists {
+		// Só grupos novos entram pelo barramento; os demais na primeira consulta
+		if e.Type != "GroupCreated" || e.Seq != 1 {
+			return
+		}
+		m = &materializedGroup{}
+		s.insert(e.GroupId, m)
+	}
+	if m.stale || e.Seq <= m.group.Version {
+		return
+	}
+	if e.Seq > m.group.Version+1 {
+		m.stale = true
+		s.gaps.Add(1)
+		return
+	}
+	if err := m.apply(e); err != nil {
+		log.Printf("Evento %d do grupo %s não aplicado: %v", e.Seq, e.GroupId, err)
+		m.stale = true
+		s.gaps.Add(1)
+		return
+	}
+	m.group.Version = e.Seq
+	m.checkedAt = time.Now()
+	s.applied.Add(1)
+}
+
+// apply reproduz a projeção do serviço de grupos, atualizando a planilha
+// incrementalmente. Mudanças de membros refazem a planilha, pois alteram a
+// divisão de todas as despesas.
+func (m *materializedGroup) apply(e groupEvent) error {
+	g := &m.group
+	switch e.Type {
+	case "GroupCreated", "GroupImported":
+		var p struct {
+			Group Group `json:"group"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		m.group = p.Group
+		m.rebuild()
+	case "MemberJoined":
+		var p struct {
+			UserId string `json:"userId"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		if g.MemberIds == nil {
+			g.MemberIds = map[string]bool{}
+		}
+		g.MemberIds[p.UserId] = true
+		m.rebuild()
+	case "ExpenseAdded", "ExpenseEdited", "RecurringOccurred":
+		var p struct {
+			Expense Expense `json:"expense"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		old, exists := g.Expenses[p.Expense.Id]
+		if e.Type == "ExpenseEdited" && !exists {
+			return errUnknownRecord
+		}
+		if exists && old.DeletedAt == "" {
+			m.sheet.add(expenseContribution(g, old), -1)
+		}
+		if g.Expenses == nil {
+			g.Expenses = map[string]Expense{}
+		}
+		g.Expenses[p.Expense.Id] = p.Expense
+		if p.Expense.DeletedAt == "" {
+			m.sheet.add(expenseContribution(g, p.Expense), 1)
+		}
+	case "ExpenseDeleted", "ExpenseRestored":
+		var p struct {
+			Id        string `json:"id"`
+			DeletedAt string `json:"deletedAt"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		exp, exists := g.Expenses[p.Id]
+		if !exists {
+			return errUnknownRecord
+		}
+		if exp.DeletedAt == "" {
+			m.sheet.add(expenseContribution(g, exp), -1)
+		}
+		exp.DeletedAt = p.DeletedAt
+		g.Expenses[p.Id] = exp
+		if exp.DeletedAt == "" {
+			m.sheet.add(expenseContribution(g, exp), 1)
+		}
+	case "PaymentRecorded", "SettlementRecorded":
+		var p struct {
+			Payment Payment `json:"payment"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		if g.Payments == nil {
+			g.Payments = map[string]Payment{}
+		}
+		g.Payments[p.Payment.Id] = p.Payment
+		if paymentCounts(p.Payment) {
+			m.sheet.add(paymentContribution(p.Payment), 1)
+		}
+	case "PaymentDeleted", "PaymentRestored":
+		var p struct {
+			Id        string `json:"id"`
+			DeletedAt string `json:"deletedAt"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		if _, exists := g.Payments[p.Id]; !exists {
+			return errUnknownRecord
+		}
+		m.updatePayment(p.Id, func(pay *Payment) { pay.DeletedAt = p.DeletedAt })
+	case "PaymentConfirmed", "PaymentDisputed", "PaymentCancelled":
+		var p struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		if _, exists := g.Payments[p.Id]; !exists {
+			return errUnknownRecord
+		}
+		m.updatePayment(p.Id, func(pay *Payment) { pay.Status = paymentEventStatus[e.Type] })
+	case "TrashPurged":
+		// Itens que já estavam na lixeira: não mexem nos saldos
+		var p struct {
+			ExpenseIds []string `json:"expenseIds"`
+			PaymentIds []string `json:"paymentIds"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		for _, id := range p.ExpenseIds {
+			delete(g.Expenses, id)
+		}
+		for _, id := range p.PaymentIds {
+			delete(g.Payments, id)
+		}
+	case "BudgetSet":
+		// Orçamentos não mexem nos saldos
+		var p struct {
+			Budget groupsclient.Budget `json:"budget"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		if g.Budgets == nil {
+			g.Budgets = map[string]groupsclient.Budget{}
+		}
+		g.Budgets[p.Budget.Id] = p.Budget
+	case "BudgetRemoved":
+		var p struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		delete(g.Budgets, p.Id)
+	case "CategorySet", "CategoryRemoved", "CategoriesMerged":
+		// Renomear e mesclar reescrevem o nome da categoria nas despesas
+		if err := applyCategoryEvent(g, e); err != nil {
+			return err
+		}
+		m.rebuild()
+	case "RuleSet", "RuleRemoved", "RecurringSet", "RecurringRemoved", "MemberRoleSet", "ExpenseContested",
+		"AttachmentAdded", "AttachmentRemoved":
+		// Regras de categorização, modelos de recorrência, papéis, contestações
+		// (a despesa continua valendo) e anexos não entram na análise
+	case "ExpensesCategorized":
+		var p struct {
+			Changes []struct {
+				Id       string `json:"id"`
+				Category string `json:"category"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		for _, c := range p.Changes {
+			exp, exists := g.Expenses[c.Id]
+			if !exists {
+				return errUnknownRecord
+			}
+			exp.Category = c.Category
+			g.Expenses[c.Id] = exp
+		}
+		m.rebuild()
+	default:
+		return errors.New("tipo de evento desconhecido: " + e.Type)
+	}
+	return nil
+}
+
+// updatePayment altera um pagamento desfazendo e refazendo sua contribuição,
+// já que exclusão e status decidem se e como ele entra na planilha
+func (m *materializedGroup) updatePayment(id string, change func(*Payment)) {
+	pay := m.group.Payments[id]
+	if paymentCounts(pay) {
+		m.sheet.add(paymentContribution(pay), -1)
+	}
+	change(&pay)
+	m.group.Payments[id] = pay
+	if paymentCounts(pay) {
+		m.sheet.add(paymentContribution(pay), 1)
+	}
+}
+
+func (m *materializedGroup) rebuild() {
+	m.sheet = newBalanceSheet(m.group.MemberIds)
+	for _, c := range groupContributions(&m.group, Period{}) {
+		m.sheet.add(c, 1)
+	}
+}
+
+// seed guarda uma cópia do grupo buscado por HTTP, a menos que o store já
+// tenha uma versão mais nova e confiável. O store aplica eventos sobre os mapas
+// da cópia; o grupo recebido continua com quem chamou, que o lê sem a trava.
+func (s *groupStore) seed(group Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, exists := s.groups[group.Id]; exists && !m.stale && m.group.Version > group.Version {
+		return
+	}
+	m := &materializedGroup{group: group.Clone(), checkedAt: time.Now()}
+	m.rebuild()
+	s.insert(group.Id, m)
+}
+
+// usable indica se o grupo pode ser servido do store para o usuário
+func (s *groupStore) usable(groupId, uid string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, exists := s.groups[groupId]
+	return exists && !m.stale && m.group.MemberIds[uid] && time.Since(m.checkedAt) < s.maxAge
+}
+
+// view executa fn com o grupo e a planilha sob leitura; fn não deve guardá-los
+func (s *groupStore) view(groupId string, fn func(g *Group, sheet *balanceSheet)) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, exists := s.groups[groupId]
+	if !exists {
+		return false
+	}
+	m.usedAt.Store(time.Now().UnixNano())
+	fn(&m.group, m.sheet)
+	return true
+}
+
+func (s *groupStore) metrics() StoreMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StoreMetrics{
+		Groups:    len(s.groups),
+		Applied:   s.applied.Load(),
+		Gaps:      s.gaps.Load(),
+		Evictions: s.evictions.Load(),
+	}
+}
+
+// --- Acesso aos grupos pelos handlers ---
+
+// withGroup executa fn com o grupo, servido do store quando possível. Sem
+// barramento configurado (ou sem snapshot confiável), busca por HTTP; nesse
+// caso sheet é nil e a análise é calculada do zero. Com asOf, o grupo é o
+// reconstruído pelo serviço de grupos naquele instante.
+func (app *AppConfig) withGroup(ctx context.Context, token, uid, groupId string, asOf time.Time, fn func(g *Group, sheet *balanceSheet)) error {
+	if !asOf.IsZero() {
+		group, err := app.Groups.GroupAt(ctx, token, groupId, asOf)
+		if err != nil {
+			return err
+		}
+		fn(group, nil)
+		return nil
+	}
+	if app.Store != nil && app.Store.usable(groupId, uid) && app.Store.view(groupId, fn) {
+		return nil
+	}
+	group, err := app.Groups.Group(ctx, token, groupId)
+	if err != nil {
+		return err
+	}
+	if app.Store != nil {
+		app.Store.seed(*group)
+		if app.Store.view(groupId, fn) {
+			return nil
+		}
+	}
+	fn(group, nil)
+	return nil
+}
+
+// withMyGroups executa fn para cada grupo do usuário. Grupos que não puderem
+// ser buscados são devolvidos como falhas, como em groupsclient.Client.Groups.
+// Com asOf, só entram os grupos de que o usuário já era membro naquele instante.
+func (app *AppConfig) withMyGroups(ctx context.Context, token, uid string, asOf time.Time, fn func(g *Group, sheet *balanceSheet)) ([]groupsclient.GroupFailure, error) {
+	ids, err := app.Groups.GroupIds(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !asOf.IsZero() {
+		groups, failures := app.Groups.GroupsAt(ctx, token, ids, asOf)
+		for i := range groups {
+			if groups[i].MemberIds[uid] {
+				fn(&groups[i], nil)
+			}
+		}
+		return failures, nil
+	}
+	var missing []string
+	for _, id := range ids {
+		if app.Store == nil || !app.Store.usable(id, uid) || !app.Store.view(id, fn) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return []groupsclient.GroupFailure{}, nil
+	}
+	groups, failures := app.Groups.GroupsByIds(ctx, token, missing)
+	for i := range groups {
+		if app.Store != nil {
+			app.Store.seed(groups[i])
+		}
+		fn(&groups[i], nil)
+	}
+	return failures, nil
+}
+
+// analyzeGroup usa a planilha materializada quando não há filtro de período
+func analyzeGroup(g *Group, sheet *balanceSheet, uid string, period Period) GroupAnalysis {
+	if sheet != nil && period.isOpen() {
+		return sheet.analysis(g, uid, period)
+	}
+	return calculateGroupAnalysis(g, uid, period)
+}
+
+func (app *AppConfig) handleStoreMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := StoreMetrics{}
+	if app.Store != nil {
+		metrics = app.Store.metrics()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+func storeEvent(t *testing.T, groupId string, seq int64, eventType string, payload any) []byte {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := json.Marshal(groupEvent{Seq: seq, Type: eventType, GroupId: groupId, At: seq, Data: data})
+	return msg
+}
+
+func TestGroupStoreHandleMessage(t *testing.T) {
+	// Snapshot buscado por HTTP já com a lixeira (includeDeleted=true)
+	seeded := func() Group {
+		return Group{
+			Id: "g1", Version: 3, MemberIds: map[string]bool{"ana": true, "bia": true},
+			Expenses: map[string]groupsclient.Expense{
+				"e1": {Id: "e1", PayerId: "ana", Value: 40},
+				"e2": {Id: "e2", PayerId: "ana", Value: 20, DeletedAt: "2026-01-01T00:00:00Z"},
+			},
+			Payments: map[string]groupsclient.Payment{},
+		}
+	}
+	type message struct {
+		seq       int64
+		eventType string
+		payload   any
+	}
+	tests := []struct {
+		name      string
+		messages  []message
+		wantStale bool
+		wantBia   float64 // saldo de bia depois dos eventos
+	}{
+		{"sem eventos", nil, false, -20},
+		{"restaurar item da lixeira", []message{
+			{4, "ExpenseRestored", map[string]string{"id": "e2"}},
+		}, false, -30},
+		{"pagamento confirmado", []message{
+			{4, "PaymentRecorded", map[string]any{"payment": Payment{Id: "p1", PayerId: "bia", TargetId: "ana", Value: 20, Status: paymentPending}}},
+			{5, "PaymentConfirmed", map[string]string{"id": "p1"}},
+		}, false, 0},
+		{"compensação de acerto já conta", []message{
+			{4, "SettlementRecorded", map[string]any{"payment": Payment{Id: "p1", PayerId: "bia", TargetId: "ana", Value: 5, Status: paymentConfirmed}}},
+		}, false, -15},
+		{"evento repetido é ignorado", []message{
+			{3, "ExpenseRestored", map[string]string{"id": "e2"}},
+		}, false, -20},
+		{"lacuna marca o grupo para nova busca", []message{
+			{5, "ExpenseRestored", map[string]string{"id": "e2"}},
+		}, true, -20},
+		{"evento sobre item desconhecido", []message{
+			{4, "ExpenseRestored", map[string]string{"id": "e9"}},
+		}, true, -20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGroupStore(time.Minute, 10)
+			s.seed(seeded())
+			for _, m := range tt.messages {
+				s.handleMessage("groups.g1", storeEvent(t, "g1", m.seq, m.eventType, m.payload))
+			}
+			if got := s.usable("g1", "bia"); got == tt.wantStale {
+				t.Errorf("usable = %v, quer %v", got, !tt.wantStale)
+			}
+			s.view("g1", func(g *Group, sheet *balanceSheet) {
+				a := sheet.analysis(g, "bia", Period{})
+				if roundCents(a.MyBalance) != tt.wantBia {
+					t.Errorf("saldo de bia = %v, quer %v", a.MyBalance, tt.wantBia)
+				}
+				// A planilha incremental bate com o cálculo do zero
+				if full := calculateGroupAnalysis(g, "bia", Period{}); roundCents(full.MyBalance) != roundCents(a.MyBalance) {
+					t.Errorf("planilha = %v, cálculo do zero = %v", a.MyBalance, full.MyBalance)
+				}
+			})
+		})
+	}
+}
+
+func TestGroupStoreEviction(t *testing.T) {
+	s := newGroupStore(time.Minute, 2)
+	group := func(id string) Group {
+		return Group{Id: id, Version: 1, MemberIds: map[string]bool{"ana": true}}
+	}
+	s.seed(group("g1"))
+	s.seed(group("g2"))
+	// g1 é consultado depois de g2, então g2 é o mais antigo
+	time.Sleep(time.Millisecond)
+	s.view("g1", func(*Group, *balanceSheet) {})
+	s.seed(group("g3"))
+
+	if m := s.metrics(); m.Groups != 2 || m.Evictions != 1 {
+		t.Fatalf("métricas = %+v, quer 2 grupos e 1 descarte", m)
+	}
+	for id, want := range map[string]bool{"g1": true, "g2": false, "g3": true} {
+		if got := s.view(id, func(*Group, *balanceSheet) {}); got != want {
+			t.Errorf("grupo %s no store = %v, quer %v", id, got, want)
+		}
+	}
+
+	// Grupos novos que chegam pelo barramento também respeitam o limite, e
+	// eventos de grupos descartados não os trazem de volta
+	s.handleMessage("groups.g4", storeEvent(t, "g4", 1, "GroupCreated", map[string]any{"group": group("g4")}))
+	s.handleMessage("groups.g2", storeEvent(t, "g2", 2, "MemberJoined", map[string]string{"userId": "bia"}))
+	if m := s.metrics(); m.Groups != 2 || m.Evictions != 2 {
+		t.Errorf("métricas = %+v, quer 2 grupos e 2 descartes", m)
+	}
+	if s.view("g2", func(*Group, *balanceSheet) {}) {
+		t.Errorf("evento de grupo descartado o trouxe de volta")
+	}
+}
+
+// O grupo entregue a seed continua com quem chamou, que o lê sem a trava do
+// store enquanto eventos chegam pelo barramento (rode com -race)
+func TestGroupStoreSeedKeepsCallerCopy(t *testing.T) {
+	s := newGroupStore(time.Minute, 10)
+	group := Group{
+		Id: "g1", Version: 1, MemberIds: map[string]bool{"ana": true, "bia": true},
+		Expenses: map[string]groupsclient.Expense{"e1": {Id: "e1", PayerId: "ana", Value: 10}},
+		Payments: map[string]groupsclient.Payment{},
+	}
+	s.seed(group)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for seq := int64(2); seq <= 50; seq++ {
+			id := "e" + strconv.FormatInt(seq, 10)
+			s.handleMessage("groups.g1", storeEvent(t, "g1", seq, "ExpenseAdded",
+				map[string]any{"expense": groupsclient.Expense{Id: id, PayerId: "bia", Value: 1}}))
+		}
+	}()
+	for range 50 {
+		// A leitura que withMyGroups faz fora da trava
+		groupContributions(&group, Period{})
+		s.view("g1", func(g *Group, sheet *balanceSheet) { sheet.analysis(g, "ana", Period{}) })
+	}
+	wg.Wait()
+
+	if len(group.Expenses) != 1 {
+		t.Errorf("grupo de quem chamou com %d despesas, quer 1", len(group.Expenses))
+	}
+	s.view("g1", func(g *Group, _ *balanceSheet) {
+		if len(g.Expenses) != 50 {
+			t.Errorf("store com %d despesas, quer 50", len(g.Expenses))
+		}
+	})
+}
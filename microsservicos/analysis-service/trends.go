@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"analysis/groupsclient"
+)
+
+const (
+	granularityDay   = "day"
+	granularityWeek  = "week"
+	granularityMonth = "month"
+
+	defaultRollingWindow = 3
+	defaultTopMovers     = 5
+	// Evita respostas gigantes (ex.: granularidade diária ao longo de anos)
+	maxTrendBuckets = 1000
+)
+
+// Amount separa o gasto do grupo (valor total das despesas) do gasto pessoal
+// (a parte do usuário em cada despesa).
+type Amount struct {
+	Group    float64 `json:"group"`
+	Personal float64 `json:"personal"`
+}
+
+type TrendBucket struct {
+	Start          string            `json:"start"` // início do intervalo (YYYY-MM-DD, UTC)
+	Total          Amount            `json:"total"`
+	Categories     map[string]Amount `json:"categories"`
+	RollingAverage Amount            `json:"rollingAverage"` // média dos últimos "window" intervalos
+}
+
+type MonthDelta struct {
+	Month    string   `json:"month"` // YYYY-MM
+	Total    Amount   `json:"total"`
+	Delta    Amount   `json:"delta"`                  // diferença para o mês anterior
+	DeltaPct *float64 `json:"deltaPercent,omitempty"` // variação do gasto do grupo; ausente se o mês anterior for zero
+}
+
+type Mover struct {
+	Category string `json:"category"`
+	Previous Amount `json:"previous"`
+	Current  Amount `json:"current"`
+	Delta    Amount `json:"delta"`
+}
+
+type TrendsAnalysis struct {
+	GroupId        string        `json:"groupId,omitempty"`
+	Granularity    string        `json:"granularity"`
+	Window         int           `json:"window"`
+	Buckets        []TrendBucket `json:"buckets"`
+	MonthOverMonth []MonthDelta  `json:"monthOverMonth"`
+	// Categorias que mais variaram entre os dois últimos meses do período
+	TopMovers    []Mover                     `json:"topMovers"`
+	Period       *PeriodInfo                 `json:"period,omitempty"`
+	FailedGroups []groupsclient.GroupFailure `json:"failedGroups"`
+}
+
+// spendingEntry é a parte de uma despesa que interessa às séries temporais
+type spendingEntry struct {
+	at       time.Time
+	category string
+	amount   Amount
+}
+
+// handleTrends agrupa os gastos por dia, semana ou mês e categoria.
+// Parâmetros: groupId (opcional; sem ele considera todos os grupos do usuário),
+// granularity (day, week ou month; padrão month), window (média móvel, padrão 3),
+// top (quantidade de categorias em topMovers, padrão 5) e from/to/asOf.
+func (app *AppConfig) handleTrends(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(userUIDKey).(string)
+	token := r.Context().Value(rawTokenKey).(string)
+	query := r.URL.Query()
+
+	period, err := parsePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = granularityMonth
+	case granularityDay, granularityWeek, granularityMonth:
+	default:
+		http.Error(w, "Parâmetro granularity inválido", http.StatusBadRequest)
+		return
+	}
+	window, ok := positiveIntParam(query.Get("window"), defaultRollingWindow)
+	if !ok {
+		http.Error(w, "Parâmetro window inválido", http.StatusBadRequest)
+		return
+	}
+	top, ok := positiveIntParam(query.Get("top"), defaultTopMovers)
+	if !ok {
+		http.Error(w, "Parâmetro top inválido", http.StatusBadRequest)
+		return
+	}
+
+	groupId := query.Get("groupId")
+	var entries []spendingEntry
+	collect := func(g *Group, _ *balanceSheet) {
+		entries = append(entries, spendingEntries(g, uid, period)...)
+	}
+	failures := []groupsclient.GroupFailure{}
+	if groupId != "" {
+		if err := app.withGroup(r.Context(), token, uid, groupId, period.AsOf, collect); err != nil {
+			writeFetchError(w, err, "Erro ao buscar grupo")
+			return
+		}
+	} else {
+		failures, err = app.withMyGroups(r.Context(), token, uid, period.AsOf, collect)
+		if err != nil {
+			writeFetchError(w, err, "Erro ao buscar grupos")
+			return
+		}
+	}
+
+	buckets, ok := bucketSpending(entries, granularity, period)
+	if !ok {
+		http.Error(w, "Período longo demais para a granularidade escolhida", http.StatusBadRequest)
+		return
+	}
+	applyRollingAverage(buckets, window)
+
+	months, _ := bucketSpending(entries, granularityMonth, period)
+	trends := TrendsAnalysis{
+		GroupId:        groupId,
+		Granularity:    granularity,
+		Window:         window,
+		Buckets:        buckets,
+		MonthOverMonth: monthOverMonth(months),
+		TopMovers:      topMovers(months, top),
+		Period:         period.info(),
+		FailedGroups:   failures,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trends)
+}
+
+func positiveIntParam(raw string, fallback int) (int, bool) {
+	if raw == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(raw)
+	return n, err == nil && n > 0
+}
+
+// spendingEntries lista as despesas válidas do grupo com a parte do usuário em cada uma
+func spendingEntries(group *Group, myUid string, period Period) []spendingEntry {
+	var entries []spendingEntry
+	for _, c := range groupContributions(group, period) {
+		if c.Kind != kindExpense {
+			continue
+		}
+		entries = append(entries, spendingEntry{
+			at:       c.At,
+			category: c.Category,
+			amount:   Amount{Group: c.Value, Personal: c.Shares[myUid]},
+		})
+	}
+	return entries
+}
+
+// bucketStart devolve o início do intervalo que contém t. Semanas começam na segunda-feira.
+func bucketStart(t time.Time, granularity string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch granularity {
+	case granularityWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case granularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case granularityWeek:
+		return start.AddDate(0, 0, 7)
+	case granularityMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// bucketSpending soma os gastos por intervalo, preenchendo os intervalos vazios
+// entre o início e o fim do período (ou entre a primeira e a última despesa).
+func bucketSpending(entries []spendingEntry, granularity string, period Period) ([]TrendBucket, bool) {
+	buckets := []TrendBucket{}
+	first, last := period.From, period.To
+	for _, e := range entries {
+		if period.From.IsZero() && (first.IsZero() || e.at.Before(first)) {
+			first = e.at
+		}
+		if period.To.IsZero() && (last.IsZero() || e.at.After(last)) {
+			last = e.at
+		}
+	}
+	if first.IsZero() || last.IsZero() {
+		return buckets, true
+	}
+
+	index := map[time.Time]int{}
+	for start := bucketStart(first.UTC(), granularity); !start.After(last); start = nextBucket(start, granularity) {
+		if len(buckets) == maxTrendBuckets {
+			return nil, false
+		}
+		index[start] = len(buckets)
+		buckets = append(buckets, TrendBucket{
+			Start:      start.Format(time.DateOnly),
+			Categories: map[string]Amount{},
+		})
+	}
+	for _, e := range entries {
+		i, ok := index[bucketStart(e.at, granularity)]
+		if !ok {
+			continue
+		}
+		b := &buckets[i]
+		b.Total = b.Total.add(e.amount)
+		b.Categories[e.category] = b.Categories[e.category].add(e.amount)
+	}
+	for i := range buckets {
+		buckets[i].Total = buckets[i].Total.rounded()
+		for cat, amount := range buckets[i].Categories {
+			buckets[i].Categories[cat] = amount.rounded()
+		}
+	}
+	return buckets, true
+}
+
+// applyRollingAverage calcula a média móvel dos totais com os últimos window intervalos
+func applyRollingAverage(buckets []TrendBucket, window int) {
+	var sum Amount
+	for i := range buckets {
+		sum = sum.add(buckets[i].Total)
+		if i >= window {
+			sum = sum.sub(buckets[i-window].Total)
+		}
+		n := float64(min(i+1, window))
+		buckets[i].RollingAverage = Amount{Group: sum.Group / n, Personal: sum.Personal / n}.rounded()
+	}
+}
+
+func monthOverMonth(months []TrendBucket) []MonthDelta {
+	deltas := make([]MonthDelta, 0, len(months))
+	for i, m := range months {
+		d := MonthDelta{Month: m.Start[:7], Total: m.Total}
+		if i > 0 {
+			previous := months[i-1].Total
+			d.Delta = m.Total.sub(previous).rounded()
+			if previous.Group != 0 {
+				pct := math.Round(d.Delta.Group/previous.Group*10000) / 100
+				d.DeltaPct = &pct
+			}
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// topMovers compara os dois últimos meses e ordena as categorias pela maior variação absoluta
+func topMovers(months []TrendBucket, limit int) []Mover {
+	movers := []Mover{}
+	if len(months) < 2 {
+		return movers
+	}
+	previous, current := months[len(months)-2], months[len(months)-1]
+	categories := map[string]bool{}
+	for cat := range previous.Categories {
+		categories[cat] = true
+	}
+	for cat := range current.Categories {
+		categories[cat] = true
+	}
+	for cat := range categories {
+		m := Mover{Category: cat, Previous: previous.Categories[cat], Current: current.Categories[cat]}
+		m.Delta = m.Current.sub(m.Previous).rounded()
+		if m.Delta.Group == 0 && m.Delta.Personal == 0 {
+			continue
+		}
+		movers = append(movers, m)
+	}
+	sort.Slice(movers, func(i, j int) bool {
+		di, dj := math.Abs(movers[i].Delta.Group), math.Abs(movers[j].Delta.Group)
+		if di != dj {
+			return di > dj
+		}
+		return movers[i].Category < movers[j].Category
+	})
+	if len(movers) > limit {
+		movers = movers[:limit]
+	}
+	return movers
+}
+
+func (a Amount) add(b Amount) Amount {
+	return Amount{Group: a.Group + b.Group, Personal: a.Personal + b.Personal}
+}
+
+func (a Amount) sub(b Amount) Amount {
+	return Amount{Group: a.Group - b.Group, Personal: a.Personal - b.Personal}
+}
+
+func (a Amount) rounded() Amount {
+	return Amount{Group: math.Round(a.Group*100) / 100, Personal: math.Round(a.Personal*100) / 100}
+}
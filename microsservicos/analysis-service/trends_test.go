@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	// 2026-03-12 é uma quinta-feira
+	at := time.Date(2026, 3, 12, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		granularity string
+		want        time.Time
+		next        time.Time
+	}{
+		{granularityDay, time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{granularityWeek, time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{granularityMonth, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := bucketStart(at, tt.granularity)
+		if !got.Equal(tt.want) {
+			t.Errorf("bucketStart(%s) = %v, quer %v", tt.granularity, got, tt.want)
+		}
+		if next := nextBucket(got, tt.granularity); !next.Equal(tt.next) {
+			t.Errorf("nextBucket(%s) = %v, quer %v", tt.granularity, next, tt.next)
+		}
+	}
+}
+
+func TestBucketSpending(t *testing.T) {
+	entry := func(month time.Month, day int, category string, group, personal float64) spendingEntry {
+		return spendingEntry{at: time.Date(2026, month, day, 12, 0, 0, 0, time.UTC), category: category, amount: Amount{group, personal}}
+	}
+	entries := []spendingEntry{
+		entry(1, 5, "mercado", 100, 50),
+		entry(1, 20, "lazer", 30, 10),
+		entry(3, 2, "mercado", 60, 30),
+	}
+	buckets, ok := bucketSpending(entries, granularityMonth, Period{})
+	if !ok {
+		t.Fatal("bucketSpending recusou um período pequeno")
+	}
+	want := []TrendBucket{
+		{Start: "2026-01-01", Total: Amount{130, 60}, Categories: map[string]Amount{"mercado": {100, 50}, "lazer": {30, 10}}},
+		// Meses sem gasto aparecem zerados
+		{Start: "2026-02-01", Total: Amount{}, Categories: map[string]Amount{}},
+		{Start: "2026-03-01", Total: Amount{60, 30}, Categories: map[string]Amount{"mercado": {60, 30}}},
+	}
+	if !reflect.DeepEqual(buckets, want) {
+		t.Fatalf("buckets = %+v, quer %+v", buckets, want)
+	}
+
+	applyRollingAverage(buckets, 2)
+	averages := []Amount{{130, 60}, {65, 30}, {30, 15}}
+	for i, b := range buckets {
+		if b.RollingAverage != averages[i] {
+			t.Errorf("média móvel de %s = %+v, quer %+v", b.Start, b.RollingAverage, averages[i])
+		}
+	}
+
+	deltas := monthOverMonth(buckets)
+	if deltas[1].Delta != (Amount{-130, -60}) || deltas[1].DeltaPct == nil || *deltas[1].DeltaPct != -100 {
+		t.Errorf("fevereiro = %+v, quer queda de 100%%", deltas[1])
+	}
+	// Mês anterior zerado: sem percentual
+	if deltas[2].DeltaPct != nil {
+		t.Errorf("março tem percentual %v, quer nenhum", *deltas[2].DeltaPct)
+	}
+
+	movers := topMovers(buckets[:2], 1)
+	if len(movers) != 1 || movers[0].Category != "mercado" || movers[0].Delta != (Amount{-100, -50}) {
+		t.Errorf("topMovers = %+v, quer só mercado com -100", movers)
+	}
+
+	if _, ok := bucketSpending(entries, granularityDay, Period{From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}); ok {
+		t.Error("bucketSpending deveria recusar mais de maxTrendBuckets intervalos")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"firebase.google.com/go/v4/db"
+
+	"shared/idempotency"
+)
+
+// newIdempotency guarda as respostas em idempotency_keys/{uid}/{hash da chave}
+func newIdempotency(client *db.Client) *idempotency.Middleware {
+	return &idempotency.Middleware{
+		Store: &idempotency.RTDBStore{Client: client, Root: "idempotency_keys"},
+		TTL:   idempotency.TTLFromEnv(),
+		Scope: func(r *http.Request) string {
+			uid, _ := r.Context().Value(userUIDKey).(string)
+			return uid
+		},
+	}
+}
+
+func (app *AppConfig) idempotencyMiddleware(next http.Handler) http.Handler {
+	return app.Idempotency.Handler(next)
+}
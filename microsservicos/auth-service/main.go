@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
@@ -14,6 +15,8 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/option"
+
+	"shared/idempotency"
 )
 
 type AppConfig struct {
@@ -21,6 +24,8 @@ type AppConfig struct {
 	DBClient   *db.Client
 	APIKey     string
 	JWTSecret  []byte
+
+	Idempotency *idempotency.Middleware
 }
 
 func main() {
@@ -58,8 +63,12 @@ func main() {
 		DBClient:   dbClient,
 		APIKey:     os.Getenv("FIREBASE_API_KEY"),
 		JWTSecret:  []byte(os.Getenv("JWT_SECRET")),
+
+		Idempotency: newIdempotency(dbClient),
 	}
 
+	configApp.Idempotency.StartSweeper(ctx, time.Hour)
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
@@ -68,16 +77,19 @@ func main() {
 			"https://smart-finance-distr.vercel.app",
 		},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key"},
 
 		AllowCredentials: true,
 	}))
 
+	// Cadastro e login ficam fora da idempotência: o corpo tem a senha e a
+	// resposta, o token da sessão, e nenhum dos dois pode ser guardado
 	r.Post("/api/register", configApp.handleRegister)
 	r.Post("/api/login", configApp.handleLogin)
 
 	r.Group(func(r chi.Router) {
 		r.Use(configApp.authMiddleware)
+		r.Use(configApp.idempotencyMiddleware)
 		r.Get("/api/me", configApp.handleGetMe)
 		r.Post("/api/logout", configApp.handleLogout)
 		r.Get("/api/users/{uid}", configApp.handleGetUser)
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	actionGroupCreated        = "group.created"
+	actionGroupImported       = "group.imported"
+	actionMemberJoined        = "member.joined"
+	actionMemberRoleSet       = "member.role_set"
+	actionExpenseCreated      = "expense.created"
+	actionExpenseEdited       = "expense.edited"
+	actionExpenseDeleted      = "expense.deleted"
+	actionExpenseRestored     = "expense.restored"
+	actionExpenseContested    = "expense.contested"
+	actionAttachmentAdded     = "attachment.added"
+	actionAttachmentRemoved   = "attachment.removed"
+	actionPaymentCreated      = "payment.created"
+	actionPaymentDeleted      = "payment.deleted"
+	actionPaymentRestored     = "payment.restored"
+	actionPaymentConfirmed    = "payment.confirmed"
+	actionPaymentDisputed     = "payment.disputed"
+	actionPaymentCancelled    = "payment.cancelled"
+	actionSettlementRecorded  = "settlement.recorded"
+	actionTrashPurged         = "trash.purged"
+	actionBudgetSet           = "budget.set"
+	actionBudgetRemoved       = "budget.removed"
+	actionCategorySet         = "category.set"
+	actionCategoryRemoved     = "category.removed"
+	actionCategoryMerged      = "category.merged"
+	actionRuleSet             = "rule.set"
+	actionRuleRemoved         = "rule.removed"
+	actionExpensesCategorized = "expenses.categorized"
+	actionRecurringSet        = "recurring.set"
+	actionRecurringRemoved    = "recurring.removed"
+	actionRecurringOccurred   = "recurring.occurred"
+
+	// Ator usado para ações automáticas, como a limpeza da lixeira
+	systemActor = "sistema"
+
+	defaultActivityPageSize = 20
+	maxActivityPageSize     = 100
+)
+
+var eventActions = map[string]string{
+	eventGroupCreated:        actionGroupCreated,
+	eventGroupImported:       actionGroupImported,
+	eventMemberJoined:        actionMemberJoined,
+	eventMemberRoleSet:       actionMemberRoleSet,
+	eventExpenseAdded:        actionExpenseCreated,
+	eventExpenseEdited:       actionExpenseEdited,
+	eventExpenseDeleted:      actionExpenseDeleted,
+	eventExpenseRestored:     actionExpenseRestored,
+	eventExpenseContested:    actionExpenseContested,
+	eventAttachmentAdded:     actionAttachmentAdded,
+	eventAttachmentRemoved:   actionAttachmentRemoved,
+	eventPaymentRecorded:     actionPaymentCreated,
+	eventPaymentDeleted:      actionPaymentDeleted,
+	eventPaymentRestored:     actionPaymentRestored,
+	eventPaymentConfirmed:    actionPaymentConfirmed,
+	eventPaymentDisputed:     actionPaymentDisputed,
+	eventPaymentCancelled:    actionPaymentCancelled,
+	eventSettlementRecorded:  actionSettlementRecorded,
+	eventTrashPurged:         actionTrashPurged,
+	eventBudgetSet:           actionBudgetSet,
+	eventBudgetRemoved:       actionBudgetRemoved,
+	eventCategorySet:         actionCategorySet,
+	eventCategoryRemoved:     actionCategoryRemoved,
+	eventCategoriesMerged:    actionCategoryMerged,
+	eventRuleSet:             actionRuleSet,
+	eventRuleRemoved:         actionRuleRemoved,
+	eventExpensesCategorized: actionExpensesCategorized,
+	eventRecurringSet:        actionRecurringSet,
+	eventRecurringRemoved:    actionRecurringRemoved,
+	eventRecurringOccurred:   actionRecurringOccurred,
+}
+
+// Activity é uma entrada imutável do histórico de um grupo, derivada de um evento
+// do ledger. As entradas ficam em group_activity/{groupId}/{id}, onde id é a
+// sequência do evento, e nunca são alteradas depois de gravadas.
+type Activity struct {
+	Id         string `json:"id"`
+	GroupId    string `json:"groupId"`
+	ActorId    string `json:"actorId"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetId   string `json:"targetId"`
+	Before     any    `json:"before,omitempty"`
+	After      any    `json:"after,omitempty"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+type ActivityPage struct {
+	Items      []Activity `json:"items"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+type purgedItems struct {
+	Expenses []Expense `json:"expenses,omitempty"`
+	Payments []Payment `json:"payments,omitempty"`
+}
+
+// path devolve o caminho da entrada, para uso em escritas multi-caminho
+func (a Activity) path() string {
+	return "group_activity/" + a.GroupId + "/" + a.Id
+}
+
+// applyWithActivity aplica o evento ao grupo e descreve a mudança para o histórico
+func (g *Group) applyWithActivity(e Event) (Activity, error) {
+	before := g.clone()
+	if err := g.apply(e); err != nil {
+		return Activity{}, err
+	}
+	return activityFor(e, before, g), nil
+}
+
+func activityFor(e Event, before, after *Group) Activity {
+	a := Activity{
+		Id:        seqKey(e.Seq),
+		GroupId:   e.GroupId,
+		ActorId:   e.ActorId,
+		Action:    eventActions[e.Type],
+		Timestamp: e.At,
+	}
+	switch e.Type {
+	case eventGroupCreated:
+		a.TargetType, a.TargetId, a.After = "group", after.Id, after.clone()
+	case eventGroupImported:
+		a.TargetType, a.TargetId = "group", after.Id
+	case eventMemberJoined:
+		var p memberPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "member", p.UserId
+	case eventMemberRoleSet:
+		var p roleAssignment
+		e.decode(&p)
+		a.TargetType, a.TargetId, a.After = "member", p.UserId, p
+	case eventExpenseAdded, eventExpenseEdited:
+		var p expensePayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "expense", p.Expense.Id
+	case eventExpenseDeleted, eventExpenseRestored:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "expense", p.Id
+	case eventExpenseContested:
+		var p contestPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "expense", p.Id
+	case eventAttachmentAdded:
+		var p attachmentPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId, a.After = "expense", p.ExpenseId, p.Attachment
+	case eventAttachmentRemoved:
+		var p attachmentRemovalPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId, a.Before = "expense", p.ExpenseId, before.Expenses[p.ExpenseId].Attachments[p.Id]
+	case eventPaymentRecorded, eventSettlementRecorded:
+		var p paymentPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "payment", p.Payment.Id
+	case eventPaymentDeleted, eventPaymentRestored:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "payment", p.Id
+	case eventPaymentConfirmed, eventPaymentDisputed, eventPaymentCancelled:
+		var p paymentStatusPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "payment", p.Id
+	case eventTrashPurged:
+		var p purgePayload
+		e.decode(&p)
+		purged := purgedItems{}
+		for _, id := range p.ExpenseIds {
+			purged.Expenses = append(purged.Expenses, before.Expenses[id])
+		}
+		for _, id := range p.PaymentIds {
+			purged.Payments = append(purged.Payments, before.Payments[id])
+		}
+		a.TargetType, a.TargetId, a.Before = "group", after.Id, purged
+	case eventBudgetSet:
+		var p budgetPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "budget", p.Budget.Id
+	case eventBudgetRemoved:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "budget", p.Id
+	case eventCategorySet:
+		var p categoryPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "category", p.Category.Id
+	case eventCategoryRemoved:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "category", p.Id
+	case eventCategoriesMerged:
+		// Before guarda as categorias de origem, que deixam de existir
+		var p mergePayload
+		e.decode(&p)
+		merged := []Category{}
+		for _, id := range p.SourceIds {
+			merged = append(merged, before.Categories[id])
+		}
+		a.TargetType, a.TargetId, a.Before = "category", p.TargetId, merged
+	case eventRuleSet:
+		var p rulePayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "rule", p.Rule.Id
+	case eventRuleRemoved:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "rule", p.Id
+	case eventExpensesCategorized:
+		var p categorizedPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId, a.After = "group", after.Id, p.Changes
+	case eventRecurringSet:
+		var p recurringPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "recurring", p.Recurring.Id
+	case eventRecurringRemoved:
+		var p deletionPayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "recurring", p.Id
+	case eventRecurringOccurred:
+		var p occurrencePayload
+		e.decode(&p)
+		a.TargetType, a.TargetId = "expense", p.Expense.Id
+	}
+	switch a.TargetType {
+	case "expense":
+		if exp, exists := before.Expenses[a.TargetId]; exists {
+			a.Before = exp
+		}
+		if exp, exists := after.Expenses[a.TargetId]; exists {
+			a.After = exp
+		}
+	case "payment":
+		if pay, exists := before.Payments[a.TargetId]; exists {
+			a.Before = pay
+		}
+		if pay, exists := after.Payments[a.TargetId]; exists {
+			a.After = pay
+		}
+	case "category":
+		if c, exists := before.Categories[a.TargetId]; exists && a.Before == nil {
+			a.Before = c
+		}
+		if c, exists := after.Categories[a.TargetId]; exists {
+			a.After = c
+		}
+	case "recurring":
+		if rec, exists := before.Recurring[a.TargetId]; exists {
+			a.Before = rec
+		}
+		if rec, exists := after.Recurring[a.TargetId]; exists {
+			a.After = rec
+		}
+	case "rule":
+		if rule, exists := before.Rules[a.TargetId]; exists {
+			a.Before = rule
+		}
+		if rule, exists := after.Rules[a.TargetId]; exists {
+			a.After = rule
+		}
+	case "budget":
+		if b, exists := before.Budgets[a.TargetId]; exists {
+			a.Before = b
+		}
+		if b, exists := after.Budgets[a.TargetId]; exists {
+			a.After = b
+		}
+	}
+	return a
+}
+
+// handleGetActivity lista o histórico do grupo do mais recente para o mais antigo.
+// Parâmetros: limit (padrão 20, máx. 100), before (cursor da página anterior) e
+// since (timestamp em ms; só retorna o que mudou depois dele).
+func (app *AppConfig) handleGetActivity(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultActivityPageSize
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro limit inválido", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxActivityPageSize)
+	}
+	var since int64
+	if raw := query.Get("since"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "Parâmetro since inválido", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	before := query.Get("before")
+
+	q := app.DBClient.NewRef("group_activity/" + groupUID).OrderByKey()
+	if before != "" {
+		q = q.EndAt(before)
+	}
+	// Dois itens a mais: o próprio cursor (EndAt é inclusivo) e um para saber se há próxima página
+	nodes, err := q.LimitToLast(limit + 2).GetOrdered(r.Context())
+	if err != nil {
+		http.Error(w, "Erro ao buscar atividades", http.StatusInternalServerError)
+		return
+	}
+
+	page := ActivityPage{Items: []Activity{}}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].Key() == before {
+			continue
+		}
+		var a Activity
+		if err := nodes[i].Unmarshal(&a); err != nil {
+			continue
+		}
+		if a.Timestamp <= since {
+			break
+		}
+		if len(page.Items) == limit {
+			page.NextCursor = page.Items[limit-1].Id
+			break
+		}
+		page.Items = append(page.Items, a)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyWithActivity(t *testing.T) {
+	created := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}}
+	original := Expense{Id: "e1", PayerId: "ana", Value: 10, Description: "pizza"}
+	edited := Expense{Id: "e1", PayerId: "ana", Value: 12, Description: "pizza"}
+	steps := []struct {
+		event      Event
+		action     string
+		targetType string
+		targetId   string
+		before     any
+		after      any
+	}{
+		{mustEvent(t, 1, eventGroupCreated, groupPayload{Group: created}), actionGroupCreated, "group", "g1", nil, nil},
+		{mustEvent(t, 2, eventMemberJoined, memberPayload{UserId: "bia"}), actionMemberJoined, "member", "bia", nil, nil},
+		{mustEvent(t, 3, eventExpenseAdded, expensePayload{Expense: original}), actionExpenseCreated, "expense", "e1",
+			nil, withVersion(original, 1)},
+		{mustEvent(t, 4, eventExpenseEdited, expensePayload{Expense: edited}), actionExpenseEdited, "expense", "e1",
+			withVersion(original, 1), withVersion(edited, 2)},
+		{mustEvent(t, 5, eventExpenseDeleted, deletionPayload{Id: "e1", DeletedAt: "2026-01-01T00:00:00Z", DeletedBy: "ana"}),
+			actionExpenseDeleted, "expense", "e1", withVersion(edited, 2), deleted(withVersion(edited, 3))},
+		{mustEvent(t, 6, eventTrashPurged, purgePayload{ExpenseIds: []string{"e1"}}), actionTrashPurged, "group", "g1",
+			purgedItems{Expenses: []Expense{deleted(withVersion(edited, 3))}}, nil},
+	}
+	g := &Group{}
+	g.ensureMaps()
+	for _, step := range steps {
+		a, err := g.applyWithActivity(step.event)
+		if err != nil {
+			t.Fatalf("evento %d: %v", step.event.Seq, err)
+		}
+		if a.Id != seqKey(step.event.Seq) || a.GroupId != "g1" || a.Timestamp != step.event.At {
+			t.Errorf("evento %d: entrada %+v não aponta para o evento", step.event.Seq, a)
+		}
+		if a.Action != step.action || a.TargetType != step.targetType || a.TargetId != step.targetId {
+			t.Errorf("evento %d: %s %s/%s, quer %s %s/%s", step.event.Seq, a.Action, a.TargetType, a.TargetId,
+				step.action, step.targetType, step.targetId)
+		}
+		// A criação do grupo guarda o grupo inteiro, conferido à parte
+		if step.event.Type == eventGroupCreated {
+			continue
+		}
+		if !reflect.DeepEqual(a.Before, step.before) || !reflect.DeepEqual(a.After, step.after) {
+			t.Errorf("evento %d: antes %+v depois %+v, quer %+v e %+v", step.event.Seq, a.Before, a.After, step.before, step.after)
+		}
+	}
+}
+
+func TestEventActionsCoverActivityTypes(t *testing.T) {
+	seen := map[string]bool{}
+	for eventType, action := range eventActions {
+		if action == "" {
+			t.Errorf("evento %s sem ação", eventType)
+		}
+		if seen[action] {
+			t.Errorf("ação %s usada por mais de um evento", action)
+		}
+		seen[action] = true
+	}
+}
+
+func withVersion(exp Expense, version int64) Expense {
+	exp.Version = version
+	return exp
+}
+
+func deleted(exp Expense) Expense {
+	exp.DeletedAt, exp.DeletedBy = "2026-01-01T00:00:00Z", "ana"
+	return exp
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAttachmentMaxBytes = 10 << 20
+	maxAttachments            = 10
+	maxAttachmentName         = 100
+	thumbnailSize             = 256
+	// Imagens maiores que isso não ganham miniatura, para não decodificar
+	// bitmaps gigantes na memória: 12 MP (uma foto de celular) já ocupam perto
+	// de 50 MB em RGBA, o dobro em PNG de 16 bits
+	maxThumbnailPixels = 12_000_000
+)
+
+// Tipos aceitos, detectados pelo conteúdo e não pelo que o cliente declarou
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// Attachment descreve um arquivo anexado a uma despesa. O conteúdo fica no
+// BlobStore, em attachmentKey; o grupo guarda só os metadados.
+type Attachment struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Thumbnail   bool   `json:"thumbnail,omitempty"` // há miniatura em JPEG
+	UploadedBy  string `json:"uploadedBy"`
+	UploadedAt  string `json:"uploadedAt"`
+}
+
+func attachmentKey(groupId, expenseId, attachmentId string) string {
+	return "groups/" + groupId + "/expenses/" + expenseId + "/" + attachmentId
+}
+
+func thumbnailKey(groupId, expenseId, attachmentId string) string {
+	return attachmentKey(groupId, expenseId, attachmentId) + "-thumb"
+}
+
+// attachmentMaxBytesFromEnv lê ATTACHMENT_MAX_BYTES (padrão 10 MB)
+func attachmentMaxBytesFromEnv() int64 {
+	if limit, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultAttachmentMaxBytes
+}
+
+// attachmentName limpa o nome enviado pelo cliente, que só serve para exibição
+func attachmentName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == "/" || name == "" {
+		name = "anexo"
+	}
+	if runes := []rune(name); len(runes) > maxAttachmentName {
+		name = string(runes[:maxAttachmentName])
+	}
+	return name
+}
+
+// makeThumbnail reduz a imagem para caber em thumbnailSize×thumbnailSize,
+// fazendo a média dos pixels de cada bloco. Devolve nil se o formato não puder
+// ser decodificado (PDF, WebP) ou a imagem for grande demais; as dimensões
+// vêm do cabeçalho, antes de decodificar os pixels.
+func makeThumbnail(data []byte) []byte {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !thumbnailFits(config) {
+		return nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := float64(thumbnailSize) / float64(max(w, h))
+	if scale > 1 {
+		scale = 1
+	}
+	tw, th := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// Fundo branco para áreas transparentes, já que JPEG não tem alfa
+			white := 0xffff*n - a
+			dst.Set(x, y, color.RGBA64{
+				R: uint16((r + white) / n),
+				G: uint16((g + white) / n),
+				B: uint16((b + white) / n),
+				A: 0xffff,
+			})
+		}
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// thumbnailFits indica se vale decodificar uma imagem com essas dimensões
+func thumbnailFits(config image.Config) bool {
+	w, h := int64(config.Width), int64(config.Height)
+	return w > 0 && h > 0 && w*h <= maxThumbnailPixels
+}
+
+// deleteBlobs apaga os arquivos sem interromper a operação em caso de falha;
+// um blob órfão só ocupa espaço
+func (app *AppConfig) deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := app.Blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Erro ao apagar arquivo %s: %v", key, err)
+		}
+	}
+}
+
+// handlePostAttachment recebe um arquivo (multipart, campo "file") e o anexa à
+// despesa. Qualquer membro do grupo pode anexar.
+func (app *AppConfig) handlePostAttachment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	expenseUID := chi.URLParam(r, "expenseId")
+
+	// Confere o acesso antes de ler o arquivo; execute confere de novo ao gravar
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		writeGroupError(w, err, "Erro ao buscar grupo")
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	if expense, exists := group.Expenses[expenseUID]; !exists || expense.DeletedAt != "" {
+		http.Error(w, "Despesa não encontrada", http.StatusNotFound)
+		return
+	}
+
+	maxBytes := attachmentMaxBytesFromEnv()
+	// Folga para os cabeçalhos do multipart
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Arquivo maior que o permitido", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Envie o arquivo no campo \"file\" (multipart/form-data)", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Erro ao ler arquivo", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		http.Error(w, "Arquivo maior que o permitido", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "Arquivo vazio", http.StatusBadRequest)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if !attachmentTypes[contentType] {
+		http.Error(w, "Tipo de arquivo não suportado (use JPEG, PNG, GIF, WebP ou PDF)", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	attachment := Attachment{
+		Id:          newPushID(),
+		Name:        attachmentName(header.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		UploadedBy:  uid,
+		UploadedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	// Os arquivos são gravados antes do evento: se ele falhar, são apagados
+	keys := []string{attachmentKey(groupUID, expenseUID, attachment.Id)}
+	if err := app.Blobs.Put(r.Context(), keys[0], contentType, data); err != nil {
+		log.Printf("Erro ao gravar anexo %s: %v", keys[0], err)
+		http.Error(w, "Erro ao salvar anexo", http.StatusInternalServerError)
+		return
+	}
+	if thumb := makeThumbnail(data); thumb != nil {
+		key := thumbnailKey(groupUID, expenseUID, attachment.Id)
+		if err := app.Blobs.Put(r.Context(), key, "image/jpeg", thumb); err != nil {
+			log.Printf("Erro ao gravar miniatura %s: %v", key, err)
+		} else {
+			attachment.Thumbnail = true
+			keys = append(keys, key)
+		}
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	group, _, err = app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		if !g.MemberIds[uid] {
+			return Event{}, errNotAuthorized
+		}
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if len(expenseData.Attachments) >= maxAttachments {
+			invalid := &ValidationError{}
+			invalid.add("file", fmt.Sprintf("A despesa já tem %d anexos", maxAttachments))
+			return Event{}, invalid
+		}
+		return newEvent(eventAttachmentAdded, attachmentPayload{ExpenseId: expenseUID, Attachment: attachment})
+	})
+	if err != nil {
+		app.deleteBlobs(keys)
+		writeGroupError(w, err, "Erro ao anexar arquivo")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(group.Expenses[expenseUID].Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// handleGetAttachment devolve o arquivo, ou a miniatura com ?thumbnail=1, só
+// para membros do grupo
+func (app *AppConfig) handleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	expenseUID := chi.URLParam(r, "expenseId")
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		writeGroupError(w, err, "Erro ao buscar grupo")
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	expense, exists := group.Expenses[expenseUID]
+	if !exists || expense.DeletedAt != "" {
+		http.Error(w, "Despesa não encontrada", http.StatusNotFound)
+		return
+	}
+	attachment, exists := expense.Attachments[chi.URLParam(r, "attachmentId")]
+	if !exists {
+		http.Error(w, "Anexo não encontrado", http.StatusNotFound)
+		return
+	}
+
+	key, contentType, name := attachmentKey(groupUID, expenseUID, attachment.Id), attachment.ContentType, attachment.Name
+	if thumb, _ := strconv.ParseBool(r.URL.Query().Get("thumbnail")); thumb {
+		if !attachment.Thumbnail {
+			http.Error(w, "Anexo sem miniatura", http.StatusNotFound)
+			return
+		}
+		key, contentType = thumbnailKey(groupUID, expenseUID, attachment.Id), "image/jpeg"
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + "-miniatura.jpg"
+	}
+	body, err := app.Blobs.Get(r.Context(), key)
+	if errors.Is(err, errBlobNotFound) {
+		http.Error(w, "Arquivo não encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Erro ao ler anexo %s: %v", key, err)
+		http.Error(w, "Erro ao ler anexo", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// O conteúdo de um anexo nunca muda, mas só pode ficar no cache do navegador
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	io.Copy(w, body)
+}
+
+// handleDeleteAttachment remove o anexo da despesa; pode quem o enviou e quem
+// gerencia a despesa. Como na lixeira, o arquivo continua guardado: o ledger e
+// o histórico ainda referenciam o anexo, e a reconstrução com ?at= o mostra.
+func (app *AppConfig) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	expenseUID := chi.URLParam(r, "expenseId")
+	attachmentUID := chi.URLParam(r, "attachmentId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		attachment, exists := expenseData.Attachments[attachmentUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if !g.MemberIds[uid] || (uid != attachment.UploadedBy && !expenseData.managedBy(uid)) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventAttachmentRemoved, attachmentRemovalPayload{ExpenseId: expenseUID, Id: attachmentUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao remover anexo")
+		return
+	}
+	w.Header().Set("ETag", formatETag(group.Expenses[expenseUID].Version))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestMakeThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			src.Set(x, y, color.RGBA{R: 200, A: 0xff})
+		}
+	}
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, src); err != nil {
+		t.Fatal(err)
+	}
+	thumb := makeThumbnail(photo.Bytes())
+	if thumb == nil {
+		t.Fatal("imagem pequena ficou sem miniatura")
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || config.Width != thumbnailSize || config.Height != thumbnailSize/2 {
+		t.Errorf("miniatura = %+v, %v; quer JPEG %dx%d", config, err, thumbnailSize, thumbnailSize/2)
+	}
+
+	// Cabeçalho GIF de 65535×65535 sem os pixels: recusado só pelas dimensões
+	huge := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+	if _, _, err := image.DecodeConfig(bytes.NewReader(huge)); err != nil {
+		t.Fatalf("DecodeConfig = %v", err)
+	}
+	if makeThumbnail(huge) != nil {
+		t.Error("imagem enorme ganhou miniatura")
+	}
+	if makeThumbnail([]byte("%PDF-1.7\n")) != nil {
+		t.Error("PDF ganhou miniatura")
+	}
+}
+
+func TestThumbnailFits(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          bool
+	}{
+		{4000, 3000, true},
+		{4000, 3001, false},
+		{1, 1, true},
+		{0, 10, false},
+		{1 << 30, 1 << 30, false},
+	}
+	for _, tt := range tests {
+		if got := thumbnailFits(image.Config{Width: tt.width, Height: tt.height}); got != tt.want {
+			t.Errorf("thumbnailFits(%dx%d) = %v, quer %v", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
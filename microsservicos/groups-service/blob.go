@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errBlobNotFound = errors.New("arquivo não encontrado")
+
+// BlobStore guarda o conteúdo dos anexos; os metadados ficam no grupo
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get devolve errBlobNotFound se a chave não existir
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// blobStoreFromEnv usa BLOB_BACKEND: "local" (padrão, em BLOB_DIR) ou "s3"
+// (qualquer serviço compatível com S3, com URLs no estilo de caminho)
+func blobStoreFromEnv() BlobStore {
+	switch backend := os.Getenv("BLOB_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return &localBlobStore{dir: dir}
+	case "s3":
+		store := &s3BlobStore{
+			endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			bucket:    os.Getenv("S3_BUCKET"),
+			region:    os.Getenv("S3_REGION"),
+			accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}
+		if store.region == "" {
+			store.region = "us-east-1"
+		}
+		if store.endpoint == "" || store.bucket == "" || store.accessKey == "" || store.secretKey == "" {
+			log.Fatal("BLOB_BACKEND=s3 exige S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID e S3_SECRET_ACCESS_KEY")
+		}
+		return store
+	default:
+		log.Fatalf("BLOB_BACKEND inválido: %q", backend)
+		return nil
+	}
+}
+
+// localBlobStore grava cada blob como um arquivo sob dir
+type localBlobStore struct {
+	dir string
+}
+
+func (s *localBlobStore) path(key string) (string, error) {
+	// As chaves são montadas pelo serviço, mas nunca podem sair de dir
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("chave inválida: %q", key)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s *localBlobStore) Put(_ context.Context, key, _ string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Grava em um temporário e renomeia, para não expor arquivos pela metade
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localBlobStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errBlobNotFound
+	}
+	return f, err
+}
+
+func (s *localBlobStore) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3BlobStore fala com um serviço compatível com S3 assinando as requisições
+// com AWS Signature Version 4
+type s3BlobStore struct {
+	endpoint  string // ex. https://s3.amazonaws.com ou http://localhost:9000
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, contentType, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("S3 respondeu %d ao gravar %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errBlobNotFound
+	case resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 respondeu %d ao ler %s", resp.StatusCode, key)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("S3 respondeu %d ao apagar %s", resp.StatusCode, key)
+	}
+	return nil
+}
+
+func (s *s3BlobStore) do(ctx context.Context, method, key, contentType string, body []byte) (*http.Response, error) {
+	objectPath := "/" + s.bucket + "/" + key
+	u, err := url.Parse(s.endpoint + uriEncodePath(objectPath))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, objectPath, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adiciona os headers da AWS Signature Version 4 (serviço "s3")
+func (s *s3BlobStore) sign(req *http.Request, objectPath string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical, signedHeaders := canonicalRequest(req, objectPath, payloadHash)
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.secretKey, day, s.region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalRequest monta a requisição canônica da SigV4 e a lista de headers
+// assinados: host, x-amz-content-sha256, x-amz-date e, se houver, content-type
+func canonicalRequest(req *http.Request, objectPath, payloadHash string) (canonical, signedHeaders string) {
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           req.Header.Get("X-Amz-Date"),
+	}
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+		names = append([]string{"content-type"}, names...)
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+	canonical = strings.Join([]string{
+		req.Method,
+		uriEncodePath(objectPath),
+		"", // sem query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return canonical, signedHeaders
+}
+
+// signingKey deriva a chave de assinatura do dia, região e serviço
+func signingKey(secretKey, day, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncodePath codifica cada segmento do caminho como a SigV4 exige (RFC 3986,
+// mantendo as barras)
+func uriEncodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~", c) >= 0 {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
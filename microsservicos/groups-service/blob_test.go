@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUriEncodePath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/recibos/g1/e1/a1", "/recibos/g1/e1/a1"},
+		{"/recibos/nota fiscal.pdf", "/recibos/nota%20fiscal.pdf"},
+		{"/recibos/a+b=c&d", "/recibos/a%2Bb%3Dc%26d"},
+		{"/recibos/ação~_-.jpg", "/recibos/a%C3%A7%C3%A3o~_-.jpg"},
+	}
+	for _, tt := range tests {
+		if got := uriEncodePath(tt.path); got != tt.want {
+			t.Errorf("uriEncodePath(%q) = %q, quer %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// Vetor de exemplo da documentação da AWS para a derivação da chave
+func TestSigningKey(t *testing.T) {
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("signingKey = %s", got)
+	}
+}
+
+func TestS3Sign(t *testing.T) {
+	const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := &s3BlobStore{region: "sa-east-1", accessKey: "AKID", secretKey: "segredo"}
+	tests := []struct {
+		name          string
+		method        string
+		contentType   string
+		wantCanonical string
+		wantSigned    string
+	}{
+		{
+			"leitura", http.MethodGet, "",
+			"GET\n/recibos/g1/nota%20fiscal.pdf\n\n" +
+				"host:localhost:9000\nx-amz-content-sha256:" + emptyHash + "\nx-amz-date:20260310T120000Z\n\n" +
+				"host;x-amz-content-sha256;x-amz-date\n" + emptyHash,
+			"host;x-amz-content-sha256;x-amz-date",
+		},
+		{
+			"gravação com tipo", http.MethodPut, "application/pdf",
+			"PUT\n/recibos/g1/nota%20fiscal.pdf\n\n" +
+				"content-type:application/pdf\nhost:localhost:9000\nx-amz-content-sha256:" + emptyHash + "\nx-amz-date:20260310T120000Z\n\n" +
+				"content-type;host;x-amz-content-sha256;x-amz-date\n" + emptyHash,
+			"content-type;host;x-amz-content-sha256;x-amz-date",
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://localhost:9000/recibos/g1/nota%20fiscal.pdf", nil)
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		s.sign(req, "/recibos/g1/nota fiscal.pdf", nil, now)
+
+		canonical, signed := canonicalRequest(req, "/recibos/g1/nota fiscal.pdf", emptyHash)
+		if canonical != tt.wantCanonical || signed != tt.wantSigned {
+			t.Errorf("%s: requisição canônica =\n%s\nquer\n%s", tt.name, canonical, tt.wantCanonical)
+		}
+		stringToSign := "AWS4-HMAC-SHA256\n20260310T120000Z\n20260310/sa-east-1/s3/aws4_request\n" + sha256Hex([]byte(tt.wantCanonical))
+		signature := hex.EncodeToString(hmacSHA256(signingKey("segredo", "20260310", "sa-east-1", "s3"), stringToSign))
+		want := "AWS4-HMAC-SHA256 Credential=AKID/20260310/sa-east-1/s3/aws4_request, SignedHeaders=" + tt.wantSigned + ", Signature=" + signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: Authorization = %s, quer %s", tt.name, got, want)
+		}
+		if req.Header.Get("X-Amz-Date") != "20260310T120000Z" || req.Header.Get("X-Amz-Content-Sha256") != emptyHash {
+			t.Errorf("%s: headers = %v", tt.name, req.Header)
+		}
+	}
+}
+
+// Servidor S3 falso que confere a assinatura do que chega pela rede
+func TestS3BlobStoreRoundTrip(t *testing.T) {
+	s := &s3BlobStore{bucket: "recibos", region: "us-east-1", accessKey: "AKID", secretKey: "segredo", client: http.DefaultClient}
+	verifier := *s
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+			http.Error(w, "hash do corpo", http.StatusBadRequest)
+			return
+		}
+		path := r.URL.EscapedPath()
+		signed := r.Clone(r.Context())
+		signed.URL.Host = r.Host
+		at, _ := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		signed.Header.Del("Authorization")
+		verifier.sign(signed, r.URL.Path, body, at)
+		if signed.Header.Get("Authorization") != r.Header.Get("Authorization") {
+			http.Error(w, "assinatura", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[path] = body
+		case http.MethodGet:
+			data, ok := objects[path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	s.endpoint = server.URL
+
+	ctx := t.Context()
+	key := "g1/e1/nota fiscal+1.pdf"
+	if err := s.Put(ctx, key, "application/pdf", []byte("%PDF")); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+	mu.Lock()
+	_, stored := objects["/recibos/g1/e1/nota%20fiscal%2B1.pdf"]
+	mu.Unlock()
+	if !stored {
+		t.Fatal("objeto não foi gravado no caminho codificado")
+	}
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "%PDF" {
+		t.Errorf("Get = %q", data)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, errBlobNotFound) {
+		t.Errorf("Get depois de apagar = %v, quer errBlobNotFound", err)
+	}
+
+	s.secretKey = "outro"
+	if err := s.Put(ctx, key, "application/pdf", []byte("%PDF")); err == nil {
+		t.Errorf("Put com outra chave foi aceito")
+	}
+}
+
+func TestLocalBlobStorePath(t *testing.T) {
+	s := &localBlobStore{dir: "blobs"}
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"g1/e1/a1", filepath.Join("blobs", "g1", "e1", "a1"), false},
+		{"../../etc/passwd", filepath.Join("blobs", "etc", "passwd"), false},
+		{"", "", true},
+		{"..", "", true},
+	}
+	for _, tt := range tests {
+		got, err := s.path(tt.key)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("path(%q) = %q, %v; quer %q", tt.key, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	budgetMonthly = "month"
+	budgetWeekly  = "week"
+)
+
+// Limites de alerta usados quando o orçamento não define os seus (80% e 100%)
+var defaultBudgetThresholds = []float64{0.8, 1}
+
+// Budget limita o gasto do grupo em uma categoria a cada mês ou semana.
+// Thresholds são frações do limite que disparam uma notificação ao serem
+// atingidas dentro do período.
+type Budget struct {
+	Id         string    `json:"id"`
+	Category   string    `json:"category"`
+	Period     string    `json:"period"` // "month" ou "week"
+	Limit      float64   `json:"limit"`
+	Thresholds []float64 `json:"thresholds"`
+	Version    int64     `json:"version"`
+}
+
+type BudgetRequest struct {
+	Category   string    `json:"category"`
+	Period     string    `json:"period"`
+	Limit      float64   `json:"limit"`
+	Thresholds []float64 `json:"thresholds"`
+}
+
+// validate normaliza o pedido e devolve a mensagem de erro, se houver
+func (req *BudgetRequest) validate() string {
+	req.Category = strings.TrimSpace(req.Category)
+	if req.Category == "" {
+		return "Categoria obrigatória"
+	}
+	if req.Period == "" {
+		req.Period = budgetMonthly
+	}
+	if req.Period != budgetMonthly && req.Period != budgetWeekly {
+		return "Período deve ser month ou week"
+	}
+	if req.Limit <= 0 {
+		return "Limite deve ser positivo"
+	}
+	if len(req.Thresholds) == 0 {
+		req.Thresholds = defaultBudgetThresholds
+	}
+	for _, t := range req.Thresholds {
+		if t <= 0 {
+			return "Limites de alerta devem ser positivos"
+		}
+	}
+	req.Thresholds = append([]float64(nil), req.Thresholds...)
+	sort.Float64s(req.Thresholds)
+	return ""
+}
+
+// budgetPeriodBounds devolve o início (inclusivo) e o fim (exclusivo) do mês ou
+// da semana (segunda a domingo) que contém t, em UTC
+func budgetPeriodBounds(period string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == budgetWeekly {
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	}
+	start := day.AddDate(0, 0, 1-day.Day())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// budgetSpent soma as despesas com data dentro do período cuja categoria é a
+// do orçamento ou uma das suas subcategorias
+func budgetSpent(g *Group, category string, start, end time.Time) float64 {
+	names := g.categorySubtree(category)
+	total := 0.0
+	for _, exp := range g.Expenses {
+		if exp.DeletedAt != "" || !names[normalizeCategory(exp.Category)] {
+			continue
+		}
+		if at := time.UnixMilli(int64(exp.Date)); !at.Before(start) && at.Before(end) {
+			total += exp.Value
+		}
+	}
+	return total
+}
+
+func (app *AppConfig) handleGetBudgets(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	budgets := make([]Budget, 0, len(group.Budgets))
+	for _, b := range group.Budgets {
+		budgets = append(budgets, b)
+	}
+	sort.Slice(budgets, func(i, j int) bool {
+		if budgets[i].Category != budgets[j].Category {
+			return budgets[i].Category < budgets[j].Category
+		}
+		return budgets[i].Period < budgets[j].Period
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// handlePostBudget cria um orçamento; só o dono do grupo define orçamentos
+func (app *AppConfig) handlePostBudget(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	budgetUID := newPushID()
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if g.OwnerId != uid {
+			return Event{}, errNotAuthorized
+		}
+		category, err := g.checkBudget(budgetUID, req)
+		if err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventBudgetSet, budgetPayload{Budget: Budget{
+			Id:         budgetUID,
+			Category:   category,
+			Period:     req.Period,
+			Limit:      req.Limit,
+			Thresholds: req.Thresholds,
+		}})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao criar orçamento")
+		return
+	}
+	budget := group.Budgets[budgetUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(budget.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(budget)
+}
+
+func (app *AppConfig) handlePutBudget(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	budgetUID := chi.URLParam(r, "budgetId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		budget, exists := g.Budgets[budgetUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if g.OwnerId != uid {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, budget.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		category, err := g.checkBudget(budgetUID, req)
+		if err != nil {
+			return Event{}, err
+		}
+		budget.Category, budget.Period = category, req.Period
+		budget.Limit, budget.Thresholds = req.Limit, req.Thresholds
+		return newEvent(eventBudgetSet, budgetPayload{Budget: budget})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao editar orçamento")
+		return
+	}
+	budget := group.Budgets[budgetUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(budget.Version))
+	json.NewEncoder(w).Encode(budget)
+}
+
+func (app *AppConfig) handleDeleteBudget(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	budgetUID := chi.URLParam(r, "budgetId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	_, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		budget, exists := g.Budgets[budgetUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if g.OwnerId != uid {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, budget.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventBudgetRemoved, deletionPayload{Id: budgetUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao remover orçamento")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(true)
+}
+
+// checkBudget confere o pedido contra o estado atual do grupo e devolve a
+// categoria com o nome oficial, como nas regras e recorrências
+func (g *Group) checkBudget(id string, req BudgetRequest) (string, error) {
+	if !g.knownCategory(req.Category) {
+		e := &ValidationError{}
+		e.add("category", "Categoria desconhecida")
+		return "", e
+	}
+	category := g.canonicalCategory(req.Category)
+	if duplicateBudget(g, id, category, req.Period) {
+		return "", errDuplicateBudget
+	}
+	return category, nil
+}
+
+// duplicateBudget indica se outro orçamento já cobre a mesma categoria e
+// período; nomes que só diferem em maiúsculas e espaços são a mesma categoria
+func duplicateBudget(g *Group, id, category, period string) bool {
+	key := normalizeCategory(category)
+	for _, b := range g.Budgets {
+		if b.Id != id && normalizeCategory(b.Category) == key && b.Period == period {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Alertas ---
+
+// affectsBudgets indica se o evento pode mudar o gasto de algum orçamento
+func affectsBudgets(e Event) bool {
+	switch e.Type {
+	case eventExpenseAdded, eventExpenseEdited, eventExpenseRestored, eventBudgetSet,
+		eventExpensesCategorized, eventCategorySet, eventCategoriesMerged, eventRecurringOccurred:
+		return true
+	}
+	return false
+}
+
+// reachedThreshold devolve o maior limite de alerta atingido pelo gasto, ou 0
+func (b Budget) reachedThreshold(spent float64) float64 {
+	reached := 0.0
+	for _, t := range b.Thresholds {
+		if spent >= t*b.Limit-0.005 {
+			reached = max(reached, t)
+		}
+	}
+	return reached
+}
+
+// checkBudgetAlerts avisa o Notifier quando o gasto do período atual atinge um
+// novo limite de alerta de algum orçamento. O maior limite já avisado fica em
+// budget_alerts/{groupId}/{budgetId}/{início do período}, então cada limite é
+// avisado no máximo uma vez por período, mesmo com várias instâncias; se vários
+// forem atingidos de uma vez, só o maior é avisado.
+func (app *AppConfig) checkBudgetAlerts(ctx context.Context, g *Group, now time.Time) {
+	for _, b := range g.Budgets {
+		start, end := budgetPeriodBounds(b.Period, now)
+		spent := budgetSpent(g, b.Category, start, end)
+		reached := b.reachedThreshold(spent)
+		if reached == 0 {
+			continue
+		}
+		path := "budget_alerts/" + g.Id + "/" + b.Id + "/" + start.Format(time.DateOnly)
+		err := app.DBClient.NewRef(path).Transaction(ctx, func(tn db.TransactionNode) (any, error) {
+			var notified float64
+			if err := tn.Unmarshal(&notified); err != nil {
+				return nil, err
+			}
+			if notified >= reached {
+				return nil, errNoChanges
+			}
+			return reached, nil
+		})
+		if errors.Is(err, errNoChanges) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Erro ao registrar alerta do orçamento %s do grupo %s: %v", b.Id, g.Id, err)
+			continue
+		}
+		alert := BudgetAlert{
+			GroupId:     g.Id,
+			GroupName:   g.Name,
+			BudgetId:    b.Id,
+			Category:    b.Category,
+			Period:      b.Period,
+			PeriodStart: start.Format(time.DateOnly),
+			Limit:       b.Limit,
+			Spent:       math.Round(spent*100) / 100,
+			Threshold:   reached,
+			At:          now.UnixMilli(),
+		}
+		if err := app.Notifier.Notify(ctx, alert); err != nil {
+			log.Printf("Erro ao notificar alerta do orçamento %s do grupo %s: %v", b.Id, g.Id, err)
+		}
+	}
+}
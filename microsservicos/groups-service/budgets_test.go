@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func budgetTestGroup() *Group {
+	march := float64(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli())
+	april := float64(time.Date(2026, 4, 2, 12, 0, 0, 0, time.UTC).UnixMilli())
+	return &Group{
+		Categories: map[string]Category{
+			"casa":    {Id: "casa", Name: "Casa"},
+			"luz":     {Id: "luz", Name: "Luz", ParentId: "casa"},
+			"agua":    {Id: "agua", Name: "Água", ParentId: "luz"},
+			"lazer":   {Id: "lazer", Name: "Lazer"},
+			"cinema":  {Id: "cinema", Name: "Cinema", ParentId: "lazer"},
+			"mercado": {Id: "mercado", Name: "Mercado"},
+		},
+		Expenses: map[string]Expense{
+			"e1": {Category: "Casa", Value: 100, Date: march},
+			"e2": {Category: "luz", Value: 50, Date: march},
+			"e3": {Category: "Água", Value: 25, Date: march},
+			"e4": {Category: "Cinema", Value: 40, Date: march},
+			"e5": {Category: "Casa", Value: 70, Date: april},
+			"e6": {Category: "Luz", Value: 30, Date: march, DeletedAt: "2026-03-11T00:00:00Z"},
+		},
+		Budgets: map[string]Budget{
+			"b1": {Id: "b1", Category: "Mercado", Period: budgetMonthly},
+		},
+	}
+}
+
+func TestBudgetSpentRollsUpSubcategories(t *testing.T) {
+	g := budgetTestGroup()
+	start, end := budgetPeriodBounds(budgetMonthly, time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		category string
+		want     float64
+	}{
+		{"Casa", 175},
+		{"  casa ", 175},
+		{"Luz", 75},
+		{"Água", 25},
+		{"Lazer", 40},
+		{"Mercado", 0},
+		// Categoria livre só soma a si mesma
+		{"Outros", 0},
+	}
+	for _, tt := range tests {
+		if got := budgetSpent(g, tt.category, start, end); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("budgetSpent(%q) = %v, quer %v", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	g := budgetTestGroup()
+	tests := []struct {
+		name     string
+		id       string
+		req      BudgetRequest
+		want     string
+		wantErr  error
+		wantFail bool
+	}{
+		{"nome oficial", "novo", BudgetRequest{Category: "  luz", Period: budgetMonthly}, "Luz", nil, false},
+		{"duplicado com outra caixa", "novo", BudgetRequest{Category: "MERCADO", Period: budgetMonthly}, "", errDuplicateBudget, true},
+		{"mesmo orçamento", "b1", BudgetRequest{Category: "mercado", Period: budgetMonthly}, "Mercado", nil, false},
+		{"outro período", "novo", BudgetRequest{Category: "mercado", Period: budgetWeekly}, "Mercado", nil, false},
+		{"categoria desconhecida", "novo", BudgetRequest{Category: "Viagem", Period: budgetMonthly}, "", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := g.checkBudget(tt.id, tt.req)
+		if (err != nil) != tt.wantFail {
+			t.Errorf("%s: erro = %v, quer falha %v", tt.name, err, tt.wantFail)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: erro = %v, quer %v", tt.name, err, tt.wantErr)
+		}
+		var verr *ValidationError
+		if tt.wantFail && tt.wantErr == nil && !errors.As(err, &verr) {
+			t.Errorf("%s: erro = %v, quer ValidationError", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: categoria = %q, quer %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetRequestValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            BudgetRequest
+		wantErr        bool
+		wantPeriod     string
+		wantThresholds []float64
+	}{
+		{"padrões", BudgetRequest{Category: " Casa ", Limit: 100}, false, budgetMonthly, []float64{0.8, 1}},
+		{"limites ordenados", BudgetRequest{Category: "Casa", Period: budgetWeekly, Limit: 100, Thresholds: []float64{1.2, 0.5}}, false, budgetWeekly, []float64{0.5, 1.2}},
+		{"sem categoria", BudgetRequest{Category: "  ", Limit: 100}, true, "", nil},
+		{"período inválido", BudgetRequest{Category: "Casa", Period: "year", Limit: 100}, true, "", nil},
+		{"limite zero", BudgetRequest{Category: "Casa"}, true, "", nil},
+		{"limite de alerta negativo", BudgetRequest{Category: "Casa", Limit: 100, Thresholds: []float64{-0.5}}, true, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.req.validate()
+			if (msg != "") != tt.wantErr {
+				t.Fatalf("validate() = %q, quer erro = %v", msg, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.req.Category != "Casa" || tt.req.Period != tt.wantPeriod || !slices.Equal(tt.req.Thresholds, tt.wantThresholds) {
+				t.Errorf("pedido normalizado = %+v", tt.req)
+			}
+		})
+	}
+	// O padrão não é compartilhado com o pedido
+	req := BudgetRequest{Category: "Casa", Limit: 100}
+	req.validate()
+	req.Thresholds[0] = 0.1
+	if defaultBudgetThresholds[0] != 0.8 {
+		t.Errorf("validate alterou os limites padrão: %v", defaultBudgetThresholds)
+	}
+}
+
+func TestBudgetPeriodBounds(t *testing.T) {
+	tests := []struct {
+		period     string
+		at         time.Time
+		start, end string
+	}{
+		{budgetMonthly, time.Date(2026, 3, 31, 23, 59, 0, 0, time.UTC), "2026-03-01", "2026-04-01"},
+		{budgetMonthly, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), "2026-12-01", "2027-01-01"},
+		// Semanas vão de segunda a domingo
+		{budgetWeekly, time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC), "2026-03-09", "2026-03-16"},
+		{budgetWeekly, time.Date(2026, 3, 15, 23, 0, 0, 0, time.UTC), "2026-03-09", "2026-03-16"},
+		{budgetWeekly, time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), "2026-03-16", "2026-03-23"},
+		// Horário de outro fuso conta pelo dia em UTC
+		{budgetMonthly, time.Date(2026, 3, 31, 22, 0, 0, 0, time.FixedZone("BRT", -3*3600)), "2026-04-01", "2026-05-01"},
+	}
+	for _, tt := range tests {
+		start, end := budgetPeriodBounds(tt.period, tt.at)
+		if start.Format(time.DateOnly) != tt.start || end.Format(time.DateOnly) != tt.end {
+			t.Errorf("budgetPeriodBounds(%s, %v) = %s..%s, quer %s..%s", tt.period, tt.at,
+				start.Format(time.DateOnly), end.Format(time.DateOnly), tt.start, tt.end)
+		}
+	}
+}
+
+func TestReachedThreshold(t *testing.T) {
+	b := Budget{Limit: 200, Thresholds: []float64{0.5, 0.8, 1}}
+	tests := []struct {
+		spent float64
+		want  float64
+	}{
+		{0, 0},
+		{99.99, 0},
+		// Diferenças de arredondamento abaixo de meio centavo contam como atingido
+		{99.996, 0.5},
+		{100, 0.5},
+		{170, 0.8},
+		// Vários limites atingidos de uma vez: só o maior é avisado
+		{250, 1},
+	}
+	for _, tt := range tests {
+		if got := b.reachedThreshold(tt.spent); got != tt.want {
+			t.Errorf("reachedThreshold(%v) = %v, quer %v", tt.spent, got, tt.want)
+		}
+	}
+}
+
+func TestAffectsBudgets(t *testing.T) {
+	tests := []struct {
+		eventType string
+		want      bool
+	}{
+		{eventExpenseAdded, true},
+		{eventExpenseEdited, true},
+		{eventExpenseRestored, true},
+		{eventRecurringOccurred, true},
+		{eventCategoriesMerged, true},
+		{eventBudgetSet, true},
+		// Excluir ou pagar só reduz o gasto; não há alerta novo
+		{eventExpenseDeleted, false},
+		{eventPaymentRecorded, false},
+		{eventMemberJoined, false},
+	}
+	for _, tt := range tests {
+		if got := affectsBudgets(Event{Type: tt.eventType}); got != tt.want {
+			t.Errorf("affectsBudgets(%s) = %v, quer %v", tt.eventType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"shared/bus"
+)
+
+// groupSubject é o assunto em que são publicados os eventos de um grupo
+func groupSubject(groupId string) string {
+	return "groups." + groupId
+}
+
+// busFromEnv escolhe o barramento: EVENT_BUS_URL vazio usa o barramento em
+// memória (só este processo recebe os eventos); nats://host:porta conecta a um
+// servidor NATS ou ao substituto local ("go run . event-bus").
+func busFromEnv() bus.Bus {
+	raw := os.Getenv("EVENT_BUS_URL")
+	if raw == "" {
+		return bus.NewMemory()
+	}
+	b, err := bus.Connect(raw, "groups-service")
+	if err != nil {
+		log.Fatalf("EVENT_BUS_URL inválido: %v", err)
+	}
+	return b
+}
+
+// publishEvent avisa os assinantes sobre um evento já gravado no ledger. Falhas
+// só são registradas: quem consome detecta lacunas pela sequência.
+func (app *AppConfig) publishEvent(e Event) {
+	if app.Bus == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := app.Bus.Publish(groupSubject(e.GroupId), data); err != nil {
+		log.Printf("Erro ao publicar evento %d do grupo %s: %v", e.Seq, e.GroupId, err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"shared/bus"
+)
+
+// runBusServerCommand implementa o subcomando "event-bus [-addr :4222]": um
+// substituto local de um servidor NATS, para desenvolvimento
+func runBusServerCommand(args []string) {
+	fs := flag.NewFlagSet("event-bus", flag.ExitOnError)
+	addr := fs.String("addr", ":4222", "endereço em que o barramento escuta")
+	fs.Parse(args)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Erro ao abrir %s: %v", *addr, err)
+	}
+	log.Printf("Barramento de eventos local escutando em %s", *addr)
+	log.Fatal(bus.Serve(ln))
+}
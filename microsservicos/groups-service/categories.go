@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxCategoryName = 40
+	maxCategoryIcon = 32
+)
+
+var categoryColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Category é uma categoria gerenciada do grupo. As despesas continuam guardando
+// o nome da categoria em Expense.Category; renomear ou mesclar categorias
+// reescreve esse nome nas despesas e orçamentos.
+type Category struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+	ParentId string `json:"parentId,omitempty"`
+	Version  int64  `json:"version"`
+}
+
+type CategoryRequest struct {
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Icon     string `json:"icon"`
+	ParentId string `json:"parentId"`
+}
+
+// MergeCategoriesRequest mescla as fontes (ids de categorias ou nomes soltos
+// usados nas despesas, ex. "supermercado") na categoria Into
+type MergeCategoriesRequest struct {
+	Sources []string `json:"sources"`
+	Into    string   `json:"into"`
+}
+
+type CategoriesResponse struct {
+	Categories []Category `json:"categories"`
+	// Nomes usados em despesas que não correspondem a nenhuma categoria
+	Unmanaged []string `json:"unmanaged"`
+}
+
+// normalizeCategory compara nomes sem diferenciar maiúsculas e espaços extras
+func normalizeCategory(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// canonicalCategory devolve o nome da categoria gerenciada equivalente a name,
+// ou name sem espaços extras se não houver
+func (g *Group) canonicalCategory(name string) string {
+	if c, ok := g.categoryByName(name); ok {
+		return c.Name
+	}
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func (g *Group) categoryByName(name string) (Category, bool) {
+	key := normalizeCategory(name)
+	for _, c := range g.Categories {
+		if normalizeCategory(c.Name) == key {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
+
+// renameCategory troca o nome da categoria nas despesas, orçamentos e regras
+// cujo nome normalizado está em names. Os registros alterados ganham nova versão.
+func (g *Group) renameCategory(names map[string]bool, to string) {
+	for id, exp := range g.Expenses {
+		if names[normalizeCategory(exp.Category)] && exp.Category != to {
+			exp.Category = to
+			exp.Version++
+			g.Expenses[id] = exp
+		}
+	}
+	for id, b := range g.Budgets {
+		if names[normalizeCategory(b.Category)] && b.Category != to {
+			b.Category = to
+			b.Version++
+			g.Budgets[id] = b
+		}
+	}
+	for id, rule := range g.Rules {
+		if names[normalizeCategory(rule.Category)] && rule.Category != to {
+			rule.Category = to
+			rule.Version++
+			g.Rules[id] = rule
+		}
+	}
+}
+
+// reparentCategories move os filhos de uma categoria removida para parentId
+func (g *Group) reparentCategories(removedId, parentId string) {
+	for id, c := range g.Categories {
+		if c.ParentId == removedId {
+			c.ParentId = parentId
+			c.Version++
+			g.Categories[id] = c
+		}
+	}
+}
+
+// validate normaliza o pedido e devolve a mensagem de erro, se houver
+func (req *CategoryRequest) validate() string {
+	req.Name = strings.Join(strings.Fields(req.Name), " ")
+	switch {
+	case req.Name == "":
+		return "Nome da categoria obrigatório"
+	case len([]rune(req.Name)) > maxCategoryName:
+		return "Nome da categoria muito longo"
+	case req.Color != "" && !categoryColor.MatchString(req.Color):
+		return "Cor deve estar no formato #RRGGBB"
+	case len([]rune(req.Icon)) > maxCategoryIcon:
+		return "Ícone muito longo"
+	}
+	return ""
+}
+
+// checkCategory verifica, no estado atual do grupo, se a categoria id pode ter
+// o nome e a categoria pai pedidos
+func (g *Group) checkCategory(id string, req CategoryRequest) error {
+	if c, ok := g.categoryByName(req.Name); ok && c.Id != id {
+		return errCategoryExists
+	}
+	// A nova categoria pai deve existir e não pode ser a própria nem uma descendente
+	for parent := req.ParentId; parent != ""; parent = g.Categories[parent].ParentId {
+		if _, exists := g.Categories[parent]; !exists || parent == id {
+			return errInvalidParent
+		}
+	}
+	return nil
+}
+
+func (app *AppConfig) handleGetCategories(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	resp := CategoriesResponse{Categories: []Category{}, Unmanaged: []string{}}
+	for _, c := range group.Categories {
+		resp.Categories = append(resp.Categories, c)
+	}
+	sort.Slice(resp.Categories, func(i, j int) bool { return resp.Categories[i].Name < resp.Categories[j].Name })
+	seen := map[string]bool{}
+	for _, exp := range group.Expenses {
+		key := normalizeCategory(exp.Category)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, managed := group.categoryByName(exp.Category); !managed {
+			resp.Unmanaged = append(resp.Unmanaged, exp.Category)
+		}
+	}
+	sort.Strings(resp.Unmanaged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handlePostCategory cria uma categoria. Despesas que já usavam o mesmo nome
+// com outra grafia ("mercado ", "MERCADO") passam a usar o nome da categoria.
+func (app *AppConfig) handlePostCategory(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	categoryUID := newPushID()
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if err := g.checkCategory(categoryUID, req); err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventCategorySet, categoryPayload{Category: Category{
+			Id:       categoryUID,
+			Name:     req.Name,
+			Color:    req.Color,
+			Icon:     req.Icon,
+			ParentId: req.ParentId,
+		}})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao criar categoria")
+		return
+	}
+	category := group.Categories[categoryUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(category.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// handlePutCategory altera a categoria; mudar o nome reescreve as despesas
+func (app *AppConfig) handlePutCategory(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	categoryUID := chi.URLParam(r, "categoryId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		category, exists := g.Categories[categoryUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, category.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if err := g.checkCategory(categoryUID, req); err != nil {
+			return Event{}, err
+		}
+		payload := categoryPayload{PreviousName: category.Name}
+		category.Name, category.Color, category.Icon, category.ParentId = req.Name, req.Color, req.Icon, req.ParentId
+		payload.Category = category
+		return newEvent(eventCategorySet, payload)
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao editar categoria")
+		return
+	}
+	category := group.Categories[categoryUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(category.Version))
+	json.NewEncoder(w).Encode(category)
+}
+
+// handleDeleteCategory remove a categoria; as despesas mantêm o nome e as
+// subcategorias passam para a categoria pai da removida
+func (app *AppConfig) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	categoryUID := chi.URLParam(r, "categoryId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	_, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		category, exists := g.Categories[categoryUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, category.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventCategoryRemoved, deletionPayload{Id: categoryUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao remover categoria")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(true)
+}
+
+// handleMergeCategories reescreve as despesas e orçamentos das fontes com o
+// nome da categoria de destino e remove as categorias de origem
+func (app *AppConfig) handleMergeCategories(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req MergeCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if req.Into == "" || len(req.Sources) == 0 {
+		http.Error(w, "Informe as categorias de origem e a de destino", http.StatusBadRequest)
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		target, exists := g.Categories[req.Into]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		p := mergePayload{TargetId: target.Id}
+		for _, source := range req.Sources {
+			name := source
+			if c, managed := g.Categories[source]; managed {
+				p.SourceIds = append(p.SourceIds, c.Id)
+				name = c.Name
+			} else if c, managed := g.categoryByName(source); managed {
+				p.SourceIds = append(p.SourceIds, c.Id)
+			}
+			if key := normalizeCategory(name); key != "" {
+				p.Names = append(p.Names, key)
+			}
+		}
+		for _, id := range p.SourceIds {
+			if id == target.Id || g.isDescendant(target.Id, id) {
+				return Event{}, errInvalidParent
+			}
+		}
+		return newEvent(eventCategoriesMerged, p)
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao mesclar categorias")
+		return
+	}
+	category := group.Categories[req.Into]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(category.Version))
+	json.NewEncoder(w).Encode(category)
+}
+
+// categorySubtree devolve os nomes normalizados de name e de todas as
+// categorias abaixo dela, para que o orçamento de uma categoria pai inclua o
+// gasto das filhas
+func (g *Group) categorySubtree(name string) map[string]bool {
+	names := map[string]bool{normalizeCategory(name): true}
+	root, ok := g.categoryByName(name)
+	if !ok {
+		return names
+	}
+	for id, c := range g.Categories {
+		if g.isDescendant(id, root.Id) {
+			names[normalizeCategory(c.Name)] = true
+		}
+	}
+	return names
+}
+
+// isDescendant indica se id está abaixo de ancestorId na hierarquia
+func (g *Group) isDescendant(id, ancestorId string) bool {
+	for parent := g.Categories[id].ParentId; parent != ""; parent = g.Categories[parent].ParentId {
+		if parent == ancestorId {
+			return true
+		}
+	}
+	return false
+}
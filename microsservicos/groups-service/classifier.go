@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// Origem de uma categoria atribuída automaticamente (Expense.CategorySource);
+	// vazio significa que foi escolhida por um membro
+	categorySourceRule       = "rule:" // seguido do id da regra
+	categorySourceClassifier = "classifier"
+
+	defaultMinConfidence = 0.6
+	maxSuggestions       = 3
+)
+
+var accentFolder = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ü", "u", "ç", "c",
+)
+
+var stopwords = map[string]bool{
+	"de": true, "da": true, "do": true, "das": true, "dos": true, "em": true, "no": true,
+	"na": true, "nos": true, "nas": true, "para": true, "pra": true, "com": true, "um": true, "uma": true,
+}
+
+type Suggestion struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"` // probabilidade estimada, de 0 a 1
+}
+
+// categoryClassifier é um naive Bayes multinomial treinado com as despesas já
+// categorizadas do grupo. As características são as palavras da descrição, o
+// pagador e a faixa de valor.
+type categoryClassifier struct {
+	docs   map[string]int            // despesas por categoria
+	counts map[string]map[string]int // categoria -> característica -> ocorrências
+	totals map[string]int            // características por categoria
+	vocab  map[string]int            // ocorrências de cada característica
+	n      int
+}
+
+// expenseFeatures extrai as características de uma despesa
+func expenseFeatures(description, payerId string, value float64) []string {
+	text := accentFolder.Replace(strings.ToLower(description))
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	features := make([]string, 0, len(words)+2)
+	for _, w := range words {
+		if len([]rune(w)) >= 2 && !stopwords[w] {
+			features = append(features, w)
+		}
+	}
+	if payerId != "" {
+		features = append(features, "pagador:"+payerId)
+	}
+	// Faixas em potências de 2: 0-1, 1-3, 3-7, 7-15, ...
+	features = append(features, "valor:"+strconv.Itoa(int(math.Log2(math.Max(value, 0)+1))))
+	return features
+}
+
+// trainingExpense indica se a despesa entra no treino: só categorias escolhidas
+// por membros ou regras, para o classificador não aprender com os próprios palpites
+func trainingExpense(exp Expense) bool {
+	return exp.DeletedAt == "" && exp.Category != "" && exp.CategorySource != categorySourceClassifier
+}
+
+func trainClassifier(g *Group) *categoryClassifier {
+	c := &categoryClassifier{
+		docs:   map[string]int{},
+		counts: map[string]map[string]int{},
+		totals: map[string]int{},
+		vocab:  map[string]int{},
+	}
+	for _, exp := range g.Expenses {
+		if trainingExpense(exp) {
+			c.add(exp.Category, expenseFeatures(exp.Description, exp.PayerId, exp.Value), 1)
+		}
+	}
+	return c
+}
+
+// add inclui (delta 1) ou retira (delta -1) uma despesa do treino
+func (c *categoryClassifier) add(category string, features []string, delta int) {
+	c.n += delta
+	c.docs[category] += delta
+	if c.counts[category] == nil {
+		c.counts[category] = map[string]int{}
+	}
+	for _, f := range features {
+		c.counts[category][f] += delta
+		c.totals[category] += delta
+		c.vocab[f] += delta
+		if c.vocab[f] == 0 {
+			delete(c.vocab, f)
+		}
+	}
+	if c.docs[category] == 0 {
+		delete(c.docs, category)
+		delete(c.counts, category)
+		delete(c.totals, category)
+	}
+}
+
+// predict devolve as categorias da mais para a menos provável
+func (c *categoryClassifier) predict(features []string) []Suggestion {
+	if c.n == 0 {
+		return []Suggestion{}
+	}
+	vocabSize := float64(len(c.vocab) + 1)
+	scores := make(map[string]float64, len(c.docs))
+	best := math.Inf(-1)
+	for category, docs := range c.docs {
+		score := math.Log(float64(docs) / float64(c.n))
+		for _, f := range features {
+			score += math.Log((float64(c.counts[category][f]) + 1) / (float64(c.totals[category]) + vocabSize))
+		}
+		scores[category] = score
+		best = math.Max(best, score)
+	}
+	// Normaliza as pontuações (log) em probabilidades
+	sum := 0.0
+	for category, score := range scores {
+		scores[category] = math.Exp(score - best)
+		sum += scores[category]
+	}
+	suggestions := make([]Suggestion, 0, len(scores))
+	for category, score := range scores {
+		suggestions = append(suggestions, Suggestion{Category: category, Confidence: math.Round(score/sum*1000) / 1000})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Category < suggestions[j].Category
+	})
+	return suggestions
+}
+
+type SuggestRequest struct {
+	Description string  `json:"description"`
+	Value       float64 `json:"value"`
+	PayerId     string  `json:"payerId"`
+}
+
+type SuggestResponse struct {
+	// Regra que seria aplicada se a despesa fosse criada sem categoria
+	Rule        *CategoryRule `json:"rule,omitempty"`
+	Suggestions []Suggestion  `json:"suggestions"`
+}
+
+// handleSuggestCategory sugere categorias para uma despesa ainda não criada
+func (app *AppConfig) handleSuggestCategory(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req SuggestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	if req.PayerId == "" {
+		req.PayerId = uid
+	}
+	resp := SuggestResponse{}
+	if rule, ok := group.matchRule(req.Description, req.PayerId, req.Value); ok {
+		resp.Rule = &rule
+	}
+	resp.Suggestions = trainClassifier(group).predict(expenseFeatures(req.Description, req.PayerId, req.Value))
+	if len(resp.Suggestions) > maxSuggestions {
+		resp.Suggestions = resp.Suggestions[:maxSuggestions]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CategorizeRequest controla a reclassificação das despesas existentes
+type CategorizeRequest struct {
+	// "rules", "classifier" ou "all" (padrão): regras primeiro, depois o classificador
+	Method string `json:"method"`
+	// Por padrão só despesas sem categoria ou categorizadas automaticamente são
+	// revistas; com overwrite, também as escolhidas por membros
+	Overwrite     bool     `json:"overwrite"`
+	MinConfidence *float64 `json:"minConfidence"`
+	DryRun        bool     `json:"dryRun"`
+}
+
+type CategoryChange struct {
+	ExpenseId   string  `json:"expenseId"`
+	Description string  `json:"description"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Source      string  `json:"source"`
+	Confidence  float64 `json:"confidence,omitempty"`
+}
+
+type CategorizeResponse struct {
+	Changes []CategoryChange `json:"changes"`
+	Applied bool             `json:"applied"`
+	Version int64            `json:"version,omitempty"`
+}
+
+// planCategorization calcula a nova categoria de cada despesa revista
+func (g *Group) planCategorization(req CategorizeRequest) []CategoryChange {
+	useRules := req.Method != "classifier"
+	useClassifier := req.Method != "rules"
+	minConfidence := defaultMinConfidence
+	if req.MinConfidence != nil {
+		minConfidence = *req.MinConfidence
+	}
+	classifier := trainClassifier(g)
+	rules := g.ruleMatcher()
+
+	ids := make([]string, 0, len(g.Expenses))
+	for id := range g.Expenses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	changes := []CategoryChange{}
+	for _, id := range ids {
+		exp := g.Expenses[id]
+		if exp.DeletedAt != "" || (!req.Overwrite && exp.Category != "" && exp.CategorySource == "") {
+			continue
+		}
+		change := CategoryChange{ExpenseId: id, Description: exp.Description, From: exp.Category}
+		if rule, ok := rules.match(exp.Description, exp.PayerId, exp.Value); useRules && ok {
+			change.To, change.Source = g.canonicalCategory(rule.Category), categorySourceRule+rule.Id
+		} else if useClassifier {
+			features := expenseFeatures(exp.Description, exp.PayerId, exp.Value)
+			// A própria despesa não conta no treino da sua previsão
+			if trainingExpense(exp) {
+				classifier.add(exp.Category, features, -1)
+			}
+			if suggestions := classifier.predict(features); len(suggestions) > 0 && suggestions[0].Confidence >= minConfidence {
+				change.To, change.Source, change.Confidence = suggestions[0].Category, categorySourceClassifier, suggestions[0].Confidence
+			}
+			if trainingExpense(exp) {
+				classifier.add(exp.Category, features, 1)
+			}
+		}
+		if change.To != "" && (change.To != exp.Category || change.Source != exp.CategorySource) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// handleCategorize refaz a classificação das despesas do grupo. Com dryRun só
+// devolve as mudanças; sem ele, grava todas em um único evento.
+func (app *AppConfig) handleCategorize(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req CategorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if req.Method == "" {
+		req.Method = "all"
+	}
+	if req.Method != "all" && req.Method != "rules" && req.Method != "classifier" {
+		http.Error(w, "Método deve ser rules, classifier ou all", http.StatusBadRequest)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+
+	var resp CategorizeResponse
+	if req.DryRun {
+		group, err := app.getGroup(r.Context(), groupUID)
+		if err != nil {
+			http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+			return
+		}
+		if !group.MemberIds[uid] {
+			http.Error(w, "Nao autorizado", http.StatusForbidden)
+			return
+		}
+		group.ensureMaps()
+		resp = CategorizeResponse{Changes: group.planCategorization(req), Version: group.Version}
+	} else {
+		group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+			if !g.MemberIds[uid] {
+				return Event{}, errNotAuthorized
+			}
+			// Trocar categorias escolhidas por outros membros é gestão de
+			// categorias: só o dono e os tesoureiros
+			if req.Overwrite && !g.canAdminister(uid) {
+				return Event{}, errNotAuthorized
+			}
+			resp.Changes = g.planCategorization(req)
+			if len(resp.Changes) == 0 {
+				return Event{}, errNoChanges
+			}
+			p := categorizedPayload{}
+			for _, c := range resp.Changes {
+				p.Changes = append(p.Changes, categorizedExpense{Id: c.ExpenseId, Category: c.To, Source: c.Source})
+			}
+			return newEvent(eventExpensesCategorized, p)
+		})
+		switch {
+		case err == nil:
+			resp.Applied, resp.Version = true, group.Version
+		case errors.Is(err, errNoChanges):
+			resp.Changes = []CategoryChange{}
+		default:
+			writeGroupError(w, err, "Erro ao reclassificar despesas")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
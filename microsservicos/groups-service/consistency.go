@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Divergence descreve um vínculo membro/grupo presente em apenas um dos índices.
+type Divergence struct {
+	GroupId string `json:"groupId"`
+	UserId  string `json:"userId"`
+	Problem string `json:"problem"`
+}
+
+const (
+	missingUserGroup = "membro sem entrada em user_groups"
+	orphanUserGroup  = "user_groups aponta para grupo sem o membro"
+)
+
+// checkConsistency compara groups/*/memberIds com user_groups/*.
+// O documento do grupo é a fonte da verdade: entradas ausentes em user_groups
+// são recriadas e entradas órfãs são removidas quando repair é verdadeiro.
+func (app *AppConfig) checkConsistency(ctx context.Context, repair bool) ([]Divergence, error) {
+	var groups map[string]Group
+	if err := app.DBClient.NewRef("groups").Get(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("erro ao ler grupos: %w", err)
+	}
+	var userGroups map[string]map[string]bool
+	if err := app.DBClient.NewRef("user_groups").Get(ctx, &userGroups); err != nil {
+		return nil, fmt.Errorf("erro ao ler user_groups: %w", err)
+	}
+
+	divergences, updates := indexDivergences(groups, userGroups)
+	if repair && len(updates) > 0 {
+		if err := app.multiUpdate(ctx, updates); err != nil {
+			return divergences, fmt.Errorf("erro ao reparar índices: %w", err)
+		}
+	}
+	return divergences, nil
+}
+
+// indexDivergences lista os vínculos presentes em só um dos índices e as
+// escritas que os reparam
+func indexDivergences(groups map[string]Group, userGroups map[string]map[string]bool) ([]Divergence, map[string]any) {
+	divergences := []Divergence{}
+	updates := map[string]any{}
+	for groupId, group := range groups {
+		for userId, isMember := range group.MemberIds {
+			if isMember && !userGroups[userId][groupId] {
+				divergences = append(divergences, Divergence{groupId, userId, missingUserGroup})
+				updates["user_groups/"+userId+"/"+groupId] = true
+			}
+		}
+	}
+	for userId, entries := range userGroups {
+		for groupId := range entries {
+			group, exists := groups[groupId]
+			if !exists || !group.MemberIds[userId] {
+				divergences = append(divergences, Divergence{groupId, userId, orphanUserGroup})
+				updates["user_groups/"+userId+"/"+groupId] = nil
+			}
+		}
+	}
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].GroupId != divergences[j].GroupId {
+			return divergences[i].GroupId < divergences[j].GroupId
+		}
+		return divergences[i].UserId < divergences[j].UserId
+	})
+	return divergences, updates
+}
+
+// runConsistencyCommand implementa o subcomando "check-consistency [-repair]".
+func (app *AppConfig) runConsistencyCommand(args []string) {
+	fs := flag.NewFlagSet("check-consistency", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "corrige as divergências encontradas")
+	fs.Parse(args)
+
+	divergences, err := app.checkConsistency(context.Background(), *repair)
+	if err != nil {
+		log.Fatalf("Erro na verificação de consistência: %v", err)
+	}
+	for _, d := range divergences {
+		fmt.Printf("grupo %s, usuário %s: %s\n", d.GroupId, d.UserId, d.Problem)
+	}
+	switch {
+	case len(divergences) == 0:
+		fmt.Println("Nenhuma divergência encontrada")
+	case *repair:
+		fmt.Printf("%d divergências reparadas\n", len(divergences))
+	default:
+		fmt.Printf("%d divergências encontradas (use -repair para corrigir)\n", len(divergences))
+	}
+}
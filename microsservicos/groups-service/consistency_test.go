@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexDivergences(t *testing.T) {
+	groups := map[string]Group{
+		"g1": {Id: "g1", MemberIds: map[string]bool{"ana": true, "bia": true, "ex": false}},
+		"g2": {Id: "g2", MemberIds: map[string]bool{"bia": true}},
+	}
+	tests := []struct {
+		name        string
+		userGroups  map[string]map[string]bool
+		want        []Divergence
+		wantUpdates map[string]any
+	}{
+		{
+			name:        "consistente",
+			userGroups:  map[string]map[string]bool{"ana": {"g1": true}, "bia": {"g1": true, "g2": true}},
+			want:        []Divergence{},
+			wantUpdates: map[string]any{},
+		},
+		{
+			name:       "membro sem índice",
+			userGroups: map[string]map[string]bool{"bia": {"g1": true, "g2": true}},
+			want:       []Divergence{{"g1", "ana", missingUserGroup}},
+			wantUpdates: map[string]any{
+				"user_groups/ana/g1": true,
+			},
+		},
+		{
+			name: "índice órfão e grupo inexistente",
+			userGroups: map[string]map[string]bool{
+				"ana": {"g1": true, "g2": true},
+				"bia": {"g1": true, "g2": true},
+				"ex":  {"g1": true, "g9": true},
+			},
+			want: []Divergence{
+				{"g1", "ex", orphanUserGroup},
+				{"g2", "ana", orphanUserGroup},
+				{"g9", "ex", orphanUserGroup},
+			},
+			wantUpdates: map[string]any{
+				"user_groups/ana/g2": nil,
+				"user_groups/ex/g1":  nil,
+				"user_groups/ex/g9":  nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, updates := indexDivergences(groups, tt.userGroups)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: divergências = %v, quer %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(updates, tt.wantUpdates) {
+			t.Errorf("%s: escritas = %v, quer %v", tt.name, updates, tt.wantUpdates)
+		}
+	}
+}
+
+func TestNewPushIDOrdered(t *testing.T) {
+	seen := map[string]bool{}
+	last := ""
+	for i := 0; i < 1000; i++ {
+		id := newPushID()
+		if len(id) != 20 {
+			t.Fatalf("id %q tem %d caracteres, quer 20", id, len(id))
+		}
+		if seen[id] {
+			t.Fatalf("id repetido: %q", id)
+		}
+		// O alfabeto de push está em ordem ASCII: ids gerados depois ordenam depois
+		if id <= last {
+			t.Fatalf("id %q gerado depois de %q, mas ordena antes", id, last)
+		}
+		seen[id], last = true, id
+	}
+}
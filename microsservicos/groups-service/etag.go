@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// formatETag representa a versão de um grupo, despesa ou pagamento como ETag
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// etagMatches verifica um header If-Match (ou If-None-Match) contra a versão atual.
+// Aceita "*", listas separadas por vírgula e ETags fracas (W/"...").
+func etagMatches(header string, version int64) bool {
+	current := formatETag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch garante que a requisição traga If-Match antes de alterar um
+// registro existente, respondendo 428 caso contrário.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "Header If-Match obrigatório", http.StatusPreconditionRequired)
+		return "", false
+	}
+	return ifMatch, true
+}
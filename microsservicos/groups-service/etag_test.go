@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header  string
+		version int64
+		want    bool
+	}{
+		{`"3"`, 3, true},
+		{`"3"`, 4, false},
+		{`W/"3"`, 3, true},
+		{`"1", "2" , "3"`, 3, true},
+		{`"1", "2"`, 3, false},
+		{`*`, 7, true},
+		{`3`, 3, false},
+		{``, 3, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, tt.version); got != tt.want {
+			t.Errorf("etagMatches(%q, %d) = %v, quer %v", tt.header, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	tests := []struct {
+		header     string
+		wantOk     bool
+		wantStatus int
+	}{
+		{`"2"`, true, http.StatusOK},
+		{"", false, http.StatusPreconditionRequired},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+		got, ok := requireIfMatch(w, r)
+		if ok != tt.wantOk || got != tt.header || w.Code != tt.wantStatus {
+			t.Errorf("requireIfMatch(%q) = %q, %v (status %d), quer %v (status %d)", tt.header, got, ok, w.Code, tt.wantOk, tt.wantStatus)
+		}
+	}
+}
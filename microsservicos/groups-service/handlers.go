@@ -3,22 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Group struct {
-	CreatedAt   string             `json:"createdAt"`
-	Description string             `json:"description"`
-	Expenses    map[string]Expense `json:"expenses"`
-	MemberIds   map[string]bool    `json:"memberIds"`
-	Name        string             `json:"name"`
-	OwnerId     string             `json:"ownerId"`
-	Payments    map[string]Payment `json:"payments"`
-	Id          string             `json:"id"`
+	CreatedAt   string                      `json:"createdAt"`
+	Description string                      `json:"description"`
+	Expenses    map[string]Expense          `json:"expenses"`
+	MemberIds   map[string]bool             `json:"memberIds"`
+	Name        string                      `json:"name"`
+	OwnerId     string                      `json:"ownerId"`
+	Payments    map[string]Payment          `json:"payments"`
+	Id          string                      `json:"id"`
+	Version     int64                       `json:"version"`
+	Budgets     map[string]Budget           `json:"budgets,omitempty"`
+	Categories  map[string]Category         `json:"categories,omitempty"`
+	Rules       map[string]CategoryRule     `json:"rules,omitempty"`
+	Recurring   map[string]RecurringExpense `json:"recurring,omitempty"`
+	// Papel de cada membro que não é um membro comum (ex. "treasurer")
+	Roles map[string]string `json:"roles,omitempty"`
 }
 
 type Expense struct {
@@ -29,20 +39,60 @@ type Expense struct {
 	Id          string  `json:"id"`
 	PayerId     string  `json:"payerId"`
 	Value       float64 `json:"value"`
+	Version     int64   `json:"version"`
+	DeletedAt   string  `json:"deletedAt,omitempty"`
+	DeletedBy   string  `json:"deletedBy,omitempty"`
+	// Vazio quando um membro escolheu a categoria; "rule:{id}" ou "classifier"
+	// quando foi atribuída automaticamente
+	CategorySource string `json:"categorySource,omitempty"`
+	// Pesos da divisão por membro; vazio divide igualmente entre todos os membros
+	Split map[string]float64 `json:"split,omitempty"`
+	// Modelo que lançou a despesa, se ela for uma ocorrência de uma recorrência
+	RecurringId string `json:"recurringId,omitempty"`
+	// Quem lançou a despesa, quando não foi o próprio pagador
+	RecordedBy string `json:"recordedBy,omitempty"`
+	// Preenchidos quando o pagador contesta uma despesa lançada em seu nome
+	ContestedAt   string `json:"contestedAt,omitempty"`
+	ContestReason string `json:"contestReason,omitempty"`
+	// Quanto cada um pagou, quando a conta foi paga por mais de uma pessoa; soma
+	// Value e inclui PayerId, o pagador principal. Vazio: PayerId pagou tudo.
+	Payers map[string]float64 `json:"payers,omitempty"`
+	// Itens do recibo, quando a divisão foi calculada por item
+	Receipt *Receipt `json:"receipt,omitempty"`
+	// Arquivos anexados (fotos do recibo, notas fiscais), por id
+	Attachments map[string]Attachment `json:"attachments,omitempty"`
 }
 
 type Payment struct {
-	Date     string  `json:"date"`
-	GroupId  string  `json:"groupId"`
-	Id       string  `json:"id"`
-	PayerId  string  `json:"payerId"`
-	TargetId string  `json:"targetId"`
-	Value    float64 `json:"value"`
+	Date      string  `json:"date"`
+	GroupId   string  `json:"groupId"`
+	Id        string  `json:"id"`
+	PayerId   string  `json:"payerId"`
+	TargetId  string  `json:"targetId"`
+	Value     float64 `json:"value"`
+	Version   int64   `json:"version"`
+	DeletedAt string  `json:"deletedAt,omitempty"`
+	DeletedBy string  `json:"deletedBy,omitempty"`
+	// Acerto entre grupos do qual o pagamento faz parte, se houver
+	SettlementId string `json:"settlementId,omitempty"`
+	// pending, confirmed, disputed ou cancelled; vazio (pagamentos antigos) vale confirmed
+	Status        string `json:"status,omitempty"`
+	StatusAt      string `json:"statusAt,omitempty"`
+	StatusBy      string `json:"statusBy,omitempty"`
+	DisputeReason string `json:"disputeReason,omitempty"`
+	// Quem lançou o pagamento, quando não foi o próprio pagador
+	RecordedBy string `json:"recordedBy,omitempty"`
+	// Compensação de um acerto entre grupos: quita a dívida sem transferência
+	Compensation bool `json:"compensation,omitempty"`
 }
 
 type PaymentRequest struct {
 	TargetId string  `json:"targetId"`
 	Value    float64 `json:"value"`
+	// Opcional: quem pagou. Além do próprio pagador, podem registrar quem
+	// recebeu e tesoureiros do grupo.
+	PayerId      string `json:"payerId,omitempty"`
+	SettlementId string `json:"settlementId,omitempty"`
 }
 
 type GroupRequest struct {
@@ -50,9 +100,18 @@ type GroupRequest struct {
 }
 
 type ExpenseRequest struct {
-	Category    string  `json:"category"`
-	Description string  `json:"description"`
-	Value       float64 `json:"value"`
+	Category    string             `json:"category"`
+	Description string             `json:"description"`
+	Value       float64            `json:"value"`
+	Split       map[string]float64 `json:"split"`
+	// Opcional, só na criação: tesoureiros lançam em nome de outro membro
+	PayerId string `json:"payerId"`
+	// Opcional: quanto cada um pagou. Na edição, ausente mantém os pagadores
+	// atuais e {} volta a ter só o pagador principal.
+	Payers map[string]float64 `json:"payers"`
+	// Opcional: com itens, calcula a divisão (e o valor, se value vier 0). Na
+	// edição, ausente mantém o recibo atual e sem itens o remove.
+	Receipt *Receipt `json:"receipt"`
 }
 
 func (app *AppConfig) handleGetMyGroups(w http.ResponseWriter, r *http.Request) {
@@ -71,7 +130,7 @@ func (app *AppConfig) handleGetMyGroups(w http.ResponseWriter, r *http.Request)
 	for groupId, isActive := range userGroupsMap {
 		if isActive {
 			if group, err := app.getGroup(r.Context(), groupId); err == nil {
-				groups = append(groups, *group)
+				groups = append(groups, *group.withoutDeleted())
 			}
 		}
 	}
@@ -79,6 +138,30 @@ func (app *AppConfig) handleGetMyGroups(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(groups)
 }
 
+// handleGetMyGroupIds lista apenas os ids dos grupos do usuário, para quem
+// prefere buscar (e cachear) cada grupo separadamente
+func (app *AppConfig) handleGetMyGroupIds(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var userGroupsMap map[string]bool
+	if err := app.DBClient.NewRef("user_groups/"+uid).Get(r.Context(), &userGroupsMap); err != nil {
+		http.Error(w, "Erro ao buscar grupos", http.StatusInternalServerError)
+		return
+	}
+	ids := make([]string, 0, len(userGroupsMap))
+	for groupId, isActive := range userGroupsMap {
+		if isActive {
+			ids = append(ids, groupId)
+		}
+	}
+	sort.Strings(ids)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ids)
+}
+
 func (app *AppConfig) handleGetGroup(w http.ResponseWriter, r *http.Request) {
 	uid, ok := r.Context().Value(userUIDKey).(string)
 	if !ok {
@@ -89,13 +172,79 @@ func (app *AppConfig) handleGetGroup(w http.ResponseWriter, r *http.Request) {
 	group, err := app.getGroup(r.Context(), groupUID)
 	if err != nil {
 		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	if at := r.URL.Query().Get("at"); at != "" {
+		app.handleGetGroupAt(w, r, groupUID, at)
+		return
+	}
+	w.Header().Set("ETag", formatETag(group.Version))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, group.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// includeDeleted=true traz também os itens na lixeira, como o ledger os
+	// vê; é o que o serviço de análise usa para seguir os eventos depois
+	if r.URL.Query().Get("includeDeleted") == "true" {
+		json.NewEncoder(w).Encode(group)
+		return
+	}
+	json.NewEncoder(w).Encode(group.withoutDeleted())
+}
+
+func (app *AppConfig) handleGetExpense(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	expense, exists := group.Expenses[chi.URLParam(r, "expenseId")]
+	if !exists || expense.DeletedAt != "" {
+		http.Error(w, "Despesa não encontrada", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(expense.Version))
+	json.NewEncoder(w).Encode(expense)
+}
+
+func (app *AppConfig) handleGetPayment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
 	}
 	if !group.MemberIds[uid] {
 		http.Error(w, "Nao autorizado", http.StatusForbidden)
 		return
 	}
+	payment, exists := group.Payments[chi.URLParam(r, "paymentId")]
+	if !exists || payment.DeletedAt != "" {
+		http.Error(w, "Pagamento não encontrado", http.StatusNotFound)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(group)
+	w.Header().Set("ETag", formatETag(payment.Version))
+	json.NewEncoder(w).Encode(payment)
 }
 
 func (app *AppConfig) getGroup(ctx context.Context, uid string) (*Group, error) {
@@ -107,7 +256,7 @@ func (app *AppConfig) getGroup(ctx context.Context, uid string) (*Group, error)
 	}
 	if group.OwnerId == "" {
 		fmt.Printf("grupo %s nao encontrado\n", uid)
-		return nil, fmt.Errorf("grupo não encontrado")
+		return nil, errGroupNotFound
 	}
 	return &group, nil
 }
@@ -123,15 +272,8 @@ func (app *AppConfig) handlePostGroup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "JSON inválido", http.StatusBadRequest)
 		return
 	}
-	groupsRef := app.DBClient.NewRef("groups")
-	newGroupRef, err := groupsRef.Push(r.Context(), nil)
-	if err != nil {
-		http.Error(w, "Erro ao criar grupo", http.StatusInternalServerError)
-		return
-	}
-	groupUID := newGroupRef.Key
-	groupRef := app.DBClient.NewRef("groups/" + groupUID)
-	groupData := Group{
+	groupUID := newPushID()
+	e, err := newEvent(eventGroupCreated, groupPayload{Group: Group{
 		CreatedAt:   time.Now().UTC().Format(time.RFC3339Nano),
 		Description: "",
 		Expenses:    map[string]Expense{},
@@ -140,19 +282,31 @@ func (app *AppConfig) handlePostGroup(w http.ResponseWriter, r *http.Request) {
 		OwnerId:     uid,
 		Payments:    map[string]Payment{},
 		Id:          groupUID,
+	}})
+	if err != nil {
+		http.Error(w, "Erro ao criar grupo", http.StatusInternalServerError)
+		return
 	}
-	if err = groupRef.Set(r.Context(), groupData); err != nil {
+	e.Seq, e.GroupId, e.ActorId, e.At = 1, groupUID, uid, nowMillis()
+	groupData := &Group{}
+	activity, err := groupData.applyWithActivity(e)
+	if err != nil {
 		http.Error(w, "Erro ao criar grupo", http.StatusInternalServerError)
 		return
 	}
-	userGroupsRef := app.DBClient.NewRef("user_groups/" + uid)
-	if err = userGroupsRef.Update(r.Context(), map[string]any{
-		groupUID: true,
+	// Grupo novo: ledger, projeção e índices podem ser gravados de uma só vez
+	if err := app.multiUpdate(r.Context(), map[string]any{
+		e.path():                              e,
+		"groups/" + groupUID:                  groupData,
+		"user_groups/" + uid + "/" + groupUID: true,
+		activity.path():                       activity,
 	}); err != nil {
 		http.Error(w, "Erro ao criar grupo", http.StatusInternalServerError)
 		return
 	}
+	app.publishEvent(e)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(groupData.Version))
 	json.NewEncoder(w).Encode(groupData)
 }
 
@@ -163,14 +317,16 @@ func (app *AppConfig) handleJoinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	groupUID := chi.URLParam(r, "uid")
-	userGroupsRef := app.DBClient.NewRef("user_groups/" + uid)
-	userGroupsRef.Update(r.Context(), map[string]any{
-		groupUID: true,
-	})
-	groupMembersRef := app.DBClient.NewRef("groups/" + groupUID + "/memberIds")
-	groupMembersRef.Update(r.Context(), map[string]any{
-		uid: true,
+	_, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		if g.MemberIds[uid] {
+			return Event{}, errNoChanges
+		}
+		return newEvent(eventMemberJoined, memberPayload{UserId: uid})
 	})
+	if err != nil && !errors.Is(err, errNoChanges) {
+		writeGroupError(w, err, "Erro ao entrar no grupo")
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(true)
 }
@@ -187,28 +343,129 @@ func (app *AppConfig) handlePostExpense(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	groupUID := chi.URLParam(r, "uid")
-	expensesRef := app.DBClient.NewRef("groups/" + groupUID + "/expenses")
-	newExpenseRef, err := expensesRef.Push(r.Context(), nil)
+	ifMatch := r.Header.Get("If-Match")
+	expenseUID := newPushID()
+	payerId := mainPayer(uid, req.PayerId, req.Payers)
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		if !g.MemberIds[uid] {
+			return Event{}, errNotAuthorized
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, g.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		expense := Expense{
+			Date:        float64(time.Now().UnixMilli()),
+			Description: req.Description,
+			GroupId:     groupUID,
+			Id:          expenseUID,
+			PayerId:     payerId,
+			Value:       req.Value,
+			Split:       req.Split,
+			Payers:      req.Payers,
+		}
+		if err := g.addExpense(&expense, uid, req); err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventExpenseAdded, expensePayload{Expense: expense})
+	})
 	if err != nil {
-		http.Error(w, "Erro ao criar despesa", http.StatusInternalServerError)
+		writeGroupError(w, err, "Erro ao criar despesa")
+		return
+	}
+	expenseData := group.Expenses[expenseUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(expenseData.Version))
+	json.NewEncoder(w).Encode(expenseData)
+}
+
+// addExpense completa uma despesa nova lançada por uid (recibo, pagadores,
+// categoria) e a confere contra o estado atual do grupo
+func (g *Group) addExpense(expense *Expense, uid string, req ExpenseRequest) error {
+	if req.Receipt != nil {
+		if err := g.itemize(expense, *req.Receipt, req.Split != nil); err != nil {
+			return err
+		}
+	}
+	if err := g.validateExpense(*expense, req.Category); err != nil {
+		return err
+	}
+	expense.Payers = compactPayers(expense.Payers)
+	if err := g.recordOnBehalf(expense, uid); err != nil {
+		return err
+	}
+	g.categorize(expense, req.Category)
+	return nil
+}
+
+func (app *AppConfig) handleEditExpense(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
 		return
 	}
-	expenseUID := newExpenseRef.Key
-	expenseRef := app.DBClient.NewRef("groups/" + groupUID + "/expenses/" + expenseUID)
-	expenseData := Expense{
-		Category:    req.Category,
-		Date:        float64(time.Now().UnixMilli()),
-		Description: req.Description,
-		GroupId:     groupUID,
-		Id:          expenseUID,
-		PayerId:     uid,
-		Value:       req.Value,
+	var req ExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
 	}
-	if err = expenseRef.Set(r.Context(), expenseData); err != nil {
-		http.Error(w, "Erro ao criar despesa", http.StatusInternalServerError)
+	groupUID := chi.URLParam(r, "uid")
+	expenseUID := chi.URLParam(r, "expenseId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
 		return
 	}
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if !expenseData.managedBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		paidBefore := expenseData.paidBy()
+		expenseData.Description = req.Description
+		expenseData.Value = req.Value
+		// Sem "split" no corpo a divisão atual é mantida; {} volta à divisão igual
+		if req.Split != nil {
+			expenseData.Split = req.Split
+		}
+		if req.Payers != nil {
+			expenseData.Payers = req.Payers
+		}
+		receipt := req.Receipt
+		if receipt == nil {
+			receipt = expenseData.Receipt
+		}
+		if receipt != nil {
+			if err := g.itemize(&expenseData, *receipt, req.Split != nil); err != nil {
+				return Event{}, err
+			}
+		}
+		if err := g.validateExpense(expenseData, req.Category); err != nil {
+			return Event{}, err
+		}
+		expenseData.Payers = compactPayers(expenseData.Payers)
+		// Mudar quem pagou quanto vale como um novo lançamento em nome dos outros
+		if !maps.Equal(paidBefore, expenseData.paidBy()) {
+			if err := g.recordOnBehalf(&expenseData, uid); err != nil {
+				return Event{}, err
+			}
+		}
+		// Editar resolve a contestação
+		expenseData.ContestedAt, expenseData.ContestReason = "", ""
+		g.categorize(&expenseData, req.Category)
+		return newEvent(eventExpenseEdited, expensePayload{Expense: expenseData})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao editar despesa")
+		return
+	}
+	expenseData := group.Expenses[expenseUID]
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(expenseData.Version))
 	json.NewEncoder(w).Encode(expenseData)
 }
 
@@ -224,20 +481,29 @@ func (app *AppConfig) handleDeleteExpense(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Parâmetros inválidos", http.StatusBadRequest)
 		return
 	}
-	path := "groups/" + groupUID + "/expenses/" + expenseUID
-	expenseRef := app.DBClient.NewRef(path)
-	var expenseData Expense
-	err := expenseRef.Get(r.Context(), &expenseData)
-	if err != nil {
-		http.Error(w, "Erro ao procurar despesa", http.StatusInternalServerError)
-		return
-	}
-	if uid != expenseData.PayerId {
-		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
 		return
 	}
-	if err := expenseRef.Delete(r.Context()); err != nil {
-		http.Error(w, "Erro ao deletar despesa", http.StatusInternalServerError)
+	_, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if !expenseData.managedBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventExpenseDeleted, deletionPayload{
+			Id:        expenseUID,
+			DeletedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			DeletedBy: uid,
+		})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao deletar despesa")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -254,28 +520,52 @@ func (app *AppConfig) handlePostPayment(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "JSON inválido", http.StatusBadRequest)
 		return
 	}
+	payerId := uid
+	if req.PayerId != "" {
+		payerId = req.PayerId
+	}
 	groupUID := chi.URLParam(r, "uid")
-	paymentsRef := app.DBClient.NewRef("groups/" + groupUID + "/payments")
-	newPaymentRef, err := paymentsRef.Push(r.Context(), nil)
+	ifMatch := r.Header.Get("If-Match")
+	paymentUID := newPushID()
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		// Quem recebeu pode registrar o pagamento em nome do pagador (confirma o
+		// recebimento); tesoureiros podem registrar entre quaisquer membros
+		if !g.MemberIds[uid] || (payerId != uid && req.TargetId != uid && !g.canAdminister(uid)) {
+			return Event{}, errNotAuthorized
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, g.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if err := g.validatePayment(payerId, req); err != nil {
+			return Event{}, err
+		}
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		payment := Payment{
+			Date:         now,
+			GroupId:      groupUID,
+			Id:           paymentUID,
+			PayerId:      payerId,
+			TargetId:     req.TargetId,
+			Value:        req.Value,
+			SettlementId: req.SettlementId,
+			Status:       paymentPending,
+		}
+		if payerId != uid {
+			payment.RecordedBy = uid
+		}
+		// Registrado por quem recebeu: o recebimento já está confirmado
+		if uid == req.TargetId {
+			payment.Status, payment.StatusAt, payment.StatusBy = paymentConfirmed, now, uid
+		}
+		return newEvent(eventPaymentRecorded, paymentPayload{Payment: payment})
+	})
 	if err != nil {
-		http.Error(w, "Erro ao criar pagamento", http.StatusInternalServerError)
-		return
-	}
-	paymentUID := newPaymentRef.Key
-	paymentRef := app.DBClient.NewRef("groups/" + groupUID + "/payments/" + paymentUID)
-	paymentData := Payment{
-		Date:     time.Now().UTC().Format(time.RFC3339Nano),
-		GroupId:  groupUID,
-		Id:       paymentUID,
-		PayerId:  uid,
-		TargetId: req.TargetId,
-		Value:    req.Value,
-	}
-	if err = paymentRef.Set(r.Context(), paymentData); err != nil {
-		http.Error(w, "Erro ao criar pagamento", http.StatusInternalServerError)
+		writeGroupError(w, err, "Erro ao criar pagamento")
 		return
 	}
+	paymentData := group.Payments[paymentUID]
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(paymentData.Version))
 	json.NewEncoder(w).Encode(paymentData)
 }
 
@@ -291,20 +581,29 @@ func (app *AppConfig) handleDeletePayment(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Parâmetros inválidos", http.StatusBadRequest)
 		return
 	}
-	path := "groups/" + groupUID + "/payments/" + paymentUID
-	paymentRef := app.DBClient.NewRef(path)
-	var paymentData Payment
-	err := paymentRef.Get(r.Context(), &paymentData)
-	if err != nil {
-		http.Error(w, "Erro ao procurar pagamento", http.StatusInternalServerError)
-		return
-	}
-	if uid != paymentData.PayerId {
-		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
 		return
 	}
-	if err := paymentRef.Delete(r.Context()); err != nil {
-		http.Error(w, "Erro ao deletar pagamento", http.StatusInternalServerError)
+	_, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		paymentData, exists := g.Payments[paymentUID]
+		if !exists || paymentData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if !paymentData.managedBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, paymentData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventPaymentDeleted, deletionPayload{
+			Id:        paymentUID,
+			DeletedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			DeletedBy: uid,
+		})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao deletar pagamento")
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
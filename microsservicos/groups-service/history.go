@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultEventsPageSize = 100
+	maxEventsPageSize     = 500
+)
+
+type EventsPage struct {
+	Events []Event `json:"events"`
+	// Sequência a ser usada em "after" para buscar a próxima página
+	NextAfter int64 `json:"nextAfter,omitempty"`
+}
+
+// parseInstant aceita milissegundos desde a época, RFC3339 ou uma data
+// (YYYY-MM-DD, interpretada como o fim do dia em UTC) e devolve milissegundos.
+func parseInstant(raw string) (int64, bool) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return ms, true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t.UnixMilli(), true
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t.Add(24*time.Hour).UnixMilli() - 1, true
+	}
+	return 0, false
+}
+
+// handleGetGroupAt reconstrói o grupo como ele estava no instante "at",
+// reaplicando o ledger. Chamado por handleGetGroup quando ?at= é informado.
+func (app *AppConfig) handleGetGroupAt(w http.ResponseWriter, r *http.Request, groupUID string, rawAt string) {
+	at, ok := parseInstant(rawAt)
+	if !ok {
+		http.Error(w, "Parâmetro at inválido", http.StatusBadRequest)
+		return
+	}
+	events, err := app.eventsAfter(r.Context(), groupUID, 0, 0)
+	if err != nil {
+		http.Error(w, "Erro ao buscar histórico", http.StatusInternalServerError)
+		return
+	}
+	if len(events) > 0 && events[0].Type == eventGroupCreated && events[0].At > at {
+		http.Error(w, "O grupo ainda não existia nesta data", http.StatusNotFound)
+		return
+	}
+	if len(events) == 0 || events[0].At > at {
+		// Grupos importados só têm histórico a partir da importação
+		http.Error(w, "Histórico indisponível para esta data", http.StatusUnprocessableEntity)
+		return
+	}
+	group, err := replay(events, at)
+	if err != nil {
+		http.Error(w, "Erro ao reconstruir grupo", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(group.Version))
+	json.NewEncoder(w).Encode(group.withoutDeleted())
+}
+
+// handleGetEvents lista os eventos do ledger em ordem, a partir da sequência "after"
+func (app *AppConfig) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	var after int64
+	if raw := query.Get("after"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Parâmetro after inválido", http.StatusBadRequest)
+			return
+		}
+		after = parsed
+	}
+	limit := defaultEventsPageSize
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Parâmetro limit inválido", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxEventsPageSize)
+	}
+
+	events, err := app.eventsAfter(r.Context(), groupUID, after, limit+1)
+	if err != nil {
+		http.Error(w, "Erro ao buscar eventos", http.StatusInternalServerError)
+		return
+	}
+	page := EventsPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextAfter = events[limit-1].Seq
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
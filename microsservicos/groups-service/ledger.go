@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"firebase.google.com/go/v4/db"
+)
+
+// Tipos de evento do ledger. O ledger em group_events/{groupId} é a fonte da
+// verdade; o documento em groups/{groupId} é apenas uma projeção dele.
+const (
+	eventGroupCreated        = "GroupCreated"
+	eventGroupImported       = "GroupImported"
+	eventMemberJoined        = "MemberJoined"
+	eventMemberRoleSet       = "MemberRoleSet"
+	eventExpenseAdded        = "ExpenseAdded"
+	eventExpenseEdited       = "ExpenseEdited"
+	eventExpenseDeleted      = "ExpenseDeleted"
+	eventExpenseRestored     = "ExpenseRestored"
+	eventExpenseContested    = "ExpenseContested"
+	eventAttachmentAdded     = "AttachmentAdded"
+	eventAttachmentRemoved   = "AttachmentRemoved"
+	eventPaymentRecorded     = "PaymentRecorded"
+	eventPaymentDeleted      = "PaymentDeleted"
+	eventPaymentRestored     = "PaymentRestored"
+	eventPaymentConfirmed    = "PaymentConfirmed"
+	eventPaymentDisputed     = "PaymentDisputed"
+	eventPaymentCancelled    = "PaymentCancelled"
+	eventSettlementRecorded  = "SettlementRecorded"
+	eventTrashPurged         = "TrashPurged"
+	eventBudgetSet           = "BudgetSet"
+	eventBudgetRemoved       = "BudgetRemoved"
+	eventCategorySet         = "CategorySet"
+	eventCategoryRemoved     = "CategoryRemoved"
+	eventCategoriesMerged    = "CategoriesMerged"
+	eventRuleSet             = "RuleSet"
+	eventRuleRemoved         = "RuleRemoved"
+	eventExpensesCategorized = "ExpensesCategorized"
+	eventRecurringSet        = "RecurringSet"
+	eventRecurringRemoved    = "RecurringRemoved"
+	eventRecurringOccurred   = "RecurringOccurred"
+)
+
+var errLedgerConflict = errors.New("outro evento foi gravado na mesma posição do ledger")
+
+// Event é um fato imutável sobre um grupo. Seq é contínua (grupos importados
+// começam na versão que já tinham) e, depois de aplicar o evento N, a projeção
+// fica com Version == N.
+type Event struct {
+	Seq     int64           `json:"seq"`
+	Type    string          `json:"type"`
+	GroupId string          `json:"groupId"`
+	ActorId string          `json:"actorId"`
+	At      int64           `json:"at"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type groupPayload struct {
+	Group Group `json:"group"`
+}
+
+type memberPayload struct {
+	UserId string `json:"userId"`
+}
+
+type expensePayload struct {
+	Expense Expense `json:"expense"`
+}
+
+type paymentPayload struct {
+	Payment Payment `json:"payment"`
+}
+
+// deletionPayload é usado na exclusão e, com os campos de exclusão vazios, na restauração
+type deletionPayload struct {
+	Id        string `json:"id"`
+	DeletedAt string `json:"deletedAt"`
+	DeletedBy string `json:"deletedBy"`
+}
+
+type contestPayload struct {
+	Id     string `json:"id"`
+	At     string `json:"at"`
+	Reason string `json:"reason"`
+}
+
+type attachmentPayload struct {
+	ExpenseId  string     `json:"expenseId"`
+	Attachment Attachment `json:"attachment"`
+}
+
+type attachmentRemovalPayload struct {
+	ExpenseId string `json:"expenseId"`
+	Id        string `json:"id"`
+}
+
+// paymentStatusPayload registra a resposta a um pagamento pendente; o novo
+// status vem do tipo do evento
+type paymentStatusPayload struct {
+	Id     string `json:"id"`
+	At     string `json:"at"`
+	By     string `json:"by"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type budgetPayload struct {
+	Budget Budget `json:"budget"`
+}
+
+// categoryPayload traz o nome anterior quando a categoria foi renomeada
+type categoryPayload struct {
+	Category     Category `json:"category"`
+	PreviousName string   `json:"previousName,omitempty"`
+}
+
+// mergePayload lista os nomes normalizados reescritos para a categoria de
+// destino e as categorias gerenciadas removidas
+type mergePayload struct {
+	TargetId  string   `json:"targetId"`
+	SourceIds []string `json:"sourceIds,omitempty"`
+	Names     []string `json:"names"`
+}
+
+type rulePayload struct {
+	Rule CategoryRule `json:"rule"`
+}
+
+type categorizedExpense struct {
+	Id       string `json:"id"`
+	Category string `json:"category"`
+	Source   string `json:"source"`
+}
+
+type categorizedPayload struct {
+	Changes []categorizedExpense `json:"changes"`
+}
+
+// purgePayload lista os itens que a limpeza da lixeira tira da projeção; os
+// eventos que os criaram continuam no ledger
+type purgePayload struct {
+	ExpenseIds []string `json:"expenseIds,omitempty"`
+	PaymentIds []string `json:"paymentIds,omitempty"`
+}
+
+// newEvent monta um evento com o payload serializado. Seq, grupo, autor e horário
+// são preenchidos por execute no momento da gravação.
+func newEvent(eventType string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: eventType, Data: data}, nil
+}
+
+func (e Event) decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// seqKey formata a sequência com zeros à esquerda para manter a ordem das chaves
+func seqKey(seq int64) string {
+	return fmt.Sprintf("%012d", seq)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+func (e Event) path() string {
+	return "group_events/" + e.GroupId + "/" + seqKey(e.Seq)
+}
+
+// clone faz uma cópia profunda do grupo
+func (g *Group) clone() *Group {
+	var copied Group
+	data, _ := json.Marshal(g)
+	json.Unmarshal(data, &copied)
+	copied.ensureMaps()
+	return &copied
+}
+
+func (g *Group) ensureMaps() {
+	if g.MemberIds == nil {
+		g.MemberIds = map[string]bool{}
+	}
+	if g.Expenses == nil {
+		g.Expenses = map[string]Expense{}
+	}
+	if g.Payments == nil {
+		g.Payments = map[string]Payment{}
+	}
+	if g.Budgets == nil {
+		g.Budgets = map[string]Budget{}
+	}
+	if g.Categories == nil {
+		g.Categories = map[string]Category{}
+	}
+	if g.Rules == nil {
+		g.Rules = map[string]CategoryRule{}
+	}
+	if g.Recurring == nil {
+		g.Recurring = map[string]RecurringExpense{}
+	}
+	if g.Roles == nil {
+		g.Roles = map[string]string{}
+	}
+}
+
+// apply projeta um evento sobre o grupo. Deve ser determinística: tudo o que
+// depende de horário ou de ids gerados vem no próprio evento.
+func (g *Group) apply(e Event) error {
+	g.ensureMaps()
+	switch e.Type {
+	case eventGroupCreated, eventGroupImported:
+		var p groupPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		*g = p.Group
+		g.ensureMaps()
+	case eventMemberJoined:
+		var p memberPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		g.MemberIds[p.UserId] = true
+	case eventMemberRoleSet:
+		var p roleAssignment
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if p.Role == roleMember {
+			delete(g.Roles, p.UserId)
+		} else {
+			g.Roles[p.UserId] = p.Role
+		}
+	case eventExpenseAdded:
+		var p expensePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if _, exists := g.Expenses[p.Expense.Id]; exists {
+			return fmt.Errorf("despesa %s já existe", p.Expense.Id)
+		}
+		p.Expense.Version = 1
+		g.Expenses[p.Expense.Id] = p.Expense
+	case eventExpenseEdited:
+		var p expensePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		current, exists := g.Expenses[p.Expense.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		p.Expense.Version = current.Version + 1
+		g.Expenses[p.Expense.Id] = p.Expense
+	case eventExpenseDeleted, eventExpenseRestored:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		expense, exists := g.Expenses[p.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		expense.DeletedAt, expense.DeletedBy = p.DeletedAt, p.DeletedBy
+		expense.Version++
+		g.Expenses[p.Id] = expense
+	case eventExpenseContested:
+		var p contestPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		expense, exists := g.Expenses[p.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		expense.ContestedAt, expense.ContestReason = p.At, p.Reason
+		expense.Version++
+		g.Expenses[p.Id] = expense
+	case eventAttachmentAdded:
+		var p attachmentPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		expense, exists := g.Expenses[p.ExpenseId]
+		if !exists {
+			return errRecordNotFound
+		}
+		if expense.Attachments == nil {
+			expense.Attachments = map[string]Attachment{}
+		}
+		expense.Attachments[p.Attachment.Id] = p.Attachment
+		expense.Version++
+		g.Expenses[p.ExpenseId] = expense
+	case eventAttachmentRemoved:
+		var p attachmentRemovalPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		expense, exists := g.Expenses[p.ExpenseId]
+		if !exists {
+			return errRecordNotFound
+		}
+		if _, exists := expense.Attachments[p.Id]; !exists {
+			return errRecordNotFound
+		}
+		delete(expense.Attachments, p.Id)
+		expense.Version++
+		g.Expenses[p.ExpenseId] = expense
+	case eventPaymentRecorded, eventSettlementRecorded:
+		var p paymentPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if _, exists := g.Payments[p.Payment.Id]; exists {
+			return fmt.Errorf("pagamento %s já existe", p.Payment.Id)
+		}
+		p.Payment.Version = 1
+		g.Payments[p.Payment.Id] = p.Payment
+	case eventPaymentDeleted, eventPaymentRestored:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		payment, exists := g.Payments[p.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		payment.DeletedAt, payment.DeletedBy = p.DeletedAt, p.DeletedBy
+		payment.Version++
+		g.Payments[p.Id] = payment
+	case eventPaymentConfirmed, eventPaymentDisputed, eventPaymentCancelled:
+		var p paymentStatusPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		payment, exists := g.Payments[p.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		payment.Status, payment.StatusAt, payment.StatusBy = paymentEventStatus[e.Type], p.At, p.By
+		payment.DisputeReason = p.Reason
+		payment.Version++
+		g.Payments[p.Id] = payment
+	case eventTrashPurged:
+		var p purgePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		for _, id := range p.ExpenseIds {
+			delete(g.Expenses, id)
+		}
+		for _, id := range p.PaymentIds {
+			delete(g.Payments, id)
+		}
+	case eventBudgetSet:
+		var p budgetPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		p.Budget.Version = g.Budgets[p.Budget.Id].Version + 1
+		g.Budgets[p.Budget.Id] = p.Budget
+	case eventBudgetRemoved:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if _, exists := g.Budgets[p.Id]; !exists {
+			return errRecordNotFound
+		}
+		delete(g.Budgets, p.Id)
+	case eventCategorySet:
+		var p categoryPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		p.Category.Version = g.Categories[p.Category.Id].Version + 1
+		g.Categories[p.Category.Id] = p.Category
+		names := map[string]bool{normalizeCategory(p.Category.Name): true}
+		if p.PreviousName != "" {
+			names[normalizeCategory(p.PreviousName)] = true
+		}
+		g.renameCategory(names, p.Category.Name)
+	case eventCategoryRemoved:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		category, exists := g.Categories[p.Id]
+		if !exists {
+			return errRecordNotFound
+		}
+		delete(g.Categories, p.Id)
+		g.reparentCategories(p.Id, category.ParentId)
+	case eventCategoriesMerged:
+		var p mergePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		target, exists := g.Categories[p.TargetId]
+		if !exists {
+			return errRecordNotFound
+		}
+		names := map[string]bool{}
+		for _, name := range p.Names {
+			names[name] = true
+		}
+		// Orçamentos da origem que colidiriam com um do destino são descartados
+		for id, b := range g.Budgets {
+			if !names[normalizeCategory(b.Category)] || b.Category == target.Name {
+				continue
+			}
+			for _, other := range g.Budgets {
+				if other.Category == target.Name && other.Period == b.Period {
+					delete(g.Budgets, id)
+					break
+				}
+			}
+		}
+		g.renameCategory(names, target.Name)
+		for _, id := range p.SourceIds {
+			delete(g.Categories, id)
+			g.reparentCategories(id, target.Id)
+		}
+	case eventRuleSet:
+		var p rulePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		p.Rule.Version = g.Rules[p.Rule.Id].Version + 1
+		g.Rules[p.Rule.Id] = p.Rule
+	case eventRuleRemoved:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if _, exists := g.Rules[p.Id]; !exists {
+			return errRecordNotFound
+		}
+		delete(g.Rules, p.Id)
+	case eventExpensesCategorized:
+		var p categorizedPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		for _, c := range p.Changes {
+			expense, exists := g.Expenses[c.Id]
+			if !exists {
+				return errRecordNotFound
+			}
+			expense.Category, expense.CategorySource = c.Category, c.Source
+			expense.Version++
+			g.Expenses[c.Id] = expense
+		}
+	case eventRecurringSet:
+		var p recurringPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		p.Recurring.Version = g.Recurring[p.Recurring.Id].Version + 1
+		g.Recurring[p.Recurring.Id] = p.Recurring
+	case eventRecurringRemoved:
+		var p deletionPayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		if _, exists := g.Recurring[p.Id]; !exists {
+			return errRecordNotFound
+		}
+		delete(g.Recurring, p.Id)
+	case eventRecurringOccurred:
+		var p occurrencePayload
+		if err := e.decode(&p); err != nil {
+			return err
+		}
+		rec, exists := g.Recurring[p.RecurringId]
+		if !exists {
+			return errRecordNotFound
+		}
+		if _, exists := g.Expenses[p.Expense.Id]; exists {
+			return fmt.Errorf("despesa %s já existe", p.Expense.Id)
+		}
+		p.Expense.Version = 1
+		g.Expenses[p.Expense.Id] = p.Expense
+		rec.LastRun = p.Date
+		rec.Version++
+		g.Recurring[p.RecurringId] = rec
+	default:
+		return fmt.Errorf("tipo de evento desconhecido: %s", e.Type)
+	}
+	g.Version = e.Seq
+	return nil
+}
+
+// appendEvent grava o evento na sua posição do ledger apenas se ela estiver
+// livre, garantindo que dois escritores nunca usem a mesma sequência.
+func (app *AppConfig) appendEvent(ctx context.Context, e Event) error {
+	return app.DBClient.NewRef(e.path()).Transaction(ctx, func(tn db.TransactionNode) (any, error) {
+		var existing *Event
+		if err := tn.Unmarshal(&existing); err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, errLedgerConflict
+		}
+		return e, nil
+	})
+}
+
+// lastEventSeq devolve a sequência do último evento do grupo, ou 0 se não houver
+func (app *AppConfig) lastEventSeq(ctx context.Context, groupId string) (int64, error) {
+	nodes, err := app.DBClient.NewRef("group_events/" + groupId).OrderByKey().LimitToLast(1).GetOrdered(ctx)
+	if err != nil || len(nodes) == 0 {
+		return 0, err
+	}
+	return strconv.ParseInt(nodes[0].Key(), 10, 64)
+}
+
+// eventsAfter lê, em ordem, os eventos com sequência maior que seq
+func (app *AppConfig) eventsAfter(ctx context.Context, groupId string, seq int64, limit int) ([]Event, error) {
+	q := app.DBClient.NewRef("group_events/" + groupId).OrderByKey().StartAt(seqKey(seq + 1))
+	if limit > 0 {
+		q = q.LimitToFirst(limit)
+	}
+	nodes, err := q.GetOrdered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(nodes))
+	for _, node := range nodes {
+		var e Event
+		if err := node.Unmarshal(&e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	created := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}, Version: 4}
+	base := func() *Group {
+		g := created.clone()
+		g.Expenses["e1"] = Expense{Id: "e1", PayerId: "ana", Value: 10, Version: 1}
+		return g
+	}
+	tests := []struct {
+		name    string
+		event   Event
+		wantErr bool
+		check   func(g *Group) bool
+	}{
+		{"membro entra", mustEvent(t, 5, eventMemberJoined, memberPayload{UserId: "bia"}), false,
+			func(g *Group) bool { return g.MemberIds["bia"] && g.Version == 5 }},
+		{"despesa nova começa na versão 1", mustEvent(t, 5, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e2", Value: 5, Version: 9}}), false,
+			func(g *Group) bool { return g.Expenses["e2"].Version == 1 }},
+		{"despesa repetida", mustEvent(t, 5, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1"}}), true, nil},
+		{"edição incrementa a versão", mustEvent(t, 5, eventExpenseEdited, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", Value: 15}}), false,
+			func(g *Group) bool { return g.Expenses["e1"].Value == 15 && g.Expenses["e1"].Version == 2 }},
+		{"exclusão de despesa inexistente", mustEvent(t, 5, eventExpenseDeleted, deletionPayload{Id: "e9"}), true, nil},
+		{"papel de tesoureiro", mustEvent(t, 5, eventMemberRoleSet, roleAssignment{UserId: "ana", Role: roleTreasurer}), false,
+			func(g *Group) bool { return g.Roles["ana"] == roleTreasurer }},
+		{"tipo desconhecido", mustEvent(t, 5, "Inventado", struct{}{}), true, nil},
+	}
+	for _, tt := range tests {
+		g := base()
+		err := g.apply(tt.event)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: erro = %v, quer erro %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.check != nil && !tt.check(g) {
+			t.Errorf("%s: grupo inesperado %+v", tt.name, g)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	created := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}}
+	events := []Event{
+		mustEvent(t, 1, eventGroupCreated, groupPayload{Group: created}),
+		mustEvent(t, 2, eventMemberJoined, memberPayload{UserId: "bia"}),
+		mustEvent(t, 3, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "bia", Value: 30}}),
+		mustEvent(t, 4, eventPaymentRecorded, paymentPayload{Payment: Payment{Id: "p1", PayerId: "ana", TargetId: "bia", Value: 15}}),
+	}
+	tests := []struct {
+		until        int64
+		wantVersion  int64
+		wantMembers  int
+		wantExpenses int
+		wantPayments int
+	}{
+		{0, 4, 2, 1, 1},
+		{events[0].At, 1, 1, 0, 0},
+		// Instante anterior ao primeiro evento: grupo vazio
+		{events[0].At - 1, 0, 0, 0, 0},
+		{events[2].At, 3, 2, 1, 0},
+	}
+	for _, tt := range tests {
+		g, err := replay(events, tt.until)
+		if err != nil {
+			t.Fatalf("replay até %d: %v", tt.until, err)
+		}
+		if g.Version != tt.wantVersion || len(g.MemberIds) != tt.wantMembers ||
+			len(g.Expenses) != tt.wantExpenses || len(g.Payments) != tt.wantPayments {
+			t.Errorf("replay até %d: versão %d, %d membros, %d despesas, %d pagamentos; quer %d, %d, %d, %d",
+				tt.until, g.Version, len(g.MemberIds), len(g.Expenses), len(g.Payments),
+				tt.wantVersion, tt.wantMembers, tt.wantExpenses, tt.wantPayments)
+		}
+	}
+	broken := append(events[:2:2], mustEvent(t, 3, eventExpenseDeleted, deletionPayload{Id: "e9"}))
+	if _, err := replay(broken, 0); err == nil {
+		t.Error("replay com evento inválido deveria falhar")
+	}
+}
+
+func TestMembershipIndexUpdates(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]bool
+		after  map[string]bool
+		want   map[string]any
+	}{
+		{"membros atuais são regravados", map[string]bool{"ana": true}, map[string]bool{"ana": true, "bia": true},
+			map[string]any{"user_groups/ana/g1": true, "user_groups/bia/g1": true}},
+		{"quem saiu é removido", map[string]bool{"ana": true, "bia": true}, map[string]bool{"ana": true, "bia": false},
+			map[string]any{"user_groups/ana/g1": true, "user_groups/bia/g1": nil}},
+		{"grupo vazio", map[string]bool{}, map[string]bool{}, map[string]any{}},
+	}
+	for _, tt := range tests {
+		got := membershipIndexUpdates(&Group{Id: "g1", MemberIds: tt.before}, &Group{Id: "g1", MemberIds: tt.after})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseInstant(t *testing.T) {
+	endOfDay := time.Date(2026, 3, 10, 23, 59, 59, 999_000_000, time.UTC).UnixMilli()
+	tests := []struct {
+		raw    string
+		want   int64
+		wantOk bool
+	}{
+		{"1700000000000", 1_700_000_000_000, true},
+		{"2026-03-10T12:00:00Z", time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).UnixMilli(), true},
+		{"2026-03-10T12:00:00-03:00", time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC).UnixMilli(), true},
+		{"2026-03-10", endOfDay, true},
+		{"10/03/2026", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseInstant(tt.raw)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseInstant(%q) = %d, %v; quer %d, %v", tt.raw, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestApplyPending(t *testing.T) {
+	stored := &Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}, Version: 2}
+	stored.ensureMaps()
+	tests := []struct {
+		name           string
+		pending        []Event
+		wantErr        bool
+		wantVersion    int64
+		wantActivities int
+	}{
+		{"nada pendente", nil, false, 2, 0},
+		{"eventos em ordem", []Event{
+			mustEvent(t, 3, eventMemberJoined, memberPayload{UserId: "bia"}),
+			mustEvent(t, 4, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "bia", Value: 30}}),
+		}, false, 4, 2},
+		{"evento inválido interrompe", []Event{
+			mustEvent(t, 3, eventExpenseDeleted, deletionPayload{Id: "e9"}),
+		}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		group, activities, err := applyPending(stored, tt.pending)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: erro = %v, quer erro %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if group.Version != tt.wantVersion || len(activities) != tt.wantActivities {
+			t.Errorf("%s: versão %d com %d atividades, quer %d com %d", tt.name, group.Version, len(activities), tt.wantVersion, tt.wantActivities)
+		}
+	}
+	if stored.Version != 2 || len(stored.MemberIds) != 1 {
+		t.Errorf("applyPending alterou a projeção lida: %+v", stored)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
@@ -14,6 +15,9 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	"google.golang.org/api/option"
+
+	"shared/bus"
+	"shared/idempotency"
 )
 
 type AppConfig struct {
@@ -21,6 +25,12 @@ type AppConfig struct {
 	DBClient   *db.Client
 	APIKey     string
 	JWTSecret  []byte
+
+	Idempotency    *idempotency.Middleware
+	TrashRetention time.Duration
+	Bus            bus.Bus
+	Notifier       Notifier
+	Blobs          BlobStore
 }
 
 func main() {
@@ -28,6 +38,12 @@ func main() {
 		log.Println("Arquivo .env não encontrado, lendo variáveis de ambiente")
 	}
 
+	// O barramento local não depende do Firebase
+	if len(os.Args) > 1 && os.Args[1] == "event-bus" {
+		runBusServerCommand(os.Args[2:])
+		return
+	}
+
 	ctx := context.Background()
 	raw := os.Getenv("FIREBASE_SERVICE_ACCOUNT_KEY")
 	if raw == "" {
@@ -58,9 +74,32 @@ func main() {
 		DBClient:   dbClient,
 		APIKey:     os.Getenv("FIREBASE_API_KEY"),
 		JWTSecret:  []byte(os.Getenv("JWT_SECRET")),
+
+		Idempotency:    newIdempotency(dbClient),
+		TrashRetention: trashRetentionFromEnv(),
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-consistency":
+			configApp.runConsistencyCommand(os.Args[2:])
+			return
+		case "rebuild-projections":
+			configApp.runRebuildCommand(os.Args[2:])
+			return
+		}
+	}
+
+	configApp.Bus = busFromEnv()
+	configApp.Notifier = notifierFromEnv()
+	configApp.Blobs = blobStoreFromEnv()
+	configApp.startTrashPurger(ctx, time.Hour)
+	configApp.startStreamTicketPurger(ctx, 10*time.Minute)
+	configApp.Idempotency.StartSweeper(ctx, time.Hour)
+	configApp.startRecurringScheduler(ctx, recurringIntervalFromEnv())
+
 	r := chi.NewRouter()
+	r.Use(redactQueryForLog)
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{
@@ -68,23 +107,71 @@ func main() {
 			"https://smart-finance-distr.vercel.app",
 		},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "If-Match", "If-None-Match", "Last-Event-ID"},
+		ExposedHeaders: []string{"ETag"},
 
 		AllowCredentials: true,
 	}))
 
 	r.Group(func(r chi.Router) {
 		r.Use(configApp.authMiddleware)
+		r.Use(configApp.idempotencyMiddleware)
 		r.Get("/api/groups", configApp.handleGetMyGroups)
+		r.Get("/api/group-ids", configApp.handleGetMyGroupIds)
 		r.Get("/api/groups/{uid}", configApp.handleGetGroup)
 		r.Post("/api/join/{uid}", configApp.handleJoinGroup)
+		r.Put("/api/groups/{uid}/members/{memberId}/role", configApp.handleSetMemberRole)
 		r.Post("/api/group", configApp.handlePostGroup)
 		r.Post("/api/groups/{uid}/expenses", configApp.handlePostExpense)
+		r.Get("/api/groups/{uid}/expenses/{expenseId}", configApp.handleGetExpense)
+		r.Put("/api/groups/{uid}/expenses/{expenseId}", configApp.handleEditExpense)
+		r.Post("/api/groups/{uid}/expenses/{expenseId}/restore", configApp.handleRestoreExpense)
+		r.Post("/api/groups/{uid}/expenses/{expenseId}/contest", configApp.handleContestExpense)
 		r.Delete("/api/groups/{uid}/expenses/{expenseId}", configApp.handleDeleteExpense)
+		r.Post("/api/groups/{uid}/expenses/{expenseId}/attachments", configApp.handlePostAttachment)
+		r.Get("/api/groups/{uid}/expenses/{expenseId}/attachments/{attachmentId}", configApp.handleGetAttachment)
+		r.Delete("/api/groups/{uid}/expenses/{expenseId}/attachments/{attachmentId}", configApp.handleDeleteAttachment)
 		r.Post("/api/groups/{uid}/payments", configApp.handlePostPayment)
+		r.Post("/api/settlements", configApp.handlePostSettlement)
+		r.Get("/api/groups/{uid}/payments/{paymentId}", configApp.handleGetPayment)
+		r.Post("/api/groups/{uid}/payments/{paymentId}/restore", configApp.handleRestorePayment)
+		r.Post("/api/groups/{uid}/payments/{paymentId}/confirm", configApp.handleConfirmPayment)
+		r.Post("/api/groups/{uid}/payments/{paymentId}/dispute", configApp.handleDisputePayment)
+		r.Post("/api/groups/{uid}/payments/{paymentId}/cancel", configApp.handleCancelPayment)
 		r.Delete("/api/groups/{uid}/payments/{paymentId}", configApp.handleDeletePayment)
+		r.Get("/api/groups/{uid}/trash", configApp.handleGetTrash)
+		r.Get("/api/groups/{uid}/activity", configApp.handleGetActivity)
+		r.Get("/api/groups/{uid}/events", configApp.handleGetEvents)
+		r.Get("/api/groups/{uid}/budgets", configApp.handleGetBudgets)
+		r.Post("/api/groups/{uid}/budgets", configApp.handlePostBudget)
+		r.Put("/api/groups/{uid}/budgets/{budgetId}", configApp.handlePutBudget)
+		r.Delete("/api/groups/{uid}/budgets/{budgetId}", configApp.handleDeleteBudget)
+		r.Get("/api/groups/{uid}/categories", configApp.handleGetCategories)
+		r.Post("/api/groups/{uid}/categories", configApp.handlePostCategory)
+		r.Post("/api/groups/{uid}/categories/merge", configApp.handleMergeCategories)
+		r.Put("/api/groups/{uid}/categories/{categoryId}", configApp.handlePutCategory)
+		r.Delete("/api/groups/{uid}/categories/{categoryId}", configApp.handleDeleteCategory)
+		r.Get("/api/groups/{uid}/rules", configApp.handleGetRules)
+		r.Post("/api/groups/{uid}/rules", configApp.handlePostRule)
+		r.Put("/api/groups/{uid}/rules/{ruleId}", configApp.handlePutRule)
+		r.Delete("/api/groups/{uid}/rules/{ruleId}", configApp.handleDeleteRule)
+		r.Post("/api/groups/{uid}/categorize", configApp.handleCategorize)
+		r.Post("/api/groups/{uid}/categorize/suggest", configApp.handleSuggestCategory)
+		r.Get("/api/groups/{uid}/recurring", configApp.handleGetRecurring)
+		r.Post("/api/groups/{uid}/recurring", configApp.handlePostRecurring)
+		r.Put("/api/groups/{uid}/recurring/{recurringId}", configApp.handlePutRecurring)
+		r.Delete("/api/groups/{uid}/recurring/{recurringId}", configApp.handleDeleteRecurring)
+		r.Post("/api/groups/{uid}/recurring/{recurringId}/pause", configApp.handlePauseRecurring)
+		r.Post("/api/groups/{uid}/recurring/{recurringId}/resume", configApp.handleResumeRecurring)
+		r.Post("/api/groups/{uid}/recurring/{recurringId}/skip", configApp.handleSkipOccurrence)
 	})
 
+	// EventSource não envia headers: o navegador troca o JWT por um ticket de uso
+	// único e o envia em ?ticket=. O ticket fica fora da idempotência para não
+	// ser guardado nem repetido.
+	r.With(configApp.authMiddleware).Post("/api/groups/{uid}/stream/ticket", configApp.handlePostStreamTicket)
+	r.With(configApp.streamAuth).Get("/api/groups/{uid}/stream", configApp.handleStreamGroup)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// BudgetAlert é enviado quando o gasto de uma categoria atinge um limite de
+// alerta do orçamento (Threshold, fração do limite) no período atual
+type BudgetAlert struct {
+	GroupId     string  `json:"groupId"`
+	GroupName   string  `json:"groupName"`
+	BudgetId    string  `json:"budgetId"`
+	Category    string  `json:"category"`
+	Period      string  `json:"period"`
+	PeriodStart string  `json:"periodStart"` // YYYY-MM-DD
+	Limit       float64 `json:"limit"`
+	Spent       float64 `json:"spent"`
+	Threshold   float64 `json:"threshold"`
+	At          int64   `json:"at"`
+}
+
+// Notifier entrega alertas e avisos para fora do serviço
+type Notifier interface {
+	Notify(ctx context.Context, alert BudgetAlert) error
+	NotifyOnBehalf(ctx context.Context, notice OnBehalfNotice) error
+}
+
+// notifierFromEnv usa BUDGET_WEBHOOK_URL, se definida; sem ela os alertas só
+// vão para o log. Avisos de lançamento em nome de outro membro vão para o mesmo
+// webhook e se distinguem pelo campo kind.
+func notifierFromEnv() Notifier {
+	if url := os.Getenv("BUDGET_WEBHOOK_URL"); url != "" {
+		return &webhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return logNotifier{}
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, a BudgetAlert) error {
+	log.Printf("Orçamento %q do grupo %s atingiu %.0f%% (%.2f de %.2f)", a.Category, a.GroupId, a.Threshold*100, a.Spent, a.Limit)
+	return nil
+}
+
+func (logNotifier) NotifyOnBehalf(_ context.Context, n OnBehalfNotice) error {
+	log.Printf("Grupo %s: %s %s de %.2f registrado por %s em nome de %s", n.GroupId, n.Kind, n.Id, n.Value, n.RecordedBy, n.PayerId)
+	return nil
+}
+
+// webhookNotifier envia alertas e avisos em JSON por POST
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, a BudgetAlert) error {
+	return n.post(ctx, a)
+}
+
+func (n *webhookNotifier) NotifyOnBehalf(ctx context.Context, notice OnBehalfNotice) error {
+	return n.post(ctx, notice)
+}
+
+func (n *webhookNotifier) post(ctx context.Context, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook respondeu %d", resp.StatusCode)
+	}
+	return nil
+}
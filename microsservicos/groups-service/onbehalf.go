@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxContestReason = 200
+
+// OnBehalfNotice avisa um membro de que uma despesa ou pagamento foi lançado
+// em seu nome por outra pessoa ("registrado por RecordedBy em nome de PayerId")
+type OnBehalfNotice struct {
+	Kind       string  `json:"kind"` // "expense" ou "payment"
+	GroupId    string  `json:"groupId"`
+	GroupName  string  `json:"groupName"`
+	Id         string  `json:"id"`
+	PayerId    string  `json:"payerId"`
+	RecordedBy string  `json:"recordedBy"`
+	TargetId   string  `json:"targetId,omitempty"`
+	Value      float64 `json:"value"`
+	At         int64   `json:"at"`
+}
+
+// onBehalfNotices monta os avisos para eventos lançados em nome de outro
+// membro: um para cada pagador além de quem lançou, com o valor que lhe foi
+// creditado
+func onBehalfNotices(g *Group, e Event) []OnBehalfNotice {
+	notice := OnBehalfNotice{GroupId: g.Id, GroupName: g.Name, At: e.At}
+	switch e.Type {
+	case eventExpenseAdded:
+		var p expensePayload
+		if e.decode(&p) != nil || p.Expense.RecordedBy == "" {
+			return nil
+		}
+		notice.Kind, notice.Id, notice.RecordedBy = "expense", p.Expense.Id, p.Expense.RecordedBy
+		paid := p.Expense.paidBy()
+		var notices []OnBehalfNotice
+		for _, payerId := range slices.Sorted(maps.Keys(paid)) {
+			if payerId != notice.RecordedBy {
+				notice.PayerId, notice.Value = payerId, paid[payerId]
+				notices = append(notices, notice)
+			}
+		}
+		return notices
+	case eventPaymentRecorded, eventSettlementRecorded:
+		var p paymentPayload
+		if e.decode(&p) != nil || p.Payment.RecordedBy == "" {
+			return nil
+		}
+		notice.Kind, notice.Id, notice.PayerId, notice.RecordedBy, notice.Value = "payment", p.Payment.Id, p.Payment.PayerId, p.Payment.RecordedBy, p.Payment.Value
+		notice.TargetId = p.Payment.TargetId
+		return []OnBehalfNotice{notice}
+	}
+	return nil
+}
+
+func (app *AppConfig) notifyOnBehalf(ctx context.Context, notice OnBehalfNotice) {
+	if err := app.Notifier.NotifyOnBehalf(ctx, notice); err != nil {
+		log.Printf("Erro ao avisar %s sobre lançamento em seu nome no grupo %s: %v", notice.PayerId, notice.GroupId, err)
+	}
+}
+
+// creditsOthers indica se gravar a despesa credita outros membros como
+// pagadores. Só é lançamento próprio a despesa paga inteira por quem lança.
+func (e Expense) creditsOthers(uid string) bool {
+	paid := e.paidBy()
+	return len(paid) != 1 || paid[uid] <= 0
+}
+
+// needsAdministrator indica se só quem administra o grupo pode gravar a despesa:
+// quando uid não está entre os pagadores ou credita aos outros, somados, mais do
+// que ele mesmo pagou. Quem dividiu a conta em partes iguais lança sem ajuda.
+func (e Expense) needsAdministrator(uid string) bool {
+	paid := e.paidBy()
+	own := paid[uid]
+	if own <= 0 {
+		return true
+	}
+	others := 0.0
+	for payerId, amount := range paid {
+		if payerId != uid {
+			others += amount
+		}
+	}
+	return others-own > 0.005
+}
+
+// recordOnBehalf marca a despesa como lançada por uid quando ela credita outros
+// membros, para que eles sejam avisados e possam contestar. Lançar só em nome
+// dos outros, ou creditando a eles mais do que pagou, exige administrar o grupo.
+func (g *Group) recordOnBehalf(e *Expense, uid string) error {
+	if !e.creditsOthers(uid) {
+		return nil
+	}
+	if e.needsAdministrator(uid) && !g.canAdminister(uid) {
+		return errNotAuthorized
+	}
+	e.RecordedBy = uid
+	return nil
+}
+
+// managedBy indica quem pode editar, apagar e restaurar a despesa: o pagador e,
+// se ela foi lançada em nome dele, quem lançou
+func (e Expense) managedBy(uid string) bool {
+	return uid == e.PayerId || (e.RecordedBy != "" && uid == e.RecordedBy)
+}
+
+func (p Payment) managedBy(uid string) bool {
+	return uid == p.PayerId || (p.RecordedBy != "" && uid == p.RecordedBy)
+}
+
+// contestableBy indica se uid foi creditado como pagador por outra pessoa e
+// pode contestar a despesa
+func (e Expense) contestableBy(uid string) bool {
+	return e.RecordedBy != "" && uid != e.RecordedBy && e.paidBy()[uid] > 0
+}
+
+type ContestRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleContestExpense é usado por quem foi creditado como pagador de uma
+// despesa lançada por outra pessoa para pedir a correção a quem lançou. A despesa continua valendo até ser
+// editada (o que limpa a contestação) ou apagada.
+func (app *AppConfig) handleContestExpense(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req ContestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len([]rune(req.Reason)) > maxContestReason {
+		http.Error(w, "Informe o motivo (até 200 caracteres)", http.StatusBadRequest)
+		return
+	}
+	expenseUID := chi.URLParam(r, "expenseId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if !expenseData.contestableBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventExpenseContested, contestPayload{
+			Id:     expenseUID,
+			At:     time.Now().UTC().Format(time.RFC3339Nano),
+			Reason: req.Reason,
+		})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao contestar despesa")
+		return
+	}
+	expenseData := group.Expenses[expenseUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(expenseData.Version))
+	json.NewEncoder(w).Encode(expenseData)
+}
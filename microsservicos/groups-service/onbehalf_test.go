@@ -0,0 +1,97 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestRecordOnBehalf(t *testing.T) {
+	g := &Group{
+		OwnerId:   "ana",
+		MemberIds: map[string]bool{"ana": true, "bia": true, "caio": true},
+		Roles:     map[string]string{"bia": roleTreasurer},
+	}
+	tests := []struct {
+		name           string
+		uid            string
+		expense        Expense
+		wantErr        bool
+		wantRecordedBy string
+	}{
+		{"pagou sozinho", "caio", Expense{PayerId: "caio", Value: 90}, false, ""},
+		{"pagou sozinho pelo mapa", "caio", Expense{PayerId: "caio", Value: 90, Payers: map[string]float64{"caio": 90}}, false, ""},
+		{"membro em nome de outro", "caio", Expense{PayerId: "ana", Value: 90}, true, ""},
+		{"membro com uma parte simbólica", "caio", Expense{PayerId: "caio", Value: 90, Payers: map[string]float64{"caio": 0.01, "ana": 89.99}}, true, ""},
+		{"membro que pagou menos que os outros somados", "caio", Expense{PayerId: "caio", Value: 90, Payers: map[string]float64{"caio": 30, "ana": 30, "bia": 30}}, true, ""},
+		{"membro em nome de vários sem pagar", "caio", Expense{PayerId: "ana", Value: 90, Payers: map[string]float64{"ana": 45, "bia": 45}}, true, ""},
+		{"membro que pagou metade", "caio", Expense{PayerId: "caio", Value: 90, Payers: map[string]float64{"caio": 45, "ana": 45}}, false, "caio"},
+		{"membro que pagou a maior parte", "caio", Expense{PayerId: "ana", Value: 90, Payers: map[string]float64{"caio": 60, "ana": 30}}, false, "caio"},
+		{"tesoureiro com uma parte", "bia", Expense{PayerId: "bia", Value: 90, Payers: map[string]float64{"bia": 30, "ana": 60}}, false, "bia"},
+		{"tesoureiro em nome de outro", "bia", Expense{PayerId: "caio", Value: 90}, false, "bia"},
+		{"dono em nome de outro", "ana", Expense{PayerId: "caio", Value: 90}, false, "ana"},
+	}
+	for _, tt := range tests {
+		exp := tt.expense
+		err := g.recordOnBehalf(&exp, tt.uid)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: recordOnBehalf = %v, quer erro = %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && exp.RecordedBy != tt.wantRecordedBy {
+			t.Errorf("%s: recordedBy = %q, quer %q", tt.name, exp.RecordedBy, tt.wantRecordedBy)
+		}
+	}
+}
+
+func TestExpenseContestableBy(t *testing.T) {
+	onBehalf := Expense{PayerId: "ana", RecordedBy: "bia", Value: 90, Payers: map[string]float64{"ana": 60, "bia": 20, "caio": 10}}
+	tests := []struct {
+		name    string
+		expense Expense
+		uid     string
+		want    bool
+	}{
+		{"pagador principal", onBehalf, "ana", true},
+		{"outro pagador creditado", onBehalf, "caio", true},
+		{"quem lançou", onBehalf, "bia", false},
+		{"quem não pagou", onBehalf, "davi", false},
+		{"despesa própria", Expense{PayerId: "ana", Value: 90}, "ana", false},
+	}
+	for _, tt := range tests {
+		if got := tt.expense.contestableBy(tt.uid); got != tt.want {
+			t.Errorf("%s: contestableBy(%s) = %v, quer %v", tt.name, tt.uid, got, tt.want)
+		}
+	}
+}
+
+func TestOnBehalfNotices(t *testing.T) {
+	g := &Group{Id: "g1", Name: "Casa"}
+	tests := []struct {
+		name string
+		e    Event
+		want []string // pagador:valor de cada aviso
+	}{
+		{"despesa própria", mustEvent(t, 2, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", Value: 90}}), nil},
+		{"despesa em nome de outro", mustEvent(t, 2, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", RecordedBy: "bia", Value: 90}}),
+			[]string{"ana:90"}},
+		{"cada pagador creditado, menos quem lançou", mustEvent(t, 2, eventExpenseAdded, expensePayload{Expense: Expense{
+			Id: "e1", PayerId: "caio", RecordedBy: "bia", Value: 90, Payers: map[string]float64{"caio": 50, "bia": 30, "ana": 10},
+		}}), []string{"ana:10", "caio:50"}},
+		{"pagamento em nome de outro", mustEvent(t, 2, eventPaymentRecorded, paymentPayload{Payment: Payment{Id: "p1", PayerId: "ana", TargetId: "caio", RecordedBy: "bia", Value: 15}}),
+			[]string{"ana:15"}},
+		{"pagamento próprio", mustEvent(t, 2, eventPaymentRecorded, paymentPayload{Payment: Payment{Id: "p1", PayerId: "ana", TargetId: "caio", Value: 15}}), nil},
+		{"edição não avisa", mustEvent(t, 2, eventExpenseEdited, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", RecordedBy: "bia", Value: 90}}), nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, n := range onBehalfNotices(g, tt.e) {
+			if n.GroupName != "Casa" || n.RecordedBy == "" || n.RecordedBy == n.PayerId {
+				t.Errorf("%s: aviso = %+v", tt.name, n)
+			}
+			got = append(got, n.PayerId+":"+strconv.FormatFloat(n.Value, 'f', -1, 64))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: avisos = %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "sort"
+
+// paidBy devolve quanto cada pessoa pagou da despesa. Despesas sem Payers
+// (inclusive as antigas) foram pagas inteiras por PayerId.
+func (e Expense) paidBy() map[string]float64 {
+	if len(e.Payers) > 0 {
+		return e.Payers
+	}
+	return map[string]float64{e.PayerId: e.Value}
+}
+
+// mainPayer escolhe o pagador principal de uma despesa nova: o informado, quem
+// lança (se não houver vários pagadores ou se for um deles) ou quem mais pagou
+func mainPayer(uid, requested string, payers map[string]float64) string {
+	if requested != "" {
+		return requested
+	}
+	if len(payers) == 0 || payers[uid] > 0 {
+		return uid
+	}
+	ids := make([]string, 0, len(payers))
+	for id := range payers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	main := ids[0]
+	for _, id := range ids[1:] {
+		if payers[id] > payers[main] {
+			main = id
+		}
+	}
+	return main
+}
+
+// compactPayers descarta Payers quando só uma pessoa pagou: a despesa fica
+// igual às de pagador único
+func compactPayers(payers map[string]float64) map[string]float64 {
+	if len(payers) <= 1 {
+		return nil
+	}
+	return payers
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMainPayer(t *testing.T) {
+	tests := []struct {
+		name      string
+		uid       string
+		requested string
+		payers    map[string]float64
+		want      string
+	}{
+		{"sem pagadores é quem lança", "ana", "", nil, "ana"},
+		{"o informado vale", "ana", "bia", map[string]float64{"bia": 10, "caio": 50}, "bia"},
+		{"quem lança, se pagou parte", "ana", "", map[string]float64{"ana": 10, "bia": 80}, "ana"},
+		{"quem mais pagou", "ana", "", map[string]float64{"bia": 30, "caio": 60}, "caio"},
+		{"empate fica com o primeiro id", "ana", "", map[string]float64{"caio": 45, "bia": 45}, "bia"},
+	}
+	for _, tt := range tests {
+		if got := mainPayer(tt.uid, tt.requested, tt.payers); got != tt.want {
+			t.Errorf("%s: mainPayer = %s, quer %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompactPayers(t *testing.T) {
+	tests := []struct {
+		payers map[string]float64
+		want   map[string]float64
+	}{
+		{nil, nil},
+		{map[string]float64{}, nil},
+		{map[string]float64{"ana": 90}, nil},
+		{map[string]float64{"ana": 60, "bia": 30}, map[string]float64{"ana": 60, "bia": 30}},
+	}
+	for _, tt := range tests {
+		if got := compactPayers(tt.payers); !maps.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("compactPayers(%v) = %v, quer %v", tt.payers, got, tt.want)
+		}
+	}
+}
+
+func TestExpensePaidBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		expense Expense
+		want    map[string]float64
+	}{
+		{"despesa antiga", Expense{PayerId: "ana", Value: 90}, map[string]float64{"ana": 90}},
+		{"vários pagadores", Expense{PayerId: "ana", Value: 90, Payers: map[string]float64{"ana": 60, "bia": 30}},
+			map[string]float64{"ana": 60, "bia": 30}},
+	}
+	for _, tt := range tests {
+		if got := tt.expense.paidBy(); !maps.Equal(got, tt.want) {
+			t.Errorf("%s: paidBy = %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestCoPayerAddsSharedExpense monta a despesa como handlePostExpense e confere
+// o status que a resposta teria
+func TestCoPayerAddsSharedExpense(t *testing.T) {
+	g := &Group{
+		OwnerId:   "ana",
+		MemberIds: map[string]bool{"ana": true, "bia": true, "caio": true},
+	}
+	tests := []struct {
+		name           string
+		uid            string
+		payers         map[string]float64
+		wantStatus     int
+		wantPayerId    string
+		wantRecordedBy string
+	}{
+		{"membro comum que pagou metade", "caio", map[string]float64{"caio": 45, "bia": 45}, http.StatusOK, "caio", "caio"},
+		{"membro comum que pagou a maior parte", "bia", map[string]float64{"bia": 60, "caio": 30}, http.StatusOK, "bia", "bia"},
+		{"membro comum que pagou pouco", "caio", map[string]float64{"caio": 10, "bia": 80}, http.StatusUnauthorized, "", ""},
+		{"membro comum fora dos pagadores", "caio", map[string]float64{"ana": 45, "bia": 45}, http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		req := ExpenseRequest{Description: "Jantar", Value: 90, Payers: tt.payers}
+		expense := Expense{Id: "e1", PayerId: mainPayer(tt.uid, "", req.Payers), Value: req.Value, Description: req.Description, Payers: req.Payers}
+		rec := httptest.NewRecorder()
+		if err := g.addExpense(&expense, tt.uid, req); err != nil {
+			writeGroupError(rec, err, "Erro ao criar despesa")
+		}
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, quer %d", tt.name, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		if expense.PayerId != tt.wantPayerId || expense.RecordedBy != tt.wantRecordedBy || !maps.Equal(expense.Payers, tt.payers) {
+			t.Errorf("%s: despesa = %+v", tt.name, expense)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Situação de um pagamento. Quem pagou registra o pagamento como pendente e ele
+// só entra nos saldos quando quem recebeu confirma.
+const (
+	paymentPending   = "pending"
+	paymentConfirmed = "confirmed"
+	paymentDisputed  = "disputed"
+	paymentCancelled = "cancelled"
+
+	maxDisputeReason = 200
+)
+
+var paymentEventStatus = map[string]string{
+	eventPaymentConfirmed: paymentConfirmed,
+	eventPaymentDisputed:  paymentDisputed,
+	eventPaymentCancelled: paymentCancelled,
+}
+
+// confirmed indica se o pagamento conta nos saldos. Pagamentos gravados antes
+// da confirmação existir não têm status e valem como confirmados.
+func (p Payment) confirmed() bool {
+	return p.Status == "" || p.Status == paymentConfirmed
+}
+
+type DisputeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleConfirmPayment é usado por quem recebeu para confirmar o recebimento
+// (numa compensação de acerto, pela contraparte de quem lançou). Um pagamento
+// contestado também pode ser confirmado depois.
+func (app *AppConfig) handleConfirmPayment(w http.ResponseWriter, r *http.Request) {
+	app.changePaymentStatus(w, r, eventPaymentConfirmed, "", "Erro ao confirmar pagamento")
+}
+
+// handleDisputePayment é usado por quem recebeu para dizer que o dinheiro não chegou
+func (app *AppConfig) handleDisputePayment(w http.ResponseWriter, r *http.Request) {
+	var req DisputeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON inválido", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len([]rune(req.Reason)) > maxDisputeReason {
+		http.Error(w, "Motivo muito longo", http.StatusBadRequest)
+		return
+	}
+	app.changePaymentStatus(w, r, eventPaymentDisputed, req.Reason, "Erro ao contestar pagamento")
+}
+
+// handleCancelPayment desfaz um pagamento ainda não confirmado; qualquer uma
+// das partes pode cancelar
+func (app *AppConfig) handleCancelPayment(w http.ResponseWriter, r *http.Request) {
+	app.changePaymentStatus(w, r, eventPaymentCancelled, "", "Erro ao cancelar pagamento")
+}
+
+func (app *AppConfig) changePaymentStatus(w http.ResponseWriter, r *http.Request, eventType, reason, fallback string) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	paymentUID := chi.URLParam(r, "paymentId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		paymentData, exists := g.Payments[paymentUID]
+		if !exists || paymentData.DeletedAt != "" {
+			return Event{}, errRecordNotFound
+		}
+		if !paymentData.canChangeStatus(uid, eventType) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, paymentData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if !paymentData.canMoveTo(eventType) {
+			return Event{}, errPaymentNotPending
+		}
+		return newEvent(eventType, paymentStatusPayload{
+			Id:     paymentUID,
+			At:     time.Now().UTC().Format(time.RFC3339Nano),
+			By:     uid,
+			Reason: reason,
+		})
+	})
+	if err != nil {
+		writeGroupError(w, err, fallback)
+		return
+	}
+	paymentData := group.Payments[paymentUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(paymentData.Version))
+	json.NewEncoder(w).Encode(paymentData)
+}
+
+// canChangeStatus: só quem confirma (veja confirmer) confirma; contestar
+// também vale para o pagador de um pagamento lançado em seu nome; cancelar,
+// para as duas partes
+func (p Payment) canChangeStatus(uid, eventType string) bool {
+	switch eventType {
+	case eventPaymentCancelled:
+		return uid == p.PayerId || uid == p.TargetId
+	case eventPaymentDisputed:
+		return uid == p.confirmer() || (uid == p.PayerId && p.RecordedBy != "")
+	}
+	return uid == p.confirmer()
+}
+
+// confirmer é quem confirma o pagamento: quem recebeu ou, numa compensação de
+// acerto, a parte que não a lançou
+func (p Payment) confirmer() string {
+	if p.Compensation && p.RecordedBy != "" {
+		return p.PayerId
+	}
+	return p.TargetId
+}
+
+// canMoveTo: só pendentes podem ser contestados; confirmar e cancelar valem
+// também para contestados
+func (p Payment) canMoveTo(eventType string) bool {
+	if eventType == eventPaymentDisputed {
+		return p.Status == paymentPending
+	}
+	return p.Status == paymentPending || p.Status == paymentDisputed
+}
@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestPaymentCanChangeStatus(t *testing.T) {
+	own := Payment{PayerId: "ana", TargetId: "bia"}
+	onBehalf := Payment{PayerId: "ana", TargetId: "bia", RecordedBy: "caio"}
+	// Compensações de acerto: quem lança é uma das partes e a outra confirma
+	paidByCaller := Payment{PayerId: "ana", TargetId: "bia", Compensation: true}
+	paidByCounterparty := Payment{PayerId: "ana", TargetId: "bia", RecordedBy: "bia", Compensation: true}
+	tests := []struct {
+		name      string
+		payment   Payment
+		uid       string
+		eventType string
+		want      bool
+	}{
+		{"quem recebeu confirma", own, "bia", eventPaymentConfirmed, true},
+		{"quem pagou não confirma", own, "ana", eventPaymentConfirmed, false},
+		{"quem lançou em nome do pagador não confirma", onBehalf, "caio", eventPaymentConfirmed, false},
+		{"quem recebeu contesta", own, "bia", eventPaymentDisputed, true},
+		{"quem pagou não contesta o próprio lançamento", own, "ana", eventPaymentDisputed, false},
+		{"pagador contesta lançamento em seu nome", onBehalf, "ana", eventPaymentDisputed, true},
+		{"quem pagou cancela", own, "ana", eventPaymentCancelled, true},
+		{"quem recebeu cancela", own, "bia", eventPaymentCancelled, true},
+		{"terceiro não cancela", own, "caio", eventPaymentCancelled, false},
+		{"contraparte confirma compensação que recebe", paidByCaller, "bia", eventPaymentConfirmed, true},
+		{"quem lançou não confirma compensação que paga", paidByCaller, "ana", eventPaymentConfirmed, false},
+		{"contraparte confirma compensação que paga", paidByCounterparty, "ana", eventPaymentConfirmed, true},
+		{"quem lançou não confirma compensação que recebe", paidByCounterparty, "bia", eventPaymentConfirmed, false},
+		{"contraparte contesta compensação", paidByCounterparty, "ana", eventPaymentDisputed, true},
+		{"quem lançou não contesta a própria compensação", paidByCounterparty, "bia", eventPaymentDisputed, false},
+		{"quem lançou cancela compensação", paidByCounterparty, "bia", eventPaymentCancelled, true},
+	}
+	for _, tt := range tests {
+		if got := tt.payment.canChangeStatus(tt.uid, tt.eventType); got != tt.want {
+			t.Errorf("%s: canChangeStatus = %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentCanMoveTo(t *testing.T) {
+	tests := []struct {
+		status    string
+		eventType string
+		want      bool
+	}{
+		{paymentPending, eventPaymentConfirmed, true},
+		{paymentPending, eventPaymentDisputed, true},
+		{paymentPending, eventPaymentCancelled, true},
+		{paymentDisputed, eventPaymentConfirmed, true},
+		{paymentDisputed, eventPaymentDisputed, false},
+		{paymentDisputed, eventPaymentCancelled, true},
+		{paymentConfirmed, eventPaymentConfirmed, false},
+		{paymentConfirmed, eventPaymentDisputed, false},
+		{paymentConfirmed, eventPaymentCancelled, false},
+		{paymentCancelled, eventPaymentConfirmed, false},
+		{paymentCancelled, eventPaymentCancelled, false},
+		// Pagamentos antigos, sem status, já valem como confirmados
+		{"", eventPaymentCancelled, false},
+	}
+	for _, tt := range tests {
+		p := Payment{Status: tt.status}
+		if got := p.canMoveTo(tt.eventType); got != tt.want {
+			t.Errorf("%q -> %s = %v, quer %v", tt.status, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestApplyPaymentStatus(t *testing.T) {
+	tests := []struct {
+		eventType     string
+		reason        string
+		wantStatus    string
+		wantConfirmed bool
+	}{
+		{eventPaymentConfirmed, "", paymentConfirmed, true},
+		{eventPaymentDisputed, "não chegou", paymentDisputed, false},
+		{eventPaymentCancelled, "", paymentCancelled, false},
+	}
+	for _, tt := range tests {
+		g := Group{Id: "g1", Payments: map[string]Payment{
+			"p1": {Id: "p1", PayerId: "ana", TargetId: "bia", Value: 10, Status: paymentPending, Version: 1},
+		}}
+		e := mustEvent(t, 2, tt.eventType, paymentStatusPayload{Id: "p1", At: "2026-03-10T00:00:00Z", By: "bia", Reason: tt.reason})
+		if err := g.apply(e); err != nil {
+			t.Fatalf("%s: apply = %v", tt.eventType, err)
+		}
+		p := g.Payments["p1"]
+		if p.Status != tt.wantStatus || p.StatusBy != "bia" || p.DisputeReason != tt.reason || p.Version != 2 {
+			t.Errorf("%s: pagamento = %+v", tt.eventType, p)
+		}
+		if p.confirmed() != tt.wantConfirmed {
+			t.Errorf("%s: confirmed() = %v, quer %v", tt.eventType, p.confirmed(), tt.wantConfirmed)
+		}
+	}
+
+	g := Group{Id: "g1", Payments: map[string]Payment{}}
+	if err := g.apply(mustEvent(t, 2, eventPaymentConfirmed, paymentStatusPayload{Id: "p9"})); err != errRecordNotFound {
+		t.Errorf("pagamento desconhecido: apply = %v, quer errRecordNotFound", err)
+	}
+}
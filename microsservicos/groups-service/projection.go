@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"firebase.google.com/go/v4/db"
+)
+
+const (
+	maxAppendAttempts = 5
+	maxRepairAttempts = 5
+)
+
+var (
+	errNoChanges       = errors.New("nenhuma alteração")
+	errProjectionAhead = errors.New("projeção já está atualizada")
+)
+
+// execute é o caminho de escrita do serviço: carrega o grupo, pede a decide o
+// evento que descreve a mudança, grava-o no ledger e atualiza as projeções.
+// decide não deve alterar o grupo recebido. Se outro escritor gravar antes, o
+// processo recomeça com o estado novo. Gravado o evento, a escrita está feita:
+// uma falha ao projetar não volta como erro, senão o cliente repetiria o pedido
+// e duplicaria o registro; a projeção é refeita em segundo plano.
+func (app *AppConfig) execute(ctx context.Context, groupId, actorId string, decide func(g *Group) (Event, error)) (*Group, Event, error) {
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		stored, pending, err := app.loadGroupForWrite(ctx, groupId)
+		if err != nil {
+			return nil, Event{}, err
+		}
+		group, activities, err := applyPending(stored, pending)
+		if err != nil {
+			return nil, Event{}, err
+		}
+
+		e, err := decide(group.clone())
+		if err != nil {
+			// Eventos que a projeção ainda não refletia são projetados mesmo
+			// assim, para que uma nova tentativa conserte uma projeção atrasada
+			if len(pending) > 0 {
+				if perr := app.project(ctx, stored, group, activities); perr != nil {
+					log.Printf("Erro ao atualizar projeção do grupo %s: %v", groupId, perr)
+				}
+			}
+			return nil, Event{}, err
+		}
+		e.Seq = group.Version + 1
+		e.GroupId = groupId
+		e.ActorId = actorId
+		e.At = nowMillis()
+
+		a, err := group.applyWithActivity(e)
+		if err != nil {
+			return nil, Event{}, err
+		}
+		if err := app.appendEvent(ctx, e); errors.Is(err, errLedgerConflict) {
+			continue
+		} else if err != nil {
+			return nil, Event{}, err
+		}
+		if err := app.project(ctx, stored, group, append(activities, a)); err != nil {
+			log.Printf("Evento %d do grupo %s gravado, projeção pendente: %v", e.Seq, groupId, err)
+			go app.repairProjection(context.WithoutCancel(ctx), groupId)
+		}
+		app.publishEvent(e)
+		if app.Notifier != nil && affectsBudgets(e) {
+			go app.checkBudgetAlerts(context.WithoutCancel(ctx), group.clone(), time.Now())
+		}
+		if app.Notifier != nil {
+			for _, notice := range onBehalfNotices(group, e) {
+				go app.notifyOnBehalf(context.WithoutCancel(ctx), notice)
+			}
+		}
+		return group, e, nil
+	}
+	return nil, Event{}, errLedgerConflict
+}
+
+// applyPending aplica a uma cópia da projeção os eventos que ela ainda não
+// refletiu e devolve as entradas de atividade correspondentes
+func applyPending(stored *Group, pending []Event) (*Group, []Activity, error) {
+	group := stored.clone()
+	activities := make([]Activity, 0, len(pending)+1)
+	for _, e := range pending {
+		a, err := group.applyWithActivity(e)
+		if err != nil {
+			return nil, nil, err
+		}
+		activities = append(activities, a)
+	}
+	return group, activities, nil
+}
+
+// repairProjection leva a projeção do grupo até o fim do ledger depois de uma
+// falha ao projetar, tentando de novo com espera crescente. Se não conseguir, a
+// próxima escrita no grupo reaplica os eventos pendentes.
+func (app *AppConfig) repairProjection(ctx context.Context, groupId string) {
+	for attempt := 1; attempt <= maxRepairAttempts; attempt++ {
+		time.Sleep(time.Duration(attempt) * time.Second)
+		err := app.catchUp(ctx, groupId)
+		if err == nil {
+			return
+		}
+		log.Printf("Erro ao refazer projeção do grupo %s (tentativa %d): %v", groupId, attempt, err)
+	}
+}
+
+// catchUp projeta os eventos do ledger que a projeção ainda não refletiu
+func (app *AppConfig) catchUp(ctx context.Context, groupId string) error {
+	stored, pending, err := app.loadGroupForWrite(ctx, groupId)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	group, activities, err := applyPending(stored, pending)
+	if err != nil {
+		return err
+	}
+	return app.project(ctx, stored, group, activities)
+}
+
+// loadGroupForWrite lê a projeção e os eventos que ela ainda não refletiu.
+// Grupos anteriores ao ledger ganham um evento GroupImported com o estado atual.
+func (app *AppConfig) loadGroupForWrite(ctx context.Context, groupId string) (*Group, []Event, error) {
+	var stored Group
+	if err := app.DBClient.NewRef("groups/"+groupId).Get(ctx, &stored); err != nil {
+		return nil, nil, err
+	}
+	stored.ensureMaps()
+	last, err := app.lastEventSeq(ctx, groupId)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case last == 0 && stored.OwnerId == "":
+		return nil, nil, errGroupNotFound
+	case last == 0:
+		snapshot := stored.clone()
+		e, err := newEvent(eventGroupImported, groupPayload{Group: *snapshot})
+		if err != nil {
+			return nil, nil, err
+		}
+		e.Seq = stored.Version + 1
+		e.GroupId = groupId
+		e.ActorId = systemActor
+		e.At = nowMillis()
+		if err := app.appendEvent(ctx, e); err == nil {
+			app.publishEvent(e)
+		} else if !errors.Is(err, errLedgerConflict) {
+			return nil, nil, err
+		}
+		// Em caso de conflito outro escritor já importou; os eventos são relidos abaixo
+	case last <= stored.Version:
+		return &stored, nil, nil
+	}
+	pending, err := app.eventsAfter(ctx, groupId, stored.Version, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &stored, pending, nil
+}
+
+// project grava o índice user_groups, as entradas de atividade e a nova
+// projeção do grupo (sem regredir uma versão mais nova já gravada), nesta ordem:
+// a projeção só avança depois que o índice e as atividades foram gravados.
+// Se algo falhar, a projeção continua atrás do ledger e a próxima escrita no
+// grupo reaplica os eventos pendentes, regravando índice e atividades.
+func (app *AppConfig) project(ctx context.Context, stored, group *Group, activities []Activity) error {
+	ctx = context.WithoutCancel(ctx)
+	updates := membershipIndexUpdates(stored, group)
+	for _, a := range activities {
+		updates[a.path()] = a
+	}
+	if len(updates) > 0 {
+		if err := app.multiUpdate(ctx, updates); err != nil {
+			return fmt.Errorf("índices do grupo %s: %w", group.Id, err)
+		}
+	}
+	err := app.DBClient.NewRef("groups/"+group.Id).Transaction(ctx, func(tn db.TransactionNode) (any, error) {
+		var current Group
+		if err := tn.Unmarshal(&current); err != nil {
+			return nil, err
+		}
+		if current.Version >= group.Version {
+			return nil, errProjectionAhead
+		}
+		return group, nil
+	})
+	if err != nil && !errors.Is(err, errProjectionAhead) {
+		return fmt.Errorf("projeção do grupo %s: %w", group.Id, err)
+	}
+	return nil
+}
+
+// membershipIndexUpdates monta as entradas de user_groups da nova versão do
+// grupo. Todos os membros atuais são regravados, e não só os novos, para que
+// uma falha anterior no índice se corrija na escrita seguinte.
+func membershipIndexUpdates(before, after *Group) map[string]any {
+	updates := map[string]any{}
+	for userId, isMember := range after.MemberIds {
+		if isMember {
+			updates["user_groups/"+userId+"/"+after.Id] = true
+		}
+	}
+	for userId, isMember := range before.MemberIds {
+		if isMember && !after.MemberIds[userId] {
+			updates["user_groups/"+userId+"/"+after.Id] = nil
+		}
+	}
+	return updates
+}
+
+// replay reconstrói o grupo aplicando os eventos em ordem. Se until > 0, para no
+// último evento com At <= until.
+func replay(events []Event, until int64) (*Group, error) {
+	group := &Group{}
+	group.ensureMaps()
+	for _, e := range events {
+		if until > 0 && e.At > until {
+			break
+		}
+		if err := group.apply(e); err != nil {
+			return nil, fmt.Errorf("evento %d (%s): %w", e.Seq, e.Type, err)
+		}
+	}
+	return group, nil
+}
+
+// rebuildProjection descarta a projeção do grupo e a refaz a partir do ledger
+func (app *AppConfig) rebuildProjection(ctx context.Context, groupId string) (*Group, error) {
+	events, err := app.eventsAfter(ctx, groupId, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, errGroupNotFound
+	}
+	group, err := replay(events, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.DBClient.NewRef("groups/"+groupId).Set(ctx, group); err != nil {
+		return nil, err
+	}
+	updates := map[string]any{}
+	for userId, isMember := range group.MemberIds {
+		if isMember {
+			updates["user_groups/"+userId+"/"+groupId] = true
+		}
+	}
+	if len(updates) > 0 {
+		if err := app.multiUpdate(ctx, updates); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// runRebuildCommand implementa o subcomando "rebuild-projections [-group id]"
+func (app *AppConfig) runRebuildCommand(args []string) {
+	fs := flag.NewFlagSet("rebuild-projections", flag.ExitOnError)
+	only := fs.String("group", "", "refaz apenas o grupo informado")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	groupIds := map[string]bool{}
+	if *only != "" {
+		groupIds[*only] = true
+	} else if err := app.DBClient.NewRef("group_events").GetShallow(ctx, &groupIds); err != nil {
+		log.Fatalf("Erro ao listar ledgers: %v", err)
+	}
+	failures := 0
+	for groupId := range groupIds {
+		group, err := app.rebuildProjection(ctx, groupId)
+		if err != nil {
+			failures++
+			fmt.Printf("grupo %s: erro: %v\n", groupId, err)
+			continue
+		}
+		fmt.Printf("grupo %s: versão %d\n", groupId, group.Version)
+	}
+	fmt.Printf("%d projeções refeitas, %d falhas\n", len(groupIds)-failures, failures)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	maxReceiptItems = 100
+	maxItemName     = 60
+)
+
+// ReceiptItem é uma linha do recibo; o total da linha (Quantity × Price) é
+// dividido igualmente entre Participants
+type ReceiptItem struct {
+	Name         string   `json:"name"`
+	Quantity     float64  `json:"quantity"`
+	Price        float64  `json:"price"` // preço unitário
+	Participants []string `json:"participants"`
+}
+
+// Receipt detalha uma despesa item a item. Imposto, gorjeta e taxa de serviço
+// são distribuídos na proporção do que cada um consumiu dos itens.
+type Receipt struct {
+	Items   []ReceiptItem `json:"items"`
+	Tax     float64       `json:"tax,omitempty"`
+	Tip     float64       `json:"tip,omitempty"`
+	Service float64       `json:"service,omitempty"`
+}
+
+func (item ReceiptItem) total() float64 {
+	return item.Quantity * item.Price
+}
+
+func (r Receipt) subtotal() float64 {
+	subtotal := 0.0
+	for _, item := range r.Items {
+		subtotal += item.total()
+	}
+	return subtotal
+}
+
+// total é o valor da despesa: itens mais imposto, gorjeta e serviço
+func (r Receipt) total() float64 {
+	return math.Round((r.subtotal()+r.Tax+r.Tip+r.Service)*100) / 100
+}
+
+// normalize completa o recibo com os padrões: quantidade 1 e, sem
+// participantes, todos os membros atuais do grupo. Participantes repetidos num
+// item contam uma vez só, para ninguém ficar com duas partes.
+func (r *Receipt) normalize(g *Group) {
+	members := make([]string, 0, len(g.MemberIds))
+	for mId := range g.MemberIds {
+		members = append(members, mId)
+	}
+	sort.Strings(members)
+	for i := range r.Items {
+		item := &r.Items[i]
+		item.Name = strings.TrimSpace(item.Name)
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if len(item.Participants) == 0 {
+			item.Participants = members
+		} else {
+			item.Participants = uniqueParticipants(item.Participants)
+		}
+	}
+}
+
+// uniqueParticipants descarta os ids repetidos, mantendo a ordem
+func uniqueParticipants(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, mId := range ids {
+		if !seen[mId] {
+			seen[mId] = true
+			unique = append(unique, mId)
+		}
+	}
+	return unique
+}
+
+// validate confere o recibo contra os membros do grupo
+func (r Receipt) validate(g *Group, e *ValidationError) {
+	if len(r.Items) > maxReceiptItems {
+		e.add("receipt.items", "Itens demais no recibo")
+		return
+	}
+	for i, item := range r.Items {
+		field := fmt.Sprintf("receipt.items[%d]", i)
+		switch {
+		case item.Name == "":
+			e.add(field+".name", "Nome do item obrigatório")
+		case len([]rune(item.Name)) > maxItemName:
+			e.add(field+".name", "Nome do item muito longo")
+		}
+		if item.Quantity <= 0 {
+			e.add(field+".quantity", "Quantidade deve ser positiva")
+		}
+		if item.Price < 0 {
+			e.add(field+".price", "Preço não pode ser negativo")
+		}
+		for _, mId := range item.Participants {
+			if !g.MemberIds[mId] {
+				e.add(field+".participants", "Participantes devem ser membros do grupo")
+				break
+			}
+		}
+	}
+	if r.Tax < 0 || r.Tip < 0 || r.Service < 0 {
+		e.add("receipt", "Imposto, gorjeta e serviço não podem ser negativos")
+	}
+	if r.subtotal() <= 0 {
+		e.add("receipt.items", "O recibo precisa de ao menos um item com valor")
+	}
+}
+
+// split calcula quanto cada membro deve: sua parte nos itens mais a fração
+// proporcional de imposto, gorjeta e serviço. Os valores servem de pesos para
+// Expense.Split e somam o total do recibo.
+func (r Receipt) split() map[string]float64 {
+	consumed := map[string]float64{}
+	for _, item := range r.Items {
+		if len(item.Participants) == 0 {
+			continue
+		}
+		share := item.total() / float64(len(item.Participants))
+		for _, mId := range item.Participants {
+			consumed[mId] += share
+		}
+	}
+	subtotal := r.subtotal()
+	if subtotal <= 0 {
+		return consumed
+	}
+	extras := r.Tax + r.Tip + r.Service
+	split := make(map[string]float64, len(consumed))
+	for mId, amount := range consumed {
+		if amount > 0 {
+			split[mId] = amount + extras*amount/subtotal
+		}
+	}
+	return split
+}
+
+// itemize detalha a despesa com o recibo: a divisão passa a vir dos itens e o
+// valor, se não informado, é o total do recibo. Um recibo sem itens remove o
+// detalhamento e mantém a última divisão calculada.
+func (g *Group) itemize(exp *Expense, receipt Receipt, splitGiven bool) error {
+	if len(receipt.Items) == 0 {
+		exp.Receipt = nil
+		return nil
+	}
+	receipt.normalize(g)
+	e := &ValidationError{}
+	receipt.validate(g, e)
+	if splitGiven {
+		e.add("split", "Com recibo a divisão é calculada pelos itens")
+	}
+	total := receipt.total()
+	if exp.Value == 0 {
+		exp.Value = total
+	} else if math.Abs(exp.Value-total) > 0.005 {
+		e.add("value", "Valor deve ser o total do recibo")
+	}
+	if err := e.err(); err != nil {
+		return err
+	}
+	exp.Receipt, exp.Split = &receipt, receipt.split()
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func TestReceiptSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		receipt Receipt
+		want    map[string]float64
+	}{
+		{
+			"cada linha entre seus participantes",
+			Receipt{Items: []ReceiptItem{
+				{Name: "Pizza", Quantity: 1, Price: 60, Participants: []string{"ana", "bia", "caio"}},
+				{Name: "Vinho", Quantity: 2, Price: 15, Participants: []string{"ana", "bia"}},
+			}},
+			map[string]float64{"ana": 35, "bia": 35, "caio": 20},
+		},
+		{
+			"extras na proporção do consumo",
+			Receipt{Items: []ReceiptItem{
+				{Name: "Prato", Quantity: 1, Price: 30, Participants: []string{"ana"}},
+				{Name: "Prato", Quantity: 1, Price: 10, Participants: []string{"bia"}},
+			}, Tax: 2, Tip: 4, Service: 2},
+			map[string]float64{"ana": 36, "bia": 12},
+		},
+		{
+			"linha sem valor não entra na divisão",
+			Receipt{Items: []ReceiptItem{
+				{Name: "Água", Quantity: 1, Price: 0, Participants: []string{"caio"}},
+				{Name: "Prato", Quantity: 1, Price: 20, Participants: []string{"ana"}},
+			}, Tip: 2},
+			map[string]float64{"ana": 22},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.receipt.split()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: split = %v, quer %v", tt.name, got, tt.want)
+			continue
+		}
+		total := 0.0
+		for mId, want := range tt.want {
+			if cents(got[mId]) != want {
+				t.Errorf("%s: parte de %s = %v, quer %v", tt.name, mId, got[mId], want)
+			}
+			total += got[mId]
+		}
+		if cents(total) != tt.receipt.total() {
+			t.Errorf("%s: partes somam %v, quer o total %v", tt.name, total, tt.receipt.total())
+		}
+	}
+}
+
+func TestItemize(t *testing.T) {
+	g := &Group{MemberIds: map[string]bool{"ana": true, "bia": true}}
+	dinner := Receipt{
+		Items: []ReceiptItem{
+			{Name: "Pizza", Price: 50},
+			{Name: "Suco", Quantity: 2, Price: 5, Participants: []string{"bia"}},
+		},
+		Service: 6,
+	}
+	tests := []struct {
+		name       string
+		value      float64
+		receipt    Receipt
+		splitGiven bool
+		wantFields []string
+		wantValue  float64
+		wantSplit  map[string]float64
+	}{
+		{"valor vem do recibo", 0, dinner, false, nil, 66, map[string]float64{"ana": 27.5, "bia": 38.5}},
+		{"valor igual ao total", 66, dinner, false, nil, 66, map[string]float64{"ana": 27.5, "bia": 38.5}},
+		{"valor diferente do total", 70, dinner, false, []string{"value"}, 0, nil},
+		{"divisão informada junto", 0, dinner, true, []string{"split"}, 0, nil},
+		{"participante repetido conta uma vez", 0, Receipt{Items: []ReceiptItem{{Name: "Pizza", Price: 50, Participants: []string{"ana", "bia", "ana"}}}}, false,
+			nil, 50, map[string]float64{"ana": 25, "bia": 25}},
+		{"participante de fora", 0, Receipt{Items: []ReceiptItem{{Name: "Pizza", Price: 50, Participants: []string{"caio"}}}}, false,
+			[]string{"receipt.items[0].participants"}, 0, nil},
+		{"item sem nome e quantidade negativa", 0, Receipt{Items: []ReceiptItem{{Quantity: -1, Price: 10}}}, false,
+			[]string{"receipt.items[0].name", "receipt.items[0].quantity", "receipt.items"}, 0, nil},
+		{"extras negativos", 0, Receipt{Items: []ReceiptItem{{Name: "Pizza", Price: 50}}, Tip: -1}, false,
+			[]string{"receipt"}, 0, nil},
+	}
+	for _, tt := range tests {
+		exp := Expense{Value: tt.value}
+		// O recibo é copiado em itemize; os itens do caso não podem ser alterados
+		receipt := tt.receipt
+		receipt.Items = slices.Clone(tt.receipt.Items)
+		got := fieldsOf(t, g.itemize(&exp, receipt, tt.splitGiven))
+		if !slices.Equal(got, tt.wantFields) {
+			t.Errorf("%s: campos = %v, quer %v", tt.name, got, tt.wantFields)
+			continue
+		}
+		if tt.wantFields != nil {
+			continue
+		}
+		if exp.Value != tt.wantValue || exp.Receipt == nil {
+			t.Errorf("%s: despesa = %+v", tt.name, exp)
+		}
+		for mId, want := range tt.wantSplit {
+			if cents(exp.Split[mId]) != want {
+				t.Errorf("%s: split de %s = %v, quer %v", tt.name, mId, exp.Split[mId], want)
+			}
+		}
+	}
+
+	// O recibo gravado fica sem o participante repetido
+	exp := Expense{}
+	repeated := Receipt{Items: []ReceiptItem{{Name: "Pizza", Price: 50, Participants: []string{"ana", "ana"}}}}
+	if err := g.itemize(&exp, repeated, false); err != nil || !slices.Equal(exp.Receipt.Items[0].Participants, []string{"ana"}) {
+		t.Errorf("participante repetido: err = %v, recibo = %+v", err, exp.Receipt)
+	}
+
+	// Recibo sem itens remove o detalhamento e mantém a divisão
+	exp = Expense{Value: 66, Receipt: &dinner, Split: map[string]float64{"ana": 1}}
+	if err := g.itemize(&exp, Receipt{}, false); err != nil || exp.Receipt != nil || exp.Split["ana"] != 1 {
+		t.Errorf("recibo vazio: err = %v, despesa = %+v", err, exp)
+	}
+}
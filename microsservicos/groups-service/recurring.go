@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultRecurringInterval = time.Hour
+	// Limite de ocorrências atrasadas lançadas por modelo em cada passada
+	maxCatchUpOccurrences  = 60
+	maxUpcomingOccurrences = 24
+	// Ocorrências atrasadas são lançadas de uma vez; a data de início só pode
+	// estar até este número de dias no passado
+	maxRecurringBackfillDays = 31
+	// Horizonte máximo da busca pelas próximas datas
+	maxUpcomingYears = 10
+)
+
+// RecurringExpense é um modelo de despesa lançado automaticamente nas datas do
+// Schedule, entre StartDate e EndDate (inclusive, YYYY-MM-DD em UTC). LastRun é
+// a data da última ocorrência já lançada: alterar o modelo só afeta as
+// ocorrências seguintes.
+type RecurringExpense struct {
+	Id          string             `json:"id"`
+	Description string             `json:"description"`
+	Category    string             `json:"category"`
+	Value       float64            `json:"value"`
+	PayerId     string             `json:"payerId"`
+	Split       map[string]float64 `json:"split,omitempty"`
+	Schedule    Schedule           `json:"schedule"`
+	StartDate   string             `json:"startDate"`
+	EndDate     string             `json:"endDate,omitempty"`
+	Paused      bool               `json:"paused"`
+	Skipped     []string           `json:"skipped,omitempty"` // ocorrências puladas
+	LastRun     string             `json:"lastRun,omitempty"`
+	Version     int64              `json:"version"`
+}
+
+type RecurringRequest struct {
+	Description string             `json:"description"`
+	Category    string             `json:"category"`
+	Value       float64            `json:"value"`
+	Split       map[string]float64 `json:"split"`
+	Schedule    Schedule           `json:"schedule"`
+	StartDate   string             `json:"startDate"`
+	EndDate     string             `json:"endDate"`
+}
+
+type SkipRequest struct {
+	Date string `json:"date"`
+}
+
+type recurringPayload struct {
+	Recurring RecurringExpense `json:"recurring"`
+}
+
+// occurrencePayload lança uma ocorrência; o campo expense tem o mesmo formato
+// de ExpenseAdded para quem consome os eventos
+type occurrencePayload struct {
+	RecurringId string  `json:"recurringId"`
+	Date        string  `json:"date"`
+	Expense     Expense `json:"expense"`
+}
+
+// recurringIntervalFromEnv lê RECURRING_INTERVAL (ex: "15m")
+func recurringIntervalFromEnv() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("RECURRING_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return defaultRecurringInterval
+}
+
+func parseDay(raw string) (time.Time, error) {
+	return time.Parse(time.DateOnly, raw)
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// validate normaliza o pedido e devolve a mensagem de erro, se houver
+func (req *RecurringRequest) validate() string {
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Description == "" {
+		return "Descrição obrigatória"
+	}
+	if req.Value <= 0 {
+		return "Valor deve ser positivo"
+	}
+	if req.StartDate == "" {
+		req.StartDate = utcDay(time.Now()).Format(time.DateOnly)
+	}
+	start, err := parseDay(req.StartDate)
+	if err != nil {
+		return "Data de início inválida (use YYYY-MM-DD)"
+	}
+	if req.EndDate != "" {
+		end, err := parseDay(req.EndDate)
+		if err != nil {
+			return "Data de fim inválida (use YYYY-MM-DD)"
+		}
+		if end.Before(start) {
+			return "Data de fim anterior à de início"
+		}
+	}
+	if err := req.Schedule.validate(start); err != nil {
+		return "Regra de recorrência inválida: " + err.Error()
+	}
+	return ""
+}
+
+// checkStart limita as ocorrências atrasadas: a data de início pode estar no
+// máximo maxRecurringBackfillDays antes de hoje. Manter a data de início atual
+// de um modelo (current) é sempre permitido.
+func (req *RecurringRequest) checkStart(today time.Time, current string) string {
+	if req.StartDate == current {
+		return ""
+	}
+	earliest := today.AddDate(0, 0, -maxRecurringBackfillDays).Format(time.DateOnly)
+	if req.StartDate < earliest {
+		return "Data de início no máximo " + strconv.Itoa(maxRecurringBackfillDays) + " dias antes de hoje"
+	}
+	return ""
+}
+
+// validSplit verifica se os pesos da divisão são positivos e só de membros
+func (g *Group) validSplit(split map[string]float64) bool {
+	for memberId, weight := range split {
+		if weight <= 0 || !g.MemberIds[memberId] {
+			return false
+		}
+	}
+	return true
+}
+
+// dueDates devolve as ocorrências ainda não lançadas até o dia until, inclusive
+func (rec RecurringExpense) dueDates(until time.Time, limit int) []time.Time {
+	start, err := parseDay(rec.StartDate)
+	if err != nil {
+		return nil
+	}
+	if rec.EndDate != "" {
+		if end, err := parseDay(rec.EndDate); err == nil && end.Before(until) {
+			until = end
+		}
+	}
+	day := start
+	if last, err := parseDay(rec.LastRun); err == nil && !last.Before(start) {
+		day = last.AddDate(0, 0, 1)
+	}
+	var dates []time.Time
+	due := rec.Schedule.dueFunc(start)
+	for ; !day.After(until) && len(dates) < limit; day = day.AddDate(0, 0, 1) {
+		if due(day) && !slices.Contains(rec.Skipped, day.Format(time.DateOnly)) {
+			dates = append(dates, day)
+		}
+	}
+	return dates
+}
+
+// occurrenceId é determinístico: a mesma ocorrência nunca gera duas despesas
+func occurrenceId(recurringId string, day time.Time) string {
+	return recurringId + "-" + day.Format("20060102")
+}
+
+// runRecurring lança as ocorrências vencidas de todos os grupos. Pode rodar em
+// várias instâncias ao mesmo tempo: cada ocorrência só é gravada se for
+// posterior a LastRun no estado mais recente do grupo.
+func (app *AppConfig) runRecurring(ctx context.Context, now time.Time) (int, error) {
+	var groupIds map[string]bool
+	if err := app.DBClient.NewRef("groups").GetShallow(ctx, &groupIds); err != nil {
+		return 0, err
+	}
+	today := utcDay(now)
+	created := 0
+	for groupId := range groupIds {
+		group, err := app.getGroup(ctx, groupId)
+		if err != nil {
+			continue
+		}
+		for _, rec := range group.Recurring {
+			if rec.Paused {
+				continue
+			}
+			for _, day := range rec.dueDates(today, maxCatchUpOccurrences) {
+				err := app.materializeOccurrence(ctx, groupId, rec.Id, day)
+				if errors.Is(err, errNoChanges) {
+					continue
+				}
+				if err != nil {
+					log.Printf("Erro ao lançar recorrência %s do grupo %s em %s: %v", rec.Id, groupId, day.Format(time.DateOnly), err)
+					break
+				}
+				created++
+			}
+		}
+	}
+	return created, nil
+}
+
+func (app *AppConfig) materializeOccurrence(ctx context.Context, groupId, recurringId string, day time.Time) error {
+	date := day.Format(time.DateOnly)
+	_, _, err := app.execute(ctx, groupId, systemActor, func(g *Group) (Event, error) {
+		rec, exists := g.Recurring[recurringId]
+		if !exists || rec.Paused || date <= rec.LastRun {
+			return Event{}, errNoChanges
+		}
+		id := occurrenceId(recurringId, day)
+		if _, exists := g.Expenses[id]; exists {
+			return Event{}, errNoChanges
+		}
+		expense := Expense{
+			// Meio-dia UTC, para a data não mudar nos fusos do Brasil
+			Date:        float64(day.Add(12 * time.Hour).UnixMilli()),
+			Description: rec.Description,
+			GroupId:     groupId,
+			Id:          id,
+			PayerId:     rec.PayerId,
+			Value:       rec.Value,
+			Split:       rec.Split,
+			RecurringId: recurringId,
+		}
+		g.categorize(&expense, rec.Category)
+		return newEvent(eventRecurringOccurred, occurrencePayload{RecurringId: recurringId, Date: date, Expense: expense})
+	})
+	return err
+}
+
+// startRecurringScheduler roda runRecurring logo ao subir e depois periodicamente
+func (app *AppConfig) startRecurringScheduler(ctx context.Context, interval time.Duration) {
+	run := func() {
+		created, err := app.runRecurring(ctx, time.Now())
+		if err != nil {
+			log.Printf("Erro ao lançar despesas recorrentes: %v", err)
+		} else if created > 0 {
+			log.Printf("Recorrências: %d despesas lançadas", created)
+		}
+	}
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
+
+// --- Handlers ---
+
+type RecurringView struct {
+	RecurringExpense
+	Upcoming []string `json:"upcoming"` // próximas ocorrências
+}
+
+func recurringView(rec RecurringExpense, now time.Time, count int) RecurringView {
+	view := RecurringView{RecurringExpense: rec, Upcoming: []string{}}
+	if rec.Paused {
+		return view
+	}
+	// Procura em até dois anos (ou mais, para intervalos longos)
+	years := min(2*max(rec.Schedule.Interval, 1), maxUpcomingYears)
+	limit := utcDay(now).AddDate(years, 0, 0)
+	pending := rec
+	if yesterday := utcDay(now).AddDate(0, 0, -1).Format(time.DateOnly); pending.LastRun < yesterday {
+		pending.LastRun = yesterday
+	}
+	for _, day := range pending.dueDates(limit, count) {
+		view.Upcoming = append(view.Upcoming, day.Format(time.DateOnly))
+	}
+	return view
+}
+
+func (app *AppConfig) handleGetRecurring(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	count := 3
+	if raw := r.URL.Query().Get("upcoming"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Parâmetro upcoming inválido", http.StatusBadRequest)
+			return
+		}
+		count = min(parsed, maxUpcomingOccurrences)
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	now := time.Now()
+	views := make([]RecurringView, 0, len(group.Recurring))
+	for _, rec := range group.Recurring {
+		views = append(views, recurringView(rec, now, count))
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Id < views[j].Id })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (app *AppConfig) handlePostRecurring(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req RecurringRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if msg := req.checkStart(utcDay(time.Now()), ""); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	recurringUID := newPushID()
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if !g.MemberIds[uid] {
+			return Event{}, errNotAuthorized
+		}
+		draft := Expense{PayerId: uid, Description: req.Description, Value: req.Value, Split: req.Split}
+		if err := g.validateExpense(draft, req.Category); err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventRecurringSet, recurringPayload{Recurring: RecurringExpense{
+			Id:          recurringUID,
+			Description: req.Description,
+			Category:    g.canonicalCategory(req.Category),
+			Value:       req.Value,
+			PayerId:     uid,
+			Split:       req.Split,
+			Schedule:    req.Schedule,
+			StartDate:   req.StartDate,
+			EndDate:     req.EndDate,
+		}})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao criar recorrência")
+		return
+	}
+	// Ocorrências que já venceram (início no passado ou hoje) entram na próxima passada do agendador
+	rec := group.Recurring[recurringUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(rec.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recurringView(rec, time.Now(), 3))
+}
+
+// updateRecurring aplica change ao modelo, exigindo If-Match e que quem pede
+// seja o pagador
+func (app *AppConfig) updateRecurring(w http.ResponseWriter, r *http.Request, change func(g *Group, rec *RecurringExpense) error) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	recurringUID := chi.URLParam(r, "recurringId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		rec, exists := g.Recurring[recurringUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if uid != rec.PayerId {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, rec.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if err := change(g, &rec); err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventRecurringSet, recurringPayload{Recurring: rec})
+	})
+	if errors.Is(err, errNoChanges) {
+		// Já estava no estado pedido: devolve o modelo atual
+		group, err = app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	}
+	if err != nil {
+		writeGroupError(w, err, "Erro ao alterar recorrência")
+		return
+	}
+	rec := group.Recurring[recurringUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(rec.Version))
+	json.NewEncoder(w).Encode(recurringView(rec, time.Now(), 3))
+}
+
+// handlePutRecurring altera as próximas ocorrências; as já lançadas continuam
+// como estão e podem ser editadas como qualquer despesa
+func (app *AppConfig) handlePutRecurring(w http.ResponseWriter, r *http.Request) {
+	var req RecurringRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	app.updateRecurring(w, r, func(g *Group, rec *RecurringExpense) error {
+		if msg := req.checkStart(utcDay(time.Now()), rec.StartDate); msg != "" {
+			e := &ValidationError{}
+			e.add("startDate", msg)
+			return e.err()
+		}
+		draft := Expense{PayerId: rec.PayerId, Description: req.Description, Value: req.Value, Split: req.Split}
+		if err := g.validateExpense(draft, req.Category); err != nil {
+			return err
+		}
+		rec.Description, rec.Category, rec.Value = req.Description, g.canonicalCategory(req.Category), req.Value
+		rec.Split, rec.Schedule, rec.StartDate, rec.EndDate = req.Split, req.Schedule, req.StartDate, req.EndDate
+		return nil
+	})
+}
+
+func (app *AppConfig) handlePauseRecurring(w http.ResponseWriter, r *http.Request) {
+	app.updateRecurring(w, r, func(_ *Group, rec *RecurringExpense) error {
+		if rec.Paused {
+			return errNoChanges
+		}
+		rec.Paused = true
+		return nil
+	})
+}
+
+// handleResumeRecurring retoma o modelo a partir de hoje: ocorrências que
+// venceram durante a pausa não são lançadas
+func (app *AppConfig) handleResumeRecurring(w http.ResponseWriter, r *http.Request) {
+	app.updateRecurring(w, r, func(_ *Group, rec *RecurringExpense) error {
+		if !rec.Paused {
+			return errNoChanges
+		}
+		rec.Paused = false
+		if yesterday := utcDay(time.Now()).AddDate(0, 0, -1).Format(time.DateOnly); rec.LastRun < yesterday {
+			rec.LastRun = yesterday
+		}
+		return nil
+	})
+}
+
+// handleSkipOccurrence pula uma ocorrência futura (ainda não lançada)
+func (app *AppConfig) handleSkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	var req SkipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	day, err := parseDay(req.Date)
+	if err != nil {
+		http.Error(w, "Data inválida (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	app.updateRecurring(w, r, func(_ *Group, rec *RecurringExpense) error {
+		start, _ := parseDay(rec.StartDate)
+		if req.Date <= rec.LastRun || !rec.Schedule.dueOn(day, start) || (rec.EndDate != "" && req.Date > rec.EndDate) {
+			return errInvalidOccurrence
+		}
+		if slices.Contains(rec.Skipped, req.Date) {
+			return errNoChanges
+		}
+		// Datas já passadas não precisam mais ficar na lista
+		rec.Skipped = slices.DeleteFunc(append(rec.Skipped, req.Date), func(d string) bool { return d <= rec.LastRun })
+		sort.Strings(rec.Skipped)
+		return nil
+	})
+}
+
+func (app *AppConfig) handleDeleteRecurring(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	recurringUID := chi.URLParam(r, "recurringId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	_, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		rec, exists := g.Recurring[recurringUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if uid != rec.PayerId {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, rec.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventRecurringRemoved, deletionPayload{Id: recurringUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao remover recorrência")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(true)
+}
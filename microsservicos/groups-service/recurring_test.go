@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurringCheckStart(t *testing.T) {
+	today := day("2026-03-10")
+	tests := []struct {
+		name    string
+		start   string
+		current string
+		wantErr bool
+	}{
+		{"hoje", "2026-03-10", "", false},
+		{"no futuro", "2026-06-01", "", false},
+		{"no limite de 31 dias", "2026-02-07", "", false},
+		{"antes do limite", "2026-02-06", "", true},
+		{"anos atrás", "2020-01-01", "", true},
+		{"data de início mantida na edição", "2025-01-01", "2025-01-01", false},
+		{"data de início alterada para o passado", "2025-02-01", "2025-01-01", true},
+	}
+	for _, tt := range tests {
+		req := RecurringRequest{StartDate: tt.start}
+		if msg := req.checkStart(today, tt.current); (msg != "") != tt.wantErr {
+			t.Errorf("%s: checkStart() = %q, quer erro = %v", tt.name, msg, tt.wantErr)
+		}
+	}
+}
+
+func TestRecurringDueDates(t *testing.T) {
+	monthly := Schedule{Frequency: frequencyMonthly, Interval: 1, DayOfMonth: 5}
+	tests := []struct {
+		name  string
+		rec   RecurringExpense
+		until string
+		limit int
+		want  []string
+	}{
+		{"desde o início", RecurringExpense{Schedule: monthly, StartDate: "2026-01-05"}, "2026-03-10", 10,
+			[]string{"2026-01-05", "2026-02-05", "2026-03-05"}},
+		{"depois da última execução", RecurringExpense{Schedule: monthly, StartDate: "2026-01-05", LastRun: "2026-01-05"}, "2026-03-10", 10,
+			[]string{"2026-02-05", "2026-03-05"}},
+		{"ocorrência pulada", RecurringExpense{Schedule: monthly, StartDate: "2026-01-05", Skipped: []string{"2026-02-05"}}, "2026-03-10", 10,
+			[]string{"2026-01-05", "2026-03-05"}},
+		{"até a data final", RecurringExpense{Schedule: monthly, StartDate: "2026-01-05", EndDate: "2026-02-05"}, "2026-03-10", 10,
+			[]string{"2026-01-05", "2026-02-05"}},
+		{"limite de ocorrências", RecurringExpense{Schedule: monthly, StartDate: "2026-01-05"}, "2026-03-10", 1,
+			[]string{"2026-01-05"}},
+		{"início no futuro", RecurringExpense{Schedule: monthly, StartDate: "2026-04-05"}, "2026-03-10", 10, nil},
+		{"data de início inválida", RecurringExpense{Schedule: monthly, StartDate: "ontem"}, "2026-03-10", 10, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range tt.rec.dueDates(day(tt.until), tt.limit) {
+			got = append(got, d.Format(time.DateOnly))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: dueDates() = %v, quer %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: dueDates() = %v, quer %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	roleMember = "member"
+	// Tesoureiros administram o grupo (veja canAdminister)
+	roleTreasurer = "treasurer"
+)
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+type roleAssignment struct {
+	UserId string `json:"userId"`
+	Role   string `json:"role"`
+}
+
+// role devolve o papel do membro; o dono do grupo é sempre tesoureiro
+func (g *Group) role(uid string) string {
+	if uid == g.OwnerId {
+		return roleTreasurer
+	}
+	if role := g.Roles[uid]; role != "" {
+		return role
+	}
+	return roleMember
+}
+
+// canAdminister indica se uid administra o grupo: é membro e tesoureiro (o dono
+// sempre é). Só quem administra lança em nome de outros membros e mexe no que
+// vale para o grupo todo, como categorias e regras de categorização.
+func (g *Group) canAdminister(uid string) bool {
+	return g.MemberIds[uid] && g.role(uid) == roleTreasurer
+}
+
+// handleSetMemberRole define o papel de um membro; só o dono do grupo pode
+func (app *AppConfig) handleSetMemberRole(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if req.Role != roleMember && req.Role != roleTreasurer {
+		http.Error(w, "Papel deve ser member ou treasurer", http.StatusBadRequest)
+		return
+	}
+	memberId := chi.URLParam(r, "memberId")
+	ifMatch := r.Header.Get("If-Match")
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if g.OwnerId != uid {
+			return Event{}, errNotAuthorized
+		}
+		if !g.MemberIds[memberId] {
+			return Event{}, errRecordNotFound
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, g.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if memberId == g.OwnerId {
+			invalid := &ValidationError{}
+			invalid.add("role", "O dono do grupo é sempre tesoureiro")
+			return Event{}, invalid
+		}
+		if g.role(memberId) == req.Role {
+			return Event{}, errNoChanges
+		}
+		return newEvent(eventMemberRoleSet, roleAssignment{UserId: memberId, Role: req.Role})
+	})
+	if err != nil && !errors.Is(err, errNoChanges) {
+		writeGroupError(w, err, "Erro ao definir papel")
+		return
+	}
+	if group != nil {
+		w.Header().Set("ETag", formatETag(group.Version))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roleAssignment{UserId: memberId, Role: req.Role})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestRolePermissions(t *testing.T) {
+	g := &Group{
+		OwnerId:   "dono",
+		MemberIds: map[string]bool{"dono": true, "tes": true, "membro": true},
+		Roles:     map[string]string{"tes": roleTreasurer, "ex": roleTreasurer},
+	}
+	tests := []struct {
+		uid       string
+		wantRole  string
+		wantAdmin bool
+	}{
+		{"dono", roleTreasurer, true},
+		{"tes", roleTreasurer, true},
+		{"membro", roleMember, false},
+		// Papel de quem não é mais membro não vale
+		{"ex", roleTreasurer, false},
+		{"estranho", roleMember, false},
+	}
+	for _, tt := range tests {
+		if got := g.role(tt.uid); got != tt.wantRole {
+			t.Errorf("role(%s) = %s, quer %s", tt.uid, got, tt.wantRole)
+		}
+		if got := g.canAdminister(tt.uid); got != tt.wantAdmin {
+			t.Errorf("canAdminister(%s) = %v, quer %v", tt.uid, got, tt.wantAdmin)
+		}
+	}
+}
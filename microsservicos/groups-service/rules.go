@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxRulePattern = 200
+
+// CategoryRule atribui Category a despesas criadas sem categoria. Todas as
+// condições preenchidas precisam valer: alguma das palavras-chave na descrição,
+// a expressão regular (sem diferenciar maiúsculas), o pagador e a faixa de valor.
+// Regras são testadas por Priority crescente.
+type CategoryRule struct {
+	Id       string   `json:"id"`
+	Category string   `json:"category"`
+	Keywords []string `json:"keywords,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	PayerId  string   `json:"payerId,omitempty"`
+	MinValue *float64 `json:"minValue,omitempty"`
+	MaxValue *float64 `json:"maxValue,omitempty"`
+	Priority int      `json:"priority"`
+	Version  int64    `json:"version"`
+}
+
+type RuleRequest struct {
+	Category string   `json:"category"`
+	Keywords []string `json:"keywords"`
+	Pattern  string   `json:"pattern"`
+	PayerId  string   `json:"payerId"`
+	MinValue *float64 `json:"minValue"`
+	MaxValue *float64 `json:"maxValue"`
+	Priority int      `json:"priority"`
+}
+
+// validate normaliza o pedido e devolve a mensagem de erro, se houver
+func (req *RuleRequest) validate() string {
+	req.Category = strings.Join(strings.Fields(req.Category), " ")
+	keywords := req.Keywords[:0]
+	for _, k := range req.Keywords {
+		if k = normalizeCategory(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	req.Keywords = keywords
+	switch {
+	case req.Category == "":
+		return "Categoria obrigatória"
+	case len(req.Keywords) == 0 && req.Pattern == "" && req.PayerId == "" && req.MinValue == nil && req.MaxValue == nil:
+		return "A regra precisa de ao menos uma condição"
+	case len(req.Pattern) > maxRulePattern:
+		return "Expressão regular muito longa"
+	case req.MinValue != nil && req.MaxValue != nil && *req.MinValue > *req.MaxValue:
+		return "Valor mínimo maior que o máximo"
+	}
+	if req.Pattern != "" {
+		if _, err := regexp.Compile("(?i)" + req.Pattern); err != nil {
+			return "Expressão regular inválida"
+		}
+	}
+	return ""
+}
+
+// ruleCategory confere a categoria da regra contra o estado atual do grupo e
+// devolve o nome oficial, como em checkBudget: uma regra não pode gravar uma
+// categoria que uma despesa não aceitaria
+func (g *Group) ruleCategory(name string) (string, error) {
+	if !g.knownCategory(name) {
+		e := &ValidationError{}
+		e.add("category", "Categoria desconhecida")
+		return "", e
+	}
+	return g.canonicalCategory(name), nil
+}
+
+// compiledRule é uma regra com a expressão regular já compilada
+type compiledRule struct {
+	CategoryRule
+	pattern *regexp.Regexp
+}
+
+// ruleMatcher guarda as regras na ordem em que são testadas; é montado uma vez
+// por operação para não compilar as expressões a cada despesa
+type ruleMatcher []compiledRule
+
+func (rule compiledRule) matches(description, payerId string, value float64) bool {
+	if rule.PayerId != "" && rule.PayerId != payerId {
+		return false
+	}
+	if (rule.MinValue != nil && value < *rule.MinValue) || (rule.MaxValue != nil && value > *rule.MaxValue) {
+		return false
+	}
+	if len(rule.Keywords) > 0 {
+		text, found := normalizeCategory(description), false
+		for _, k := range rule.Keywords {
+			if strings.Contains(text, k) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return rule.pattern == nil || rule.pattern.MatchString(description)
+}
+
+// sortedRules devolve as regras na ordem em que são testadas
+func (g *Group) sortedRules() []CategoryRule {
+	rules := make([]CategoryRule, 0, len(g.Rules))
+	for _, rule := range g.Rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Id < rules[j].Id
+	})
+	return rules
+}
+
+// ruleMatcher compila as regras do grupo. Uma expressão inválida (gravada antes
+// da validação atual) faz a regra nunca se aplicar.
+func (g *Group) ruleMatcher() ruleMatcher {
+	sorted := g.sortedRules()
+	m := make(ruleMatcher, 0, len(sorted))
+	for _, rule := range sorted {
+		c := compiledRule{CategoryRule: rule}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile("(?i)" + rule.Pattern)
+			if err != nil {
+				continue
+			}
+			c.pattern = re
+		}
+		m = append(m, c)
+	}
+	return m
+}
+
+// match devolve a primeira regra que se aplica à despesa
+func (m ruleMatcher) match(description, payerId string, value float64) (CategoryRule, bool) {
+	for _, rule := range m {
+		if rule.matches(description, payerId, value) {
+			return rule.CategoryRule, true
+		}
+	}
+	return CategoryRule{}, false
+}
+
+// matchRule devolve a primeira regra que se aplica a uma única despesa
+func (g *Group) matchRule(description, payerId string, value float64) (CategoryRule, bool) {
+	return g.ruleMatcher().match(description, payerId, value)
+}
+
+// categorize preenche a categoria de uma despesa: a informada (com o nome
+// oficial, se for gerenciada) ou, se vazia, a da primeira regra que se aplica.
+// Sugestões do classificador nunca são aplicadas aqui, só em handleCategorize.
+func (g *Group) categorize(exp *Expense, requested string) {
+	category := g.canonicalCategory(requested)
+	if category != "" && category == exp.Category {
+		// Edição que manteve a categoria: preserva a origem
+		return
+	}
+	exp.Category, exp.CategorySource = category, ""
+	if category != "" {
+		return
+	}
+	if rule, ok := g.matchRule(exp.Description, exp.PayerId, exp.Value); ok {
+		exp.Category = g.canonicalCategory(rule.Category)
+		exp.CategorySource = categorySourceRule + rule.Id
+	}
+}
+
+func (app *AppConfig) handleGetRules(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group.sortedRules())
+}
+
+func (app *AppConfig) handlePostRule(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	ruleUID := newPushID()
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		category, err := g.ruleCategory(req.Category)
+		if err != nil {
+			return Event{}, err
+		}
+		return newEvent(eventRuleSet, rulePayload{Rule: CategoryRule{
+			Id:       ruleUID,
+			Category: category,
+			Keywords: req.Keywords,
+			Pattern:  req.Pattern,
+			PayerId:  req.PayerId,
+			MinValue: req.MinValue,
+			MaxValue: req.MaxValue,
+			Priority: req.Priority,
+		}})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao criar regra")
+		return
+	}
+	rule := group.Rules[ruleUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(rule.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (app *AppConfig) handlePutRule(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	ruleUID := chi.URLParam(r, "ruleId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		rule, exists := g.Rules[ruleUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, rule.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		category, err := g.ruleCategory(req.Category)
+		if err != nil {
+			return Event{}, err
+		}
+		rule.Category, rule.Keywords, rule.Pattern = category, req.Keywords, req.Pattern
+		rule.PayerId, rule.MinValue, rule.MaxValue, rule.Priority = req.PayerId, req.MinValue, req.MaxValue, req.Priority
+		return newEvent(eventRuleSet, rulePayload{Rule: rule})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao editar regra")
+		return
+	}
+	rule := group.Rules[ruleUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(rule.Version))
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (app *AppConfig) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	ruleUID := chi.URLParam(r, "ruleId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	_, _, err := app.execute(r.Context(), chi.URLParam(r, "uid"), uid, func(g *Group) (Event, error) {
+		rule, exists := g.Rules[ruleUID]
+		if !exists {
+			return Event{}, errRecordNotFound
+		}
+		if !g.canAdminister(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, rule.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		return newEvent(eventRuleRemoved, deletionPayload{Id: ruleUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao remover regra")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(true)
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestRuleMatcher(t *testing.T) {
+	min, max := 10.0, 100.0
+	g := &Group{Rules: map[string]CategoryRule{
+		"r1": {Id: "r1", Category: "Mercado", Keywords: []string{"mercado"}, Priority: 2},
+		"r2": {Id: "r2", Category: "Transporte", Pattern: `^uber\b`, Priority: 1},
+		"r3": {Id: "r3", Category: "Lazer", PayerId: "ana", MinValue: &min, MaxValue: &max, Priority: 3},
+		// Expressão inválida gravada antes da validação: nunca se aplica
+		"r4": {Id: "r4", Category: "Quebrada", Pattern: `(`, Priority: 0},
+		// Mesma prioridade: desempata pelo id
+		"r0": {Id: "r0", Category: "Feira", Keywords: []string{"feira"}, Priority: 2},
+	}}
+	m := g.ruleMatcher()
+	if len(m) != 4 {
+		t.Fatalf("ruleMatcher tem %d regras, quer 4", len(m))
+	}
+	tests := []struct {
+		description string
+		payerId     string
+		value       float64
+		want        string
+	}{
+		{"Mercado da esquina", "bia", 50, "r1"},
+		{"UBER para o centro", "bia", 50, "r2"},
+		{"uber no mercado", "bia", 50, "r2"},
+		{"feira no mercado", "bia", 50, "r0"},
+		{"cinema", "ana", 50, "r3"},
+		{"cinema", "ana", 5, ""},
+		{"cinema", "ana", 150, ""},
+		{"cinema", "bia", 50, ""},
+		{"superuber", "bia", 50, ""},
+	}
+	for _, tt := range tests {
+		// Sem regra, match devolve uma regra vazia
+		rule, _ := m.match(tt.description, tt.payerId, tt.value)
+		if got := rule.Id; got != tt.want {
+			t.Errorf("match(%q, %s, %v) = %q, quer %q", tt.description, tt.payerId, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRuleCategory(t *testing.T) {
+	managed := &Group{Categories: map[string]Category{
+		"c1": {Id: "c1", Name: "Mercado"},
+	}}
+	tests := []struct {
+		name     string
+		group    *Group
+		category string
+		want     string
+		wantErr  bool
+	}{
+		{"nome oficial", managed, "Mercado", "Mercado", false},
+		{"grafia equivalente", managed, "  mercado ", "Mercado", false},
+		{"desconhecida com categorias gerenciadas", managed, "Mercdo", "", true},
+		{"qualquer nome sem categorias gerenciadas", &Group{}, "Feira", "Feira", false},
+	}
+	for _, tt := range tests {
+		got, err := tt.group.ruleCategory(tt.category)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: ruleCategory(%q) = %v, quer erro = %v", tt.name, tt.category, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: ruleCategory(%q) = %q, quer %q", tt.name, tt.category, got, tt.want)
+		}
+	}
+}
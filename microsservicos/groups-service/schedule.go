@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	frequencyMonthly = "monthly"
+	frequencyWeekly  = "weekly"
+	frequencyCron    = "cron"
+
+	// Janela em que uma expressão de cron precisa ter alguma data (cobre o 29
+	// de fevereiro)
+	cronSearchDays = 5 * 366
+)
+
+// Schedule define as datas de uma despesa recorrente.
+//   - monthly: todo DayOfMonth (padrão: o dia da data de início) a cada Interval meses;
+//     em meses mais curtos vale o último dia
+//   - weekly: todo Weekday (0 = domingo; padrão: o da data de início) a cada Interval semanas
+//   - cron: expressão de cron de 5 campos; só dia do mês, mês e dia da semana são
+//     considerados, já que as ocorrências são diárias
+type Schedule struct {
+	Frequency  string `json:"frequency"`
+	Interval   int    `json:"interval,omitempty"`
+	DayOfMonth int    `json:"dayOfMonth,omitempty"`
+	Weekday    *int   `json:"weekday,omitempty"`
+	Cron       string `json:"cron,omitempty"`
+}
+
+// validate normaliza a regra com base na data de início
+func (s *Schedule) validate(start time.Time) error {
+	if s.Interval == 0 {
+		s.Interval = 1
+	}
+	if s.Interval < 0 || s.Interval > 52 {
+		return fmt.Errorf("intervalo inválido")
+	}
+	switch s.Frequency {
+	case frequencyMonthly:
+		if s.DayOfMonth == 0 {
+			s.DayOfMonth = start.Day()
+		}
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return fmt.Errorf("dia do mês inválido")
+		}
+	case frequencyWeekly:
+		if s.Weekday == nil {
+			weekday := int(start.Weekday())
+			s.Weekday = &weekday
+		}
+		if *s.Weekday < 0 || *s.Weekday > 6 {
+			return fmt.Errorf("dia da semana inválido")
+		}
+	case frequencyCron:
+		c, err := parseCron(s.Cron)
+		if err != nil {
+			return err
+		}
+		if !c.matchesWithin(start, cronSearchDays) {
+			return fmt.Errorf("a expressão de cron não tem nenhuma data")
+		}
+	default:
+		return fmt.Errorf("frequência deve ser monthly, weekly ou cron")
+	}
+	return nil
+}
+
+// dueOn indica se há ocorrência no dia (UTC, meia-noite); start é a data de início
+func (s Schedule) dueOn(day, start time.Time) bool {
+	return s.dueFunc(start)(day)
+}
+
+// dueFunc prepara a regra para testar vários dias seguidos, como dueOn; a
+// expressão de cron é lida uma vez só
+func (s Schedule) dueFunc(start time.Time) func(day time.Time) bool {
+	interval := max(s.Interval, 1)
+	switch s.Frequency {
+	case frequencyMonthly:
+		return func(day time.Time) bool {
+			months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+			if day.Before(start) || months%interval != 0 {
+				return false
+			}
+			lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+			return day.Day() == min(s.DayOfMonth, lastDay)
+		}
+	case frequencyWeekly:
+		return func(day time.Time) bool {
+			if day.Before(start) || s.Weekday == nil || int(day.Weekday()) != *s.Weekday {
+				return false
+			}
+			weeks := int(weekStart(day).Sub(weekStart(start)).Hours() / (24 * 7))
+			return weeks%interval == 0
+		}
+	case frequencyCron:
+		c, err := parseCron(s.Cron)
+		if err != nil {
+			break
+		}
+		return func(day time.Time) bool {
+			return !day.Before(start) && c.matches(day)
+		}
+	}
+	return func(time.Time) bool { return false }
+}
+
+// weekStart devolve a segunda-feira da semana do dia
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// cronSpec guarda os campos de dia de uma expressão de cron
+type cronSpec struct {
+	dom, month, dow map[int]bool
+	anyDom, anyDow  bool
+}
+
+// parseCron aceita "min hora dia-do-mês mês dia-da-semana" com *, listas,
+// intervalos e passos (ex. "0 9 1,15 * *", "0 0 * * 1-5", "0 0 */2 * *")
+func parseCron(expr string) (cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("expressão de cron deve ter 5 campos")
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return cronSpec{}, fmt.Errorf("campo %d da expressão de cron: %w", i+1, err)
+		}
+		sets[i] = set
+	}
+	// 7 também é domingo
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return cronSpec{
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: strings.HasPrefix(fields[2], "*"),
+		anyDow: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, lo, hi int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("passo inválido: %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+		from, to := lo, hi
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("valor inválido: %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("valor inválido: %q", part)
+				}
+			} else if step > 1 {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return nil, fmt.Errorf("valor fora do intervalo: %q", part)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matchesWithin indica se algum dos days dias a partir de from é uma data da expressão
+func (c cronSpec) matchesWithin(from time.Time, days int) bool {
+	for day := from; days > 0; day, days = day.AddDate(0, 0, 1), days-1 {
+		if c.matches(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches segue a regra do cron: se dia do mês e dia da semana forem ambos
+// restritos (não começam com *), basta um dos dois
+func (c cronSpec) matches(day time.Time) bool {
+	if !c.month[int(day.Month())] {
+		return false
+	}
+	domOk, dowOk := c.dom[day.Day()], c.dow[int(day.Weekday())]
+	if c.anyDom || c.anyDow {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
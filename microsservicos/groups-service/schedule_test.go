@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func day(raw string) time.Time {
+	d, err := parseDay(raw)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 9 1,15 * *", false},
+		{"0 0 * * 1-5", false},
+		{"0 0 */2 * *", false},
+		{"0 0 5/10 * *", false},
+		{"0 0 * * 7", false},
+		{"0 0 * *", true},
+		{"0 0 32 * *", true},
+		{"0 0 * 13 *", true},
+		{"0 0 */0 * *", true},
+		{"0 0 10-5 * *", true},
+		{"0 0 a * *", true},
+		{"60 0 * * *", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseCron(tt.expr); (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) = %v, quer erro = %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		day  string
+		want bool
+	}{
+		{"0 9 1,15 * *", "2026-03-15", true},
+		{"0 9 1,15 * *", "2026-03-16", false},
+		// 2026-03-09 é segunda, 2026-03-14 é sábado
+		{"0 0 * * 1-5", "2026-03-09", true},
+		{"0 0 * * 1-5", "2026-03-14", false},
+		{"0 0 */2 * *", "2026-03-03", true},
+		{"0 0 */2 * *", "2026-03-04", false},
+		// 7 também é domingo
+		{"0 0 * * 7", "2026-03-15", true},
+		{"0 0 1 6 *", "2026-03-01", false},
+		// Dia do mês e da semana restritos: basta um dos dois
+		{"0 0 13 * 5", "2026-03-13", true},
+		{"0 0 13 * 5", "2026-03-20", true},
+		{"0 0 13 * 5", "2026-03-21", false},
+		// Com um deles livre, valem os dois
+		{"0 0 13 * *", "2026-03-20", false},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) = %v", tt.expr, err)
+		}
+		if got := c.matches(day(tt.day)); got != tt.want {
+			t.Errorf("%q em %s = %v, quer %v", tt.expr, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	weekday := 9
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{"mensal com o dia do início", Schedule{Frequency: frequencyMonthly}, false},
+		{"semanal", Schedule{Frequency: frequencyWeekly, Interval: 2}, false},
+		{"cron", Schedule{Frequency: frequencyCron, Cron: "0 0 1 * *"}, false},
+		{"29 de fevereiro existe", Schedule{Frequency: frequencyCron, Cron: "0 0 29 2 *"}, false},
+		{"cron sem nenhuma data", Schedule{Frequency: frequencyCron, Cron: "0 0 31 2 *"}, true},
+		{"cron inválido", Schedule{Frequency: frequencyCron, Cron: "todo dia"}, true},
+		{"intervalo negativo", Schedule{Frequency: frequencyMonthly, Interval: -1}, true},
+		{"intervalo grande demais", Schedule{Frequency: frequencyMonthly, Interval: 53}, true},
+		{"dia do mês inválido", Schedule{Frequency: frequencyMonthly, DayOfMonth: 32}, true},
+		{"dia da semana inválido", Schedule{Frequency: frequencyWeekly, Weekday: &weekday}, true},
+		{"frequência desconhecida", Schedule{Frequency: "daily"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.schedule.validate(day("2026-03-10")); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() = %v, quer erro = %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	s := Schedule{Frequency: frequencyWeekly}
+	s.validate(day("2026-03-10"))
+	if s.Interval != 1 || s.Weekday == nil || *s.Weekday != int(time.Tuesday) {
+		t.Errorf("regra normalizada = %+v, quer intervalo 1 às terças", s)
+	}
+}
+
+func TestScheduleDueOn(t *testing.T) {
+	friday := int(time.Friday)
+	tests := []struct {
+		name     string
+		schedule Schedule
+		start    string
+		due      []string
+		notDue   []string
+	}{
+		{
+			"mensal no último dia em meses curtos",
+			Schedule{Frequency: frequencyMonthly, Interval: 1, DayOfMonth: 31},
+			"2026-01-31",
+			[]string{"2026-01-31", "2026-02-28", "2026-04-30"},
+			[]string{"2026-02-27", "2026-04-29", "2025-12-31"},
+		},
+		{
+			"a cada dois meses",
+			Schedule{Frequency: frequencyMonthly, Interval: 2, DayOfMonth: 5},
+			"2026-01-05",
+			[]string{"2026-01-05", "2026-03-05"},
+			[]string{"2026-02-05", "2026-04-05"},
+		},
+		{
+			"sextas a cada duas semanas",
+			Schedule{Frequency: frequencyWeekly, Interval: 2, Weekday: &friday},
+			"2026-03-04",
+			[]string{"2026-03-06", "2026-03-20"},
+			[]string{"2026-03-13", "2026-03-05"},
+		},
+		{
+			"cron não vale antes do início",
+			Schedule{Frequency: frequencyCron, Cron: "0 0 1 * *"},
+			"2026-02-15",
+			[]string{"2026-03-01"},
+			[]string{"2026-02-01"},
+		},
+		{
+			"cron inválido nunca vence",
+			Schedule{Frequency: frequencyCron, Cron: "x"},
+			"2026-01-01",
+			nil,
+			[]string{"2026-01-01"},
+		},
+	}
+	for _, tt := range tests {
+		start := day(tt.start)
+		due := tt.schedule.dueFunc(start)
+		for _, d := range tt.due {
+			if !due(day(d)) || !tt.schedule.dueOn(day(d), start) {
+				t.Errorf("%s: %s deveria vencer", tt.name, d)
+			}
+		}
+		for _, d := range tt.notDue {
+			if due(day(d)) || tt.schedule.dueOn(day(d), start) {
+				t.Errorf("%s: %s não deveria vencer", tt.name, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Compensation quita, sem transferência de dinheiro, a dívida entre duas
+// pessoas em um grupo
+type Compensation struct {
+	GroupId  string  `json:"groupId"`
+	PayerId  string  `json:"payerId"`
+	TargetId string  `json:"targetId"`
+	Value    float64 `json:"value"`
+}
+
+// SettlementRequest é o lado sem dinheiro de um acerto entre grupos: dívidas
+// com a mesma pessoa em grupos diferentes quitadas umas contra as outras. A
+// transferência do valor líquido é lançada à parte, como pagamento comum.
+type SettlementRequest struct {
+	SettlementId   string         `json:"settlementId"`
+	CounterpartyId string         `json:"counterpartyId"`
+	Compensations  []Compensation `json:"compensations"`
+}
+
+type SettlementResult struct {
+	SettlementId string    `json:"settlementId"`
+	Payments     []Payment `json:"payments"`
+}
+
+// validate confere que cada compensação é entre quem chama e a contraparte e
+// que, somadas, elas se anulam: ninguém paga nem recebe nada no total
+func (req SettlementRequest) validate(uid string) error {
+	e := &ValidationError{}
+	if req.SettlementId == "" {
+		e.add("settlementId", "Identificador do acerto obrigatório")
+	}
+	if req.CounterpartyId == "" || req.CounterpartyId == uid {
+		e.add("counterpartyId", "Contraparte inválida")
+	}
+	if len(req.Compensations) == 0 {
+		e.add("compensations", "Informe ao menos uma compensação")
+	}
+	var paid, received float64
+	groups := map[string]bool{}
+	for i, c := range req.Compensations {
+		field := fmt.Sprintf("compensations[%d]", i)
+		switch {
+		case c.GroupId == "":
+			e.add(field+".groupId", "Grupo obrigatório")
+		case groups[c.GroupId]:
+			e.add(field+".groupId", "Grupo repetido")
+		}
+		groups[c.GroupId] = true
+		switch {
+		case c.PayerId == uid && c.TargetId == req.CounterpartyId:
+			paid += c.Value
+		case c.PayerId == req.CounterpartyId && c.TargetId == uid:
+			received += c.Value
+		default:
+			e.add(field, "A compensação deve ser entre você e a contraparte")
+		}
+		e.checkAmount(field+".value", c.Value)
+	}
+	if math.Abs(paid-received) > 0.005 {
+		e.add("compensations", "As compensações nos dois sentidos devem ter o mesmo total")
+	}
+	return e.err()
+}
+
+// compensationEvent decide o lançamento da compensação no grupo. O pagamento
+// nasce pendente, como os comuns, e só conta nos saldos quando a contraparte o
+// confirma: quem chama não pode quitar sozinho dívidas da outra pessoa.
+// Repetir o acerto não duplica o lançamento.
+func compensationEvent(g *Group, uid, settlementId, paymentId string, c Compensation, now string) (Event, error) {
+	if !g.MemberIds[uid] {
+		return Event{}, errNotAuthorized
+	}
+	for _, p := range g.Payments {
+		if p.Compensation && p.SettlementId == settlementId && p.DeletedAt == "" {
+			return Event{}, errNoChanges
+		}
+	}
+	if err := g.validatePayment(c.PayerId, PaymentRequest{TargetId: c.TargetId, Value: c.Value}); err != nil {
+		return Event{}, err
+	}
+	payment := Payment{
+		Date:         now,
+		GroupId:      c.GroupId,
+		Id:           paymentId,
+		PayerId:      c.PayerId,
+		TargetId:     c.TargetId,
+		Value:        c.Value,
+		SettlementId: settlementId,
+		Status:       paymentPending,
+		Compensation: true,
+	}
+	if c.PayerId != uid {
+		payment.RecordedBy = uid
+	}
+	return newEvent(eventSettlementRecorded, paymentPayload{Payment: payment})
+}
+
+// handlePostSettlement lança as compensações de um acerto entre grupos. Todos
+// os grupos são conferidos antes de qualquer lançamento; se um lançamento
+// falhar no meio, repetir o pedido lança só os grupos que faltaram.
+func (app *AppConfig) handlePostSettlement(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	var req SettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(uid); err != nil {
+		writeGroupError(w, err, "Erro ao registrar acerto")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	paymentIds := make([]string, len(req.Compensations))
+	for i, c := range req.Compensations {
+		paymentIds[i] = newPushID()
+		group, err := app.getGroup(r.Context(), c.GroupId)
+		if err != nil {
+			writeGroupError(w, errGroupNotFound, "Erro ao registrar acerto")
+			return
+		}
+		group.ensureMaps()
+		if _, err := compensationEvent(group, uid, req.SettlementId, paymentIds[i], c, now); err != nil && !errors.Is(err, errNoChanges) {
+			writeGroupError(w, err, "Erro ao registrar acerto")
+			return
+		}
+	}
+
+	result := SettlementResult{SettlementId: req.SettlementId, Payments: []Payment{}}
+	for i, c := range req.Compensations {
+		group, _, err := app.execute(r.Context(), c.GroupId, uid, func(g *Group) (Event, error) {
+			return compensationEvent(g, uid, req.SettlementId, paymentIds[i], c, now)
+		})
+		switch {
+		case errors.Is(err, errNoChanges):
+			continue
+		case err != nil:
+			writeGroupError(w, err, "Erro ao registrar acerto")
+			return
+		}
+		result.Payments = append(result.Payments, group.Payments[paymentIds[i]])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSettlementRequestValidate(t *testing.T) {
+	comp := func(groupId, payer, target string, value float64) Compensation {
+		return Compensation{GroupId: groupId, PayerId: payer, TargetId: target, Value: value}
+	}
+	tests := []struct {
+		name string
+		req  SettlementRequest
+		ok   bool
+	}{
+		{"dois sentidos com o mesmo total", SettlementRequest{"s1", "bia", []Compensation{
+			comp("g1", "ana", "bia", 40), comp("g2", "bia", "ana", 25), comp("g3", "bia", "ana", 15),
+		}}, true},
+		{"totais diferentes", SettlementRequest{"s1", "bia", []Compensation{
+			comp("g1", "ana", "bia", 40), comp("g2", "bia", "ana", 30),
+		}}, false},
+		{"um sentido só", SettlementRequest{"s1", "bia", []Compensation{comp("g1", "ana", "bia", 40)}}, false},
+		{"terceiro envolvido", SettlementRequest{"s1", "bia", []Compensation{
+			comp("g1", "ana", "bia", 40), comp("g2", "caio", "ana", 40),
+		}}, false},
+		{"grupo repetido", SettlementRequest{"s1", "bia", []Compensation{
+			comp("g1", "ana", "bia", 40), comp("g1", "bia", "ana", 40),
+		}}, false},
+		{"valor negativo", SettlementRequest{"s1", "bia", []Compensation{
+			comp("g1", "ana", "bia", -40), comp("g2", "bia", "ana", -40),
+		}}, false},
+		{"sem settlementId", SettlementRequest{"", "bia", []Compensation{
+			comp("g1", "ana", "bia", 40), comp("g2", "bia", "ana", 40),
+		}}, false},
+		{"contraparte é quem chama", SettlementRequest{"s1", "ana", nil}, false},
+		{"sem compensações", SettlementRequest{"s1", "bia", nil}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.validate("ana")
+			var invalid *ValidationError
+			if tt.ok && err != nil {
+				t.Fatalf("validate() = %v, esperado nil", err)
+			}
+			if !tt.ok && !errors.As(err, &invalid) {
+				t.Fatalf("validate() = %v, esperado ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestCompensationEvent(t *testing.T) {
+	g := &Group{Id: "g1", MemberIds: map[string]bool{"ana": true, "bia": true}}
+	g.ensureMaps()
+	c := Compensation{GroupId: "g1", PayerId: "bia", TargetId: "ana", Value: 40}
+
+	e, err := compensationEvent(g, "ana", "s1", "p1", c, "2026-03-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("compensationEvent() = %v", err)
+	}
+	if err := g.apply(e); err != nil {
+		t.Fatalf("apply() = %v", err)
+	}
+	p := g.Payments["p1"]
+	if !p.Compensation || p.confirmed() || p.Status != paymentPending || p.RecordedBy != "ana" || p.SettlementId != "s1" {
+		t.Errorf("pagamento = %+v, esperado compensação pendente lançada por ana", p)
+	}
+	// Só a contraparte confirma, mesmo sendo ela quem paga na compensação
+	if p.canChangeStatus("ana", eventPaymentConfirmed) || !p.canChangeStatus("bia", eventPaymentConfirmed) {
+		t.Errorf("confirmação da compensação: ana = %v, bia = %v",
+			p.canChangeStatus("ana", eventPaymentConfirmed), p.canChangeStatus("bia", eventPaymentConfirmed))
+	}
+
+	// Repetir o mesmo acerto não lança de novo
+	if _, err := compensationEvent(g, "ana", "s1", "p2", c, "2026-03-01T00:00:00Z"); !errors.Is(err, errNoChanges) {
+		t.Errorf("repetição = %v, esperado errNoChanges", err)
+	}
+	if _, err := compensationEvent(g, "caio", "s2", "p3", c, "2026-03-01T00:00:00Z"); !errors.Is(err, errNotAuthorized) {
+		t.Errorf("não membro = %v, esperado errNotAuthorized", err)
+	}
+	c.TargetId = "caio"
+	var invalid *ValidationError
+	if _, err := compensationEvent(g, "bia", "s3", "p4", c, "2026-03-01T00:00:00Z"); !errors.As(err, &invalid) {
+		t.Errorf("destinatário fora do grupo = %v, esperado ValidationError", err)
+	}
+}
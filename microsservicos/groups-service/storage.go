@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Alfabeto usado pelo Firebase para gerar chaves de Push ordenáveis por tempo
+const pushChars = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+var (
+	pushMu        sync.Mutex
+	lastPushTime  int64
+	lastRandChars [12]int
+)
+
+// newPushID gera localmente uma chave no mesmo formato do Push() do RTDB,
+// permitindo montar escritas multi-caminho sem criar o nó antes.
+func newPushID() string {
+	pushMu.Lock()
+	defer pushMu.Unlock()
+
+	now := time.Now().UnixMilli()
+	duplicateTime := now == lastPushTime
+	lastPushTime = now
+
+	var id [20]byte
+	for i := 7; i >= 0; i-- {
+		id[i] = pushChars[now%64]
+		now /= 64
+	}
+
+	if !duplicateTime {
+		var buf [12]byte
+		rand.Read(buf[:])
+		for i := range lastRandChars {
+			lastRandChars[i] = int(buf[i] % 64)
+		}
+	} else {
+		// Mesmo milissegundo: incrementa os caracteres aleatórios para manter a ordem
+		i := 11
+		for ; i >= 0 && lastRandChars[i] == 63; i-- {
+			lastRandChars[i] = 0
+		}
+		if i >= 0 {
+			lastRandChars[i]++
+		}
+	}
+	for i, c := range lastRandChars {
+		id[8+i] = pushChars[c]
+	}
+	return string(id[:])
+}
+
+// multiUpdate aplica todas as escritas em uma única operação atômica na raiz do
+// banco. As chaves são caminhos completos (ex: "groups/abc/memberIds/uid").
+func (app *AppConfig) multiUpdate(ctx context.Context, updates map[string]any) error {
+	return app.DBClient.NewRef("/").Update(ctx, updates)
+}
+
+var (
+	errGroupNotFound      = errors.New("grupo não encontrado")
+	errRecordNotFound     = errors.New("registro não encontrado")
+	errNotAuthorized      = errors.New("não autorizado")
+	errPreconditionFailed = errors.New("o recurso foi modificado por outra pessoa")
+	errRetentionExpired   = errors.New("prazo para restauração expirado")
+	errDuplicateBudget    = errors.New("já existe orçamento para esta categoria e período")
+	errCategoryExists     = errors.New("já existe uma categoria com este nome")
+	errInvalidParent      = errors.New("categoria pai inválida")
+	errInvalidOccurrence  = errors.New("data não é uma ocorrência futura da recorrência")
+	errPaymentNotPending  = errors.New("o pagamento não está aguardando confirmação")
+)
+
+// writeGroupError traduz os erros de execute para respostas HTTP
+func writeGroupError(w http.ResponseWriter, err error, fallback string) {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeValidationError(w, invalid)
+	case errors.Is(err, errGroupNotFound), errors.Is(err, errRecordNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errNotAuthorized):
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+	case errors.Is(err, errPreconditionFailed):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, errRetentionExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, errLedgerConflict), errors.Is(err, errDuplicateBudget), errors.Is(err, errCategoryExists),
+		errors.Is(err, errPaymentNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errInvalidParent), errors.Is(err, errInvalidOccurrence):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
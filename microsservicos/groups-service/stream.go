@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	streamHeartbeat = 25 * time.Second
+	// Eventos aguardando envio por conexão; se o cliente não acompanhar, a
+	// conexão é encerrada e ele retoma com Last-Event-ID
+	streamBuffer = 64
+)
+
+// handleStreamGroup envia, via Server-Sent Events, as mudanças do grupo: cada
+// evento do ledger com o nome da ação do histórico (expense.created,
+// payment.deleted, member.joined, ...). O id de cada mensagem é a versão do
+// grupo; reconectando com Last-Event-ID o cliente recebe o que perdeu. Os
+// saldos não vão no stream: o cliente os pede ao serviço de análise.
+func (app *AppConfig) handleStreamGroup(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming não suportado", http.StatusInternalServerError)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+
+	// Assina antes de ler o grupo para não perder eventos entre as duas coisas
+	live := make(chan Event, streamBuffer)
+	overflow := make(chan struct{})
+	unsubscribe, err := app.Bus.Subscribe(groupSubject(groupUID), func(_ string, data []byte) {
+		var e Event
+		if json.Unmarshal(data, &e) != nil {
+			return
+		}
+		select {
+		case live <- e:
+		default:
+			select {
+			case <-overflow:
+			default:
+				close(overflow)
+			}
+		}
+	})
+	if err != nil {
+		http.Error(w, "Erro ao assinar eventos do grupo", http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	group.ensureMaps()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Retomada: reenviar o que o cliente perdeu desde Last-Event-ID
+	if lastId, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && lastId < group.Version {
+		missed, err := app.eventsAfter(r.Context(), groupUID, lastId, 0)
+		if err != nil {
+			return
+		}
+		for _, e := range missed {
+			if e.Seq > group.Version {
+				break
+			}
+			writeSSE(w, e.Seq, eventActions[e.Type], e)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-overflow:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e := <-live:
+			if e.Seq <= group.Version {
+				continue
+			}
+			if e.Seq > group.Version+1 {
+				// Evento perdido no barramento: recarrega o estado a partir do ledger
+				missed, err := app.eventsAfter(r.Context(), groupUID, group.Version, 0)
+				if err != nil {
+					log.Printf("Erro ao recuperar eventos do grupo %s: %v", groupUID, err)
+					return
+				}
+				for _, m := range missed {
+					if m.Seq > e.Seq {
+						break
+					}
+					if !app.sendStreamEvent(w, group, uid, m) {
+						return
+					}
+				}
+			} else if !app.sendStreamEvent(w, group, uid, e) {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// sendStreamEvent aplica o evento à cópia local do grupo e o envia. A
+// participação de uid é conferida de novo a cada evento: quem deixa de ser
+// membro tem a conexão encerrada sem receber mais nada.
+func (app *AppConfig) sendStreamEvent(w http.ResponseWriter, group *Group, uid string, e Event) bool {
+	if err := group.apply(e); err != nil {
+		log.Printf("Erro ao aplicar evento %d do grupo %s no stream: %v", e.Seq, e.GroupId, err)
+		return false
+	}
+	if !group.MemberIds[uid] {
+		return false
+	}
+	writeSSE(w, e.Seq, eventActions[e.Type], e)
+	return true
+}
+
+func writeSSE(w http.ResponseWriter, id int64, name string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, data)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mustEvent monta um evento já com a sequência, como execute faria
+func mustEvent(t *testing.T, seq int64, eventType string, payload any) Event {
+	t.Helper()
+	e, err := newEvent(eventType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Seq, e.GroupId, e.At = seq, "g1", 1_700_000_000_000+seq
+	return e
+}
+
+func TestSendStreamEventRechecksMembership(t *testing.T) {
+	base := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true, "bia": true}, Version: 1}
+	withoutBia := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}}
+	tests := []struct {
+		name     string
+		event    func(t *testing.T) Event
+		wantOpen bool
+	}{
+		{"evento comum é enviado", func(t *testing.T) Event {
+			return mustEvent(t, 2, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", Value: 10}})
+		}, true},
+		{"novo membro não afeta quem já era", func(t *testing.T) Event {
+			return mustEvent(t, 2, eventMemberJoined, memberPayload{UserId: "caio"})
+		}, true},
+		{"quem sai do grupo tem o stream encerrado", func(t *testing.T) Event {
+			return mustEvent(t, 2, eventGroupImported, groupPayload{Group: withoutBia})
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := base.clone()
+			w := httptest.NewRecorder()
+			open := (&AppConfig{}).sendStreamEvent(w, group, "bia", tt.event(t))
+			if open != tt.wantOpen {
+				t.Fatalf("sendStreamEvent = %v, quer %v", open, tt.wantOpen)
+			}
+			if sent := strings.Contains(w.Body.String(), "id: 2"); sent != tt.wantOpen {
+				t.Fatalf("evento enviado = %v, quer %v (%q)", sent, tt.wantOpen, w.Body.String())
+			}
+		})
+	}
+}
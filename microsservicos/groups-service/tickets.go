@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"firebase.google.com/go/v4/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// Um ticket de stream só serve para abrir uma conexão, logo em seguida
+const streamTicketTTL = 30 * time.Second
+
+var errInvalidTicket = errors.New("ticket inválido ou expirado")
+
+// StreamTicket substitui o JWT na URL do stream: o EventSource do navegador
+// não envia headers, e a URL acaba em logs e no histórico do navegador
+type StreamTicket struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// streamTicketRecord fica em stream_tickets/{sha256 do ticket}; o ticket em si
+// não é guardado
+type streamTicketRecord struct {
+	UserId    string `json:"userId"`
+	GroupId   string `json:"groupId"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func ticketPath(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return "stream_tickets/" + hex.EncodeToString(sum[:])
+}
+
+// handlePostStreamTicket emite um ticket de uso único para o stream do grupo
+func (app *AppConfig) handlePostStreamTicket(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	group, err := app.getGroup(r.Context(), groupUID)
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		http.Error(w, "Erro ao emitir ticket", http.StatusInternalServerError)
+		return
+	}
+	ticket := StreamTicket{
+		Ticket:    hex.EncodeToString(raw[:]),
+		ExpiresAt: time.Now().Add(streamTicketTTL).UnixMilli(),
+	}
+	record := streamTicketRecord{UserId: uid, GroupId: groupUID, ExpiresAt: ticket.ExpiresAt}
+	if err := app.DBClient.NewRef(ticketPath(ticket.Ticket)).Set(r.Context(), record); err != nil {
+		http.Error(w, "Erro ao emitir ticket", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// consumeStreamTicket valida o ticket e o apaga, para que não possa ser reusado
+func (app *AppConfig) consumeStreamTicket(ctx context.Context, ticket, groupId string) (string, error) {
+	var record *streamTicketRecord
+	err := app.DBClient.NewRef(ticketPath(ticket)).Transaction(ctx, func(tn db.TransactionNode) (any, error) {
+		record = nil
+		if err := tn.Unmarshal(&record); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if record == nil || record.GroupId != groupId || time.Now().UnixMilli() > record.ExpiresAt {
+		return "", errInvalidTicket
+	}
+	return record.UserId, nil
+}
+
+// streamAuth autentica o stream pelo header Authorization, como as outras
+// rotas, ou por um ticket em ?ticket=. O JWT nunca é aceito na URL.
+func (app *AppConfig) streamAuth(next http.Handler) http.Handler {
+	headerAuth := app.authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			headerAuth.ServeHTTP(w, r)
+			return
+		}
+		uid, err := app.consumeStreamTicket(r.Context(), ticket, chi.URLParam(r, "uid"))
+		if errors.Is(err, errInvalidTicket) {
+			http.Error(w, "Não autorizado: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erro ao validar ticket", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userUIDKey, uid)))
+	})
+}
+
+// purgeExpiredStreamTickets apaga os tickets emitidos e nunca usados
+func (app *AppConfig) purgeExpiredStreamTickets(ctx context.Context) (int, error) {
+	var records map[string]streamTicketRecord
+	if err := app.DBClient.NewRef("stream_tickets").Get(ctx, &records); err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+	updates := map[string]any{}
+	for key, record := range records {
+		if now > record.ExpiresAt {
+			updates["stream_tickets/"+key] = nil
+		}
+	}
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	return len(updates), app.multiUpdate(ctx, updates)
+}
+
+// startStreamTicketPurger roda purgeExpiredStreamTickets periodicamente
+func (app *AppConfig) startStreamTicketPurger(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := app.purgeExpiredStreamTickets(ctx); err != nil {
+					log.Printf("Erro ao limpar tickets de stream: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Parâmetros que carregam credenciais e não podem aparecer nos logs
+var sensitiveQueryParams = []string{"ticket", "access_token"}
+
+// redactQueryForLog esconde credenciais da query em r.RequestURI, que é o que
+// o middleware.Logger registra. Os handlers continuam lendo r.URL.
+func redactQueryForLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uri, ok := redactedURI(r.URL); ok {
+			r.RequestURI = uri
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redactedURI devolve o caminho com a query sem credenciais, e false se não
+// havia nada a esconder
+func redactedURI(u *url.URL) (string, bool) {
+	query := u.Query()
+	redacted := false
+	for _, name := range sensitiveQueryParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI(), false
+	}
+	return u.EscapedPath() + "?" + query.Encode(), true
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedactedURI(t *testing.T) {
+	tests := []struct {
+		uri          string
+		want         string
+		wantRedacted bool
+	}{
+		{"/api/groups/g1/stream?ticket=abc123", "/api/groups/g1/stream?ticket=REDACTED", true},
+		{"/api/groups/g1/stream?access_token=eyJ.x.y&foo=1", "/api/groups/g1/stream?access_token=REDACTED&foo=1", true},
+		{"/api/groups/g1/activity?limit=20&before=5", "/api/groups/g1/activity?limit=20&before=5", false},
+		{"/api/groups/g1", "/api/groups/g1", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, redacted := redactedURI(u)
+		if got != tt.want || redacted != tt.wantRedacted {
+			t.Errorf("redactedURI(%q) = %q, %v; quer %q, %v", tt.uri, got, redacted, tt.want, tt.wantRedacted)
+		}
+	}
+}
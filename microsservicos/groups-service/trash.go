@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+type TrashResponse struct {
+	Expenses []Expense `json:"expenses"`
+	Payments []Payment `json:"payments"`
+	// Tempo que um item fica na lixeira antes de ser apagado de vez
+	RetentionSeconds int64 `json:"retentionSeconds"`
+}
+
+// trashRetentionFromEnv lê TRASH_RETENTION (ex: "720h")
+func trashRetentionFromEnv() time.Duration {
+	if retention, err := time.ParseDuration(os.Getenv("TRASH_RETENTION")); err == nil && retention > 0 {
+		return retention
+	}
+	return defaultTrashRetention
+}
+
+// withoutDeleted devolve uma cópia do grupo sem despesas e pagamentos na lixeira
+func (g *Group) withoutDeleted() *Group {
+	visible := *g
+	visible.Expenses = make(map[string]Expense, len(g.Expenses))
+	for id, exp := range g.Expenses {
+		if exp.DeletedAt == "" {
+			visible.Expenses[id] = exp
+		}
+	}
+	visible.Payments = make(map[string]Payment, len(g.Payments))
+	for id, pay := range g.Payments {
+		if pay.DeletedAt == "" {
+			visible.Payments[id] = pay
+		}
+	}
+	return &visible
+}
+
+// isExpired indica se um item apagado em deletedAt já passou do prazo de retenção
+func isExpired(deletedAt string, retention time.Duration, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339Nano, deletedAt)
+	return err == nil && now.Sub(t) > retention
+}
+
+func (app *AppConfig) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	group, err := app.getGroup(r.Context(), chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "Erro ao buscar grupo", http.StatusInternalServerError)
+		return
+	}
+	if !group.MemberIds[uid] {
+		http.Error(w, "Nao autorizado", http.StatusForbidden)
+		return
+	}
+	trash := TrashResponse{
+		Expenses:         []Expense{},
+		Payments:         []Payment{},
+		RetentionSeconds: int64(app.TrashRetention.Seconds()),
+	}
+	for _, exp := range group.Expenses {
+		if exp.DeletedAt != "" {
+			trash.Expenses = append(trash.Expenses, exp)
+		}
+	}
+	for _, pay := range group.Payments {
+		if pay.DeletedAt != "" {
+			trash.Payments = append(trash.Payments, pay)
+		}
+	}
+	// Mais recentes primeiro
+	sort.Slice(trash.Expenses, func(i, j int) bool { return trash.Expenses[i].DeletedAt > trash.Expenses[j].DeletedAt })
+	sort.Slice(trash.Payments, func(i, j int) bool { return trash.Payments[i].DeletedAt > trash.Payments[j].DeletedAt })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trash)
+}
+
+func (app *AppConfig) handleRestoreExpense(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	expenseUID := chi.URLParam(r, "expenseId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		expenseData, exists := g.Expenses[expenseUID]
+		if !exists || expenseData.DeletedAt == "" {
+			return Event{}, errRecordNotFound
+		}
+		if !expenseData.managedBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, expenseData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if isExpired(expenseData.DeletedAt, app.TrashRetention, time.Now()) {
+			return Event{}, errRetentionExpired
+		}
+		return newEvent(eventExpenseRestored, deletionPayload{Id: expenseUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao restaurar despesa")
+		return
+	}
+	restored := group.Expenses[expenseUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(restored.Version))
+	json.NewEncoder(w).Encode(restored)
+}
+
+func (app *AppConfig) handleRestorePayment(w http.ResponseWriter, r *http.Request) {
+	uid, ok := r.Context().Value(userUIDKey).(string)
+	if !ok {
+		http.Error(w, "Não autorizado", http.StatusUnauthorized)
+		return
+	}
+	groupUID := chi.URLParam(r, "uid")
+	paymentUID := chi.URLParam(r, "paymentId")
+	ifMatch, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	group, _, err := app.execute(r.Context(), groupUID, uid, func(g *Group) (Event, error) {
+		paymentData, exists := g.Payments[paymentUID]
+		if !exists || paymentData.DeletedAt == "" {
+			return Event{}, errRecordNotFound
+		}
+		if !paymentData.managedBy(uid) {
+			return Event{}, errNotAuthorized
+		}
+		if !etagMatches(ifMatch, paymentData.Version) {
+			return Event{}, errPreconditionFailed
+		}
+		if isExpired(paymentData.DeletedAt, app.TrashRetention, time.Now()) {
+			return Event{}, errRetentionExpired
+		}
+		return newEvent(eventPaymentRestored, deletionPayload{Id: paymentUID})
+	})
+	if err != nil {
+		writeGroupError(w, err, "Erro ao restaurar pagamento")
+		return
+	}
+	restored := group.Payments[paymentUID]
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(restored.Version))
+	json.NewEncoder(w).Encode(restored)
+}
+
+// purgeExpiredTrash esconde da projeção os itens que passaram do prazo de
+// retenção. Não é um apagamento: o evento TrashPurged só remove os itens da
+// projeção, e os eventos anteriores a ele continuam no ledger com os dados
+// completos (GET /events, ?at= anterior à limpeza, "before" do histórico). Os
+// anexos também ficam no BlobStore, porque esses eventos ainda os referenciam.
+func (app *AppConfig) purgeExpiredTrash(ctx context.Context) (int, error) {
+	var groupIds map[string]bool
+	if err := app.DBClient.NewRef("groups").GetShallow(ctx, &groupIds); err != nil {
+		return 0, err
+	}
+	purged := 0
+	for groupId := range groupIds {
+		group, err := app.getGroup(ctx, groupId)
+		if err != nil {
+			continue
+		}
+		if !hasExpiredTrash(group, app.TrashRetention, time.Now()) {
+			continue
+		}
+		_, e, err := app.execute(ctx, groupId, systemActor, func(g *Group) (Event, error) {
+			var p purgePayload
+			now := time.Now()
+			for id, exp := range g.Expenses {
+				if exp.DeletedAt != "" && isExpired(exp.DeletedAt, app.TrashRetention, now) {
+					p.ExpenseIds = append(p.ExpenseIds, id)
+				}
+			}
+			for id, pay := range g.Payments {
+				if pay.DeletedAt != "" && isExpired(pay.DeletedAt, app.TrashRetention, now) {
+					p.PaymentIds = append(p.PaymentIds, id)
+				}
+			}
+			if len(p.ExpenseIds)+len(p.PaymentIds) == 0 {
+				return Event{}, errNoChanges
+			}
+			return newEvent(eventTrashPurged, p)
+		})
+		if errors.Is(err, errNoChanges) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Erro ao limpar lixeira do grupo %s: %v", groupId, err)
+			continue
+		}
+		var p purgePayload
+		e.decode(&p)
+		purged += len(p.ExpenseIds) + len(p.PaymentIds)
+	}
+	return purged, nil
+}
+
+func hasExpiredTrash(g *Group, retention time.Duration, now time.Time) bool {
+	for _, exp := range g.Expenses {
+		if exp.DeletedAt != "" && isExpired(exp.DeletedAt, retention, now) {
+			return true
+		}
+	}
+	for _, pay := range g.Payments {
+		if pay.DeletedAt != "" && isExpired(pay.DeletedAt, retention, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// startTrashPurger roda purgeExpiredTrash periodicamente em segundo plano
+func (app *AppConfig) startTrashPurger(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := app.purgeExpiredTrash(ctx)
+				if err != nil {
+					log.Printf("Erro ao limpar lixeira: %v", err)
+				} else if purged > 0 {
+					log.Printf("Lixeira: %d itens expirados removidos", purged)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+	tests := []struct {
+		deletedAt string
+		want      bool
+	}{
+		{"2026-03-01T11:59:59Z", true},
+		{"2026-03-01T12:00:00Z", false},
+		{"2026-03-30T00:00:00.123456789Z", false},
+		{"", false},
+		{"ontem", false},
+	}
+	for _, tt := range tests {
+		if got := isExpired(tt.deletedAt, retention, now); got != tt.want {
+			t.Errorf("isExpired(%q) = %v, quer %v", tt.deletedAt, got, tt.want)
+		}
+	}
+}
+
+// A limpeza da lixeira só tira os itens da projeção: o ledger continua com
+// eles, então o replay até antes da limpeza ainda os devolve
+func TestTrashLifecycle(t *testing.T) {
+	created := Group{Id: "g1", OwnerId: "ana", MemberIds: map[string]bool{"ana": true}}
+	events := []Event{
+		mustEvent(t, 1, eventGroupCreated, groupPayload{Group: created}),
+		mustEvent(t, 2, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e1", PayerId: "ana", Value: 10}}),
+		mustEvent(t, 3, eventExpenseAdded, expensePayload{Expense: Expense{Id: "e2", PayerId: "ana", Value: 20}}),
+		mustEvent(t, 4, eventExpenseDeleted, deletionPayload{Id: "e1", DeletedAt: "2026-01-01T00:00:00Z", DeletedBy: "ana"}),
+		mustEvent(t, 5, eventExpenseRestored, deletionPayload{Id: "e1"}),
+		mustEvent(t, 6, eventExpenseDeleted, deletionPayload{Id: "e2", DeletedAt: "2026-01-02T00:00:00Z", DeletedBy: "ana"}),
+		mustEvent(t, 7, eventTrashPurged, purgePayload{ExpenseIds: []string{"e2"}}),
+	}
+	tests := []struct {
+		until       int64
+		wantAll     []string
+		wantVisible []string
+	}{
+		{events[2].At, []string{"e1", "e2"}, []string{"e1", "e2"}},
+		{events[3].At, []string{"e1", "e2"}, []string{"e2"}},
+		{events[4].At, []string{"e1", "e2"}, []string{"e1", "e2"}},
+		{events[5].At, []string{"e1", "e2"}, []string{"e1"}},
+		{0, []string{"e1"}, []string{"e1"}},
+	}
+	for _, tt := range tests {
+		g, err := replay(events, tt.until)
+		if err != nil {
+			t.Fatalf("replay até %d: %v", tt.until, err)
+		}
+		if !sameKeys(g.Expenses, tt.wantAll) {
+			t.Errorf("até %d: despesas %v, quer %v", tt.until, g.Expenses, tt.wantAll)
+		}
+		if visible := g.withoutDeleted(); !sameKeys(visible.Expenses, tt.wantVisible) {
+			t.Errorf("até %d: despesas visíveis %v, quer %v", tt.until, visible.Expenses, tt.wantVisible)
+		}
+	}
+	g, _ := replay(events, 0)
+	if exp := g.Expenses["e1"]; exp.DeletedAt != "" || exp.DeletedBy != "" || exp.Version != 3 {
+		t.Errorf("despesa restaurada = %+v, quer sem exclusão e na versão 3", exp)
+	}
+}
+
+func sameKeys[V any](m map[string]V, keys []string) bool {
+	if len(m) != len(keys) {
+		return false
+	}
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxAmount      = 1_000_000
+	maxDescription = 140
+)
+
+// FieldError descreve um campo inválido do corpo do pedido
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reúne todos os campos inválidos de um pedido, para o cliente
+// poder mostrar cada erro junto do campo correspondente
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Field+": "+f.Message)
+	}
+	return "dados inválidos (" + strings.Join(messages, "; ") + ")"
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// err devolve nil se nenhum campo foi rejeitado
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// writeValidationError responde 400 com a lista de campos inválidos
+func writeValidationError(w http.ResponseWriter, e *ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{"Dados inválidos", e.Fields})
+}
+
+func (e *ValidationError) checkAmount(field string, value float64) {
+	switch {
+	case math.IsNaN(value) || value <= 0:
+		e.add(field, "Valor deve ser positivo")
+	case value > maxAmount:
+		e.add(field, "Valor acima do máximo permitido")
+	}
+}
+
+// knownCategory aceita qualquer nome enquanto o grupo não tiver categorias
+// gerenciadas; depois disso, só as gerenciadas
+func (g *Group) knownCategory(name string) bool {
+	if strings.TrimSpace(name) == "" || len(g.Categories) == 0 {
+		return true
+	}
+	_, ok := g.categoryByName(name)
+	return ok
+}
+
+// validateExpense confere os campos de uma despesa (avulsa ou recorrente),
+// já montada com o pedido, contra o estado atual do grupo
+func (g *Group) validateExpense(exp Expense, category string) error {
+	e := &ValidationError{}
+	if !g.MemberIds[exp.PayerId] {
+		e.add("payerId", "Pagador não é membro do grupo")
+	}
+	if len([]rune(strings.TrimSpace(exp.Description))) > maxDescription {
+		e.add("description", "Descrição muito longa")
+	}
+	e.checkAmount("value", exp.Value)
+	if !g.knownCategory(category) {
+		e.add("category", "Categoria desconhecida")
+	}
+	if !g.validSplit(exp.Split) {
+		e.add("split", "Divisão inválida: use pesos positivos para membros do grupo")
+	}
+	if len(exp.Payers) > 0 {
+		if exp.Payers[exp.PayerId] <= 0 {
+			e.add("payerId", "O pagador principal deve estar entre os pagadores")
+		}
+		total, valid := 0.0, true
+		for memberId, amount := range exp.Payers {
+			if amount <= 0 || !g.MemberIds[memberId] {
+				valid = false
+				break
+			}
+			total += amount
+		}
+		switch {
+		case !valid:
+			e.add("payers", "Contribuições devem ser positivas e só de membros")
+		case math.Abs(total-exp.Value) > 0.005:
+			e.add("payers", "Contribuições devem somar o valor da despesa")
+		}
+	}
+	return e.err()
+}
+
+// validatePayment confere pagador, destinatário e valor de um pagamento
+func (g *Group) validatePayment(payerId string, req PaymentRequest) error {
+	e := &ValidationError{}
+	if !g.MemberIds[payerId] {
+		e.add("payerId", "Pagador não é membro do grupo")
+	}
+	switch {
+	case req.TargetId == "":
+		e.add("targetId", "Destinatário obrigatório")
+	case req.TargetId == payerId:
+		e.add("targetId", "Pagador e destinatário devem ser diferentes")
+	case !g.MemberIds[req.TargetId]:
+		e.add("targetId", "Destinatário não é membro do grupo")
+	}
+	e.checkAmount("value", req.Value)
+	return e.err()
+}
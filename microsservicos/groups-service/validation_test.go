@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fieldsOf devolve os campos rejeitados, em ordem, ou nil se err for nil
+func fieldsOf(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("erro %v não é ValidationError", err)
+	}
+	var fields []string
+	for _, f := range invalid.Fields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func TestCheckAmount(t *testing.T) {
+	tests := []struct {
+		value float64
+		valid bool
+	}{
+		{0.01, true},
+		{maxAmount, true},
+		{0, false},
+		{-5, false},
+		{maxAmount + 0.01, false},
+		{math.NaN(), false},
+		{math.Inf(1), false},
+	}
+	for _, tt := range tests {
+		e := &ValidationError{}
+		e.checkAmount("value", tt.value)
+		if (e.err() == nil) != tt.valid {
+			t.Errorf("checkAmount(%v) = %v, quer válido = %v", tt.value, e.err(), tt.valid)
+		}
+	}
+}
+
+func TestValidateExpense(t *testing.T) {
+	g := &Group{MemberIds: map[string]bool{"ana": true, "bia": true}}
+	managed := &Group{
+		MemberIds:  g.MemberIds,
+		Categories: map[string]Category{"c1": {Id: "c1", Name: "Mercado"}},
+	}
+	valid := Expense{PayerId: "ana", Description: "Jantar", Value: 90}
+	with := func(change func(*Expense)) Expense {
+		exp := valid
+		change(&exp)
+		return exp
+	}
+	tests := []struct {
+		name     string
+		group    *Group
+		expense  Expense
+		category string
+		want     []string
+	}{
+		{"válida", g, valid, "Comida", nil},
+		{"categoria livre sem categorias gerenciadas", g, valid, "Qualquer", nil},
+		{"categoria gerenciada sem diferenciar maiúsculas", managed, valid, "mercado", nil},
+		{"sem categoria", managed, valid, "", nil},
+		{"categoria desconhecida", managed, valid, "Viagem", []string{"category"}},
+		{"pagador de fora", g, with(func(e *Expense) { e.PayerId = "caio" }), "", []string{"payerId"}},
+		{"descrição longa", g, with(func(e *Expense) { e.Description = strings.Repeat("é", maxDescription+1) }), "", []string{"description"}},
+		{"descrição no limite", g, with(func(e *Expense) { e.Description = strings.Repeat("é", maxDescription) }), "", nil},
+		{"valor zero", g, with(func(e *Expense) { e.Value = 0 }), "", []string{"value"}},
+		{"divisão com quem não é membro", g, with(func(e *Expense) { e.Split = map[string]float64{"caio": 1} }), "", []string{"split"}},
+		{"divisão com peso zero", g, with(func(e *Expense) { e.Split = map[string]float64{"ana": 0} }), "", []string{"split"}},
+		{"vários pagadores", g, with(func(e *Expense) { e.Payers = map[string]float64{"ana": 60, "bia": 30} }), "", nil},
+		{"pagadores sem o principal", g, with(func(e *Expense) { e.Payers = map[string]float64{"bia": 90} }), "", []string{"payerId"}},
+		{"pagadores que não somam o valor", g, with(func(e *Expense) { e.Payers = map[string]float64{"ana": 60, "bia": 20} }), "", []string{"payers"}},
+		{"pagador de fora entre os pagadores", g, with(func(e *Expense) { e.Payers = map[string]float64{"ana": 60, "caio": 30} }), "", []string{"payers"}},
+		{"todos os erros juntos", managed, Expense{PayerId: "caio", Value: -1}, "Viagem", []string{"payerId", "value", "category"}},
+	}
+	for _, tt := range tests {
+		if got := fieldsOf(t, tt.group.validateExpense(tt.expense, tt.category)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: campos = %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePayment(t *testing.T) {
+	g := &Group{MemberIds: map[string]bool{"ana": true, "bia": true}}
+	tests := []struct {
+		name    string
+		payerId string
+		req     PaymentRequest
+		want    []string
+	}{
+		{"válido", "ana", PaymentRequest{TargetId: "bia", Value: 10}, nil},
+		{"sem destinatário", "ana", PaymentRequest{Value: 10}, []string{"targetId"}},
+		{"para si mesmo", "ana", PaymentRequest{TargetId: "ana", Value: 10}, []string{"targetId"}},
+		{"destinatário de fora", "ana", PaymentRequest{TargetId: "caio", Value: 10}, []string{"targetId"}},
+		{"pagador de fora", "caio", PaymentRequest{TargetId: "bia", Value: 10}, []string{"payerId"}},
+		{"valor negativo", "ana", PaymentRequest{TargetId: "bia", Value: -10}, []string{"value"}},
+		{"valor acima do máximo", "ana", PaymentRequest{TargetId: "bia", Value: maxAmount * 2}, []string{"value"}},
+	}
+	for _, tt := range tests {
+		if got := fieldsOf(t, g.validatePayment(tt.payerId, tt.req)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: campos = %v, quer %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteGroupErrorValidation(t *testing.T) {
+	e := &ValidationError{}
+	e.add("value", "Valor deve ser positivo")
+	e.add("targetId", "Destinatário obrigatório")
+	rec := httptest.NewRecorder()
+	writeGroupError(rec, e.err(), "erro")
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, quer 400", rec.Code)
+	}
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "Dados inválidos" || len(body.Fields) != 2 || body.Fields[1].Field != "targetId" {
+		t.Errorf("corpo = %+v", body)
+	}
+}
@@ -0,0 +1,133 @@
+// Package bus é o barramento de eventos dos serviços: publicação e assinatura
+// por assunto, em memória (um processo só) ou em um servidor NATS.
+package bus
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Bus publica e entrega mensagens por assunto. Assuntos são separados por
+// pontos e as assinaturas aceitam os curingas do NATS: "*" (um token) e ">"
+// (um ou mais tokens no final).
+type Bus interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(subject string, data []byte)) (unsubscribe func(), err error)
+	Close() error
+}
+
+// SubjectMatches compara um assunto com um padrão de assinatura
+func SubjectMatches(pattern, subject string) bool {
+	p := strings.Split(pattern, ".")
+	s := strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (token != "*" && token != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+// --- Barramento em memória ---
+
+type memorySub struct {
+	pattern string
+	handler func(string, []byte)
+}
+
+type memoryBus struct {
+	mu     sync.RWMutex
+	nextId int
+	subs   map[int]memorySub
+}
+
+// NewMemory cria um barramento que só entrega dentro do próprio processo
+func NewMemory() Bus {
+	return &memoryBus{subs: map[int]memorySub{}}
+}
+
+// Publish entrega a mensagem de forma síncrona; handlers não devem bloquear
+func (b *memoryBus) Publish(subject string, data []byte) error {
+	b.mu.RLock()
+	var handlers []func(string, []byte)
+	for _, sub := range b.subs {
+		if SubjectMatches(sub.pattern, subject) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(subject, data)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(subject string, handler func(string, []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextId++
+	id := b.nextId
+	b.subs[id] = memorySub{pattern: subject, handler: handler}
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}, nil
+}
+
+func (b *memoryBus) Close() error {
+	return nil
+}
+
+// --- NATS ---
+
+type natsBus struct {
+	conn *nats.Conn
+}
+
+// Connect conecta ao servidor NATS em rawURL (nats://host:porta). A conexão é
+// feita em segundo plano e refeita sozinha, com as assinaturas; enquanto
+// desconectado, as publicações ficam no buffer do cliente.
+func Connect(rawURL, name string) (Bus, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("endereço do barramento inválido: %q", rawURL)
+	}
+	conn, err := nats.Connect(rawURL,
+		nats.Name(name),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{conn: conn}, nil
+}
+
+func (b *natsBus) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+func (b *natsBus) Subscribe(subject string, handler func(string, []byte)) (func(), error) {
+	sub, err := b.conn.Subscribe(subject, func(m *nats.Msg) {
+		handler(m.Subject, m.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// Close entrega o que estiver pendente e fecha a conexão
+func (b *natsBus) Close() error {
+	return b.conn.Drain()
+}
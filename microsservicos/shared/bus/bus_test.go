@@ -0,0 +1,117 @@
+package bus
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"groups.g1", "groups.g1", true},
+		{"groups.g1", "groups.g2", false},
+		{"groups.*", "groups.g1", true},
+		{"groups.*", "groups.g1.extra", false},
+		{"groups.>", "groups.g1", true},
+		{"groups.>", "groups.g1.extra", true},
+		{"groups.>", "groups", false},
+		{"*.g1", "groups.g1", true},
+		{"groups", "groups.g1", false},
+	}
+	for _, tt := range tests {
+		if got := SubjectMatches(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("SubjectMatches(%q, %q) = %v, quer %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
+
+// receive assina pattern e devolve o canal com os assuntos recebidos
+func receive(t *testing.T, b Bus, pattern string) (<-chan string, func()) {
+	t.Helper()
+	got := make(chan string, 10)
+	unsubscribe, err := b.Subscribe(pattern, func(subject string, data []byte) {
+		got <- subject + " " + string(data)
+	})
+	if err != nil {
+		t.Fatalf("Subscribe(%q) = %v", pattern, err)
+	}
+	return got, unsubscribe
+}
+
+func expect(t *testing.T, got <-chan string, want string) {
+	t.Helper()
+	select {
+	case msg := <-got:
+		if msg != want {
+			t.Errorf("mensagem = %q, quer %q", msg, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("mensagem %q não chegou", want)
+	}
+}
+
+func expectNothing(t *testing.T, got <-chan string) {
+	t.Helper()
+	select {
+	case msg := <-got:
+		t.Errorf("mensagem inesperada %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	b := NewMemory()
+	all, _ := receive(t, b, "groups.>")
+	one, unsubscribe := receive(t, b, "groups.g1")
+
+	b.Publish("groups.g1", []byte("a"))
+	expect(t, all, "groups.g1 a")
+	expect(t, one, "groups.g1 a")
+
+	unsubscribe()
+	b.Publish("groups.g1", []byte("b"))
+	expect(t, all, "groups.g1 b")
+	expectNothing(t, one)
+}
+
+// O cliente NATS conversa com o substituto local usado em desenvolvimento
+func TestNatsBusWithLocalServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go Serve(ln)
+
+	if _, err := Connect("http://"+ln.Addr().String(), "teste"); err == nil {
+		t.Errorf("Connect aceitou endereço que não é nats://")
+	}
+	publisher, err := Connect("nats://"+ln.Addr().String(), "publicador")
+	if err != nil {
+		t.Fatalf("Connect = %v", err)
+	}
+	defer publisher.Close()
+	subscriber, err := Connect("nats://"+ln.Addr().String(), "assinante")
+	if err != nil {
+		t.Fatalf("Connect = %v", err)
+	}
+	defer subscriber.Close()
+
+	got, unsubscribe := receive(t, subscriber, "groups.*")
+	// O PING/PONG garante que o servidor já processou a assinatura
+	if err := subscriber.(*natsBus).conn.Flush(); err != nil {
+		t.Fatalf("Flush = %v", err)
+	}
+	publisher.Publish("groups.g1", []byte(`{"seq":1}`))
+	expect(t, got, `groups.g1 {"seq":1}`)
+	publisher.Publish("outros.g1", []byte("x"))
+	expectNothing(t, got)
+
+	unsubscribe()
+	subscriber.(*natsBus).conn.Flush()
+	publisher.Publish("groups.g1", []byte("y"))
+	expectNothing(t, got)
+}
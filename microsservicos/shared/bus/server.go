@@ -0,0 +1,136 @@
+package bus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// busServer é um substituto local de um servidor NATS, para desenvolvimento:
+// implementa só o necessário do protocolo (CONNECT, PING/PONG, PUB, SUB e
+// UNSUB), sem persistência, autenticação nem grupos de fila.
+type busServer struct {
+	mu      sync.Mutex
+	clients map[*busClient]bool
+}
+
+type busClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	w    *bufio.Writer
+	subs map[string]string // sid -> assunto
+}
+
+// Serve atende conexões em ln até ele ser fechado
+func Serve(ln net.Listener) error {
+	s := &busServer{clients: map[*busClient]bool{}}
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Erro ao aceitar conexão: %v", err)
+			continue
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *busServer) serve(conn net.Conn) {
+	c := &busClient{conn: conn, w: bufio.NewWriter(conn), subs: map[string]string{}}
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	c.send("INFO {\"server_id\":\"local\",\"version\":\"0.0.0\",\"proto\":0,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONNECT", "PONG":
+		case "PING":
+			c.send("PONG\r\n")
+		case "SUB":
+			// SUB <assunto> [fila] <sid>
+			if len(fields) < 3 {
+				c.send("-ERR 'Unknown Protocol Operation'\r\n")
+				continue
+			}
+			c.mu.Lock()
+			c.subs[fields[len(fields)-1]] = fields[1]
+			c.mu.Unlock()
+		case "UNSUB":
+			if len(fields) >= 2 {
+				c.mu.Lock()
+				delete(c.subs, fields[1])
+				c.mu.Unlock()
+			}
+		case "PUB":
+			// PUB <assunto> [resposta] <tamanho>
+			if len(fields) < 3 {
+				c.send("-ERR 'Unknown Protocol Operation'\r\n")
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				c.send("-ERR 'Unknown Protocol Operation'\r\n")
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.deliver(fields[1], payload[:size])
+		default:
+			c.send("-ERR 'Unknown Protocol Operation'\r\n")
+		}
+	}
+}
+
+func (s *busServer) deliver(subject string, payload []byte) {
+	s.mu.Lock()
+	clients := make([]*busClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+	for _, c := range clients {
+		c.mu.Lock()
+		for sid, pattern := range c.subs {
+			if SubjectMatches(pattern, subject) {
+				fmt.Fprintf(c.w, "MSG %s %s %d\r\n", subject, sid, len(payload))
+				c.w.Write(payload)
+				c.w.WriteString("\r\n")
+			}
+		}
+		c.w.Flush()
+		c.mu.Unlock()
+	}
+}
+
+func (c *busClient) send(msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.WriteString(msg)
+	c.w.Flush()
+}
@@ -0,0 +1,250 @@
+// Package idempotency implementa o header Idempotency-Key para os serviços que
+// recebem POSTs: a primeira resposta para cada chave e usuário é guardada e
+// repetida nas novas tentativas.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTTL = 24 * time.Hour
+	// Tempo após o qual uma requisição em andamento é considerada abandonada
+	LockTimeout = time.Minute
+	// Limite do corpo guardado na memória para calcular o hash
+	DefaultMaxBodyBytes = 1 << 20
+	maxKeyLength        = 255
+)
+
+var (
+	errConflict   = errors.New("chave de idempotência reutilizada com outro corpo")
+	errInProgress = errors.New("requisição com esta chave ainda em andamento")
+	errReplay     = errors.New("resposta já registrada")
+)
+
+// Headers da resposta original que são repetidos junto com o corpo
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Record guarda a primeira resposta dada para uma chave
+type Record struct {
+	BodyHash  string            `json:"bodyHash"`
+	CreatedAt int64             `json:"createdAt"`
+	Completed bool              `json:"completed"`
+	Status    int               `json:"status,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+}
+
+// expired indica se o registro já pode ser descartado: respostas valem por
+// ttl e reservas sem resposta, por LockTimeout
+func (rec Record) expired(ttl time.Duration, now time.Time) bool {
+	age := now.Sub(time.UnixMilli(rec.CreatedAt))
+	return age > ttl || (!rec.Completed && age > LockTimeout)
+}
+
+// Store persiste os registros, agrupados por escopo (o usuário) e chave
+type Store interface {
+	// Update lê o registro atual (nil se não existir) e grava o que fn devolver,
+	// atomicamente. Um erro de fn cancela a gravação e é devolvido por Update.
+	Update(ctx context.Context, scope, key string, fn func(current *Record) (*Record, error)) error
+	Set(ctx context.Context, scope, key string, rec Record) error
+	Delete(ctx context.Context, scope, key string) error
+	// Sweep apaga os registros para os quais expired devolve true
+	Sweep(ctx context.Context, expired func(Record) bool) (int, error)
+}
+
+// Middleware honra o header Idempotency-Key nos POSTs
+type Middleware struct {
+	Store Store
+	TTL   time.Duration
+	// Corpos maiores são recusados com 413; zero usa DefaultMaxBodyBytes
+	MaxBodyBytes int64
+	// Scope devolve o usuário autenticado; vazio agrupa em "anonimo"
+	Scope func(r *http.Request) string
+}
+
+// TTLFromEnv lê IDEMPOTENCY_TTL (ex: "24h", "30m")
+func TTLFromEnv() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return DefaultTTL
+}
+
+// persisted indica se a resposta deve ser repetida nas novas tentativas. Erros
+// do servidor, conflitos (409), pré-condições (412) e limites de taxa (429)
+// dependem do momento e liberam a chave para o cliente tentar de novo.
+func persisted(status int) bool {
+	switch status {
+	case http.StatusConflict, http.StatusPreconditionFailed, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Handler envolve next. Uploads multipart passam direto, sem idempotência,
+// para não serem lidos inteiros na memória.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); strings.HasPrefix(mediaType, "multipart/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			http.Error(w, "Idempotency-Key muito longa", http.StatusBadRequest)
+			return
+		}
+
+		maxBytes := m.MaxBodyBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultMaxBodyBytes
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Corpo da requisição muito grande", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Erro ao ler requisição", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := ""
+		if m.Scope != nil {
+			scope = m.Scope(r)
+		}
+		if scope == "" {
+			scope = "anonimo"
+		}
+		keyHash := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + " " + key))
+		recordKey := hex.EncodeToString(keyHash[:])
+		bodySum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(bodySum[:])
+
+		now := time.Now()
+		var existing Record
+		err = m.Store.Update(r.Context(), scope, recordKey, func(current *Record) (*Record, error) {
+			if current != nil && !current.expired(m.TTL, now) {
+				existing = *current
+				switch {
+				case current.BodyHash != bodyHash:
+					return nil, errConflict
+				case !current.Completed:
+					return nil, errInProgress
+				default:
+					return nil, errReplay
+				}
+			}
+			return &Record{BodyHash: bodyHash, CreatedAt: now.UnixMilli()}, nil
+		})
+		switch {
+		case errors.Is(err, errReplay):
+			for name, value := range existing.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.Status)
+			io.WriteString(w, existing.Body)
+			return
+		case errors.Is(err, errConflict):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, errInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Erro ao verificar Idempotency-Key", http.StatusInternalServerError)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if !persisted(rec.status) {
+			m.Store.Delete(ctx, scope, recordKey)
+			return
+		}
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := rec.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		m.Store.Set(ctx, scope, recordKey, Record{
+			BodyHash:  bodyHash,
+			CreatedAt: now.UnixMilli(),
+			Completed: true,
+			Status:    rec.status,
+			Headers:   headers,
+			Body:      rec.body.String(),
+		})
+	})
+}
+
+// Sweep apaga os registros vencidos
+func (m *Middleware) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+	return m.Store.Sweep(ctx, func(rec Record) bool { return rec.expired(m.TTL, now) })
+}
+
+// StartSweeper roda Sweep periodicamente em segundo plano
+func (m *Middleware) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := m.Sweep(ctx)
+				if err != nil {
+					log.Printf("Erro ao limpar chaves de idempotência: %v", err)
+				} else if removed > 0 {
+					log.Printf("%d chaves de idempotência vencidas removidas", removed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,175 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]Record{}}
+}
+
+func (s *memoryStore) Update(_ context.Context, scope, key string, fn func(*Record) (*Record, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var current *Record
+	if rec, ok := s.records[scope+"/"+key]; ok {
+		current = &rec
+	}
+	next, err := fn(current)
+	if err != nil {
+		return err
+	}
+	s.records[scope+"/"+key] = *next
+	return nil
+}
+
+func (s *memoryStore) Set(_ context.Context, scope, key string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[scope+"/"+key] = rec
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, scope+"/"+key)
+	return nil
+}
+
+func (s *memoryStore) Sweep(_ context.Context, expired func(Record) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, rec := range s.records {
+		if expired(rec) {
+			delete(s.records, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// countingHandler responde com status e conta quantas vezes foi chamado
+func countingHandler(status int, calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"7"`)
+		w.Header().Set("Location", "/api/items/1")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"n":1}`))
+	})
+}
+
+func post(h http.Handler, key, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/items", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerReplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		secondBody  string
+		wantStatus  int
+		wantCalls   int
+		wantReplay  bool
+		contentType string
+	}{
+		{"repete a resposta criada", http.StatusCreated, `{"a":1}`, http.StatusCreated, 1, true, "application/json"},
+		{"repete erros do cliente", http.StatusBadRequest, `{"a":1}`, http.StatusBadRequest, 1, true, "application/json"},
+		{"corpo diferente é recusado", http.StatusCreated, `{"a":2}`, http.StatusUnprocessableEntity, 1, false, "application/json"},
+		{"409 libera a chave", http.StatusConflict, `{"a":1}`, http.StatusConflict, 2, false, "application/json"},
+		{"412 libera a chave", http.StatusPreconditionFailed, `{"a":1}`, http.StatusPreconditionFailed, 2, false, "application/json"},
+		{"429 libera a chave", http.StatusTooManyRequests, `{"a":1}`, http.StatusTooManyRequests, 2, false, "application/json"},
+		{"5xx libera a chave", http.StatusBadGateway, `{"a":1}`, http.StatusBadGateway, 2, false, "application/json"},
+		{"multipart passa direto", http.StatusCreated, `{"a":1}`, http.StatusCreated, 2, false, "multipart/form-data; boundary=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			m := &Middleware{Store: newMemoryStore(), TTL: time.Hour}
+			h := m.Handler(countingHandler(tt.status, &calls))
+			post(h, "k1", tt.contentType, `{"a":1}`)
+			rec := post(h, "k1", tt.contentType, tt.secondBody)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, quer %d", rec.Code, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("handler chamado %d vezes, quer %d", calls, tt.wantCalls)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplay {
+				t.Fatalf("replay = %v, quer %v", replayed, tt.wantReplay)
+			}
+			if tt.wantReplay {
+				for _, name := range replayedHeaders {
+					if rec.Header().Get(name) == "" {
+						t.Errorf("header %s não foi repetido", name)
+					}
+				}
+				if rec.Body.String() != `{"n":1}` {
+					t.Errorf("corpo = %q", rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerBodyLimit(t *testing.T) {
+	calls := 0
+	m := &Middleware{Store: newMemoryStore(), TTL: time.Hour, MaxBodyBytes: 8}
+	h := m.Handler(countingHandler(http.StatusCreated, &calls))
+	if rec := post(h, "k", "application/json", `{"grande":true}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, quer 413", rec.Code)
+	}
+	// Sem chave o middleware não lê o corpo
+	if rec := post(h, "", "application/json", `{"grande":true}`); rec.Code != http.StatusCreated {
+		t.Fatalf("status sem chave = %d, quer 201", rec.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("handler chamado %d vezes, quer 1", calls)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore()
+	store.records = map[string]Record{
+		"u/recente":       {Completed: true, CreatedAt: now.Add(-time.Minute).UnixMilli()},
+		"u/vencida":       {Completed: true, CreatedAt: now.Add(-2 * time.Hour).UnixMilli()},
+		"u/abandonada":    {CreatedAt: now.Add(-2 * LockTimeout).UnixMilli()},
+		"u/em-andamento":  {CreatedAt: now.Add(-LockTimeout / 2).UnixMilli()},
+		"anonimo/vencida": {Completed: true, CreatedAt: now.Add(-3 * time.Hour).UnixMilli()},
+	}
+	m := &Middleware{Store: store, TTL: time.Hour}
+	removed, err := m.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Fatalf("removidas %d, quer 3", removed)
+	}
+	for _, key := range []string{"u/recente", "u/em-andamento"} {
+		if _, ok := store.records[key]; !ok {
+			t.Errorf("%s não deveria ter sido removida", key)
+		}
+	}
+}
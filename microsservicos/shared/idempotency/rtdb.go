@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"context"
+
+	"firebase.google.com/go/v4/db"
+)
+
+// RTDBStore guarda os registros no Realtime Database, em {Root}/{scope}/{key}
+type RTDBStore struct {
+	Client *db.Client
+	Root   string
+}
+
+func (s *RTDBStore) ref(scope, key string) *db.Ref {
+	return s.Client.NewRef(s.Root + "/" + scope + "/" + key)
+}
+
+func (s *RTDBStore) Update(ctx context.Context, scope, key string, fn func(current *Record) (*Record, error)) error {
+	return s.ref(scope, key).Transaction(ctx, func(tn db.TransactionNode) (any, error) {
+		var current *Record
+		if err := tn.Unmarshal(&current); err != nil {
+			return nil, err
+		}
+		next, err := fn(current)
+		if err != nil {
+			return nil, err
+		}
+		return next, nil
+	})
+}
+
+func (s *RTDBStore) Set(ctx context.Context, scope, key string, rec Record) error {
+	return s.ref(scope, key).Set(ctx, rec)
+}
+
+func (s *RTDBStore) Delete(ctx context.Context, scope, key string) error {
+	return s.ref(scope, key).Delete(ctx)
+}
+
+// Sweep percorre os escopos um a um; os registros vencidos de cada escopo são
+// apagados em uma única escrita
+func (s *RTDBStore) Sweep(ctx context.Context, expired func(Record) bool) (int, error) {
+	var scopes map[string]bool
+	if err := s.Client.NewRef(s.Root).GetShallow(ctx, &scopes); err != nil {
+		return 0, err
+	}
+	removed := 0
+	for scope := range scopes {
+		var records map[string]Record
+		if err := s.Client.NewRef(s.Root+"/"+scope).Get(ctx, &records); err != nil {
+			return removed, err
+		}
+		updates := map[string]any{}
+		for key, rec := range records {
+			if expired(rec) {
+				updates[key] = nil
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := s.Client.NewRef(s.Root+"/"+scope).Update(ctx, updates); err != nil {
+			return removed, err
+		}
+		removed += len(updates)
+	}
+	return removed, nil
+}
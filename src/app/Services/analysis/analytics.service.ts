@@ -6,22 +6,39 @@ export interface Debt {
   amount: number;
 }
 
+export interface MemberSummary {
+  userId: string;
+  totalPaid: number;
+  totalConsumed: number;
+  paymentsSent: number;
+  paymentsReceived: number;
+  pendingSent: number;
+  pendingReceived: number;
+  netBalance: number;
+}
+
 export interface GroupAnalysis {
   groupId: string;
   groupName: string;
   myBalance: number;
+  myPendingBalance: number;
   totalSpent: number;
   myTotalSpent: number;
   owedBy: Debt[];
   oweTo: Debt[];
   categorySummary: { [key: string]: number };
+  categoryRollup: { [key: string]: number };
+  members: MemberSummary[];
+  debtMatrix: { [debtorId: string]: { [creditorId: string]: number } };
 }
 
 export interface GeneralAnalysis {
   totalBalance: number;
+  totalPendingBalance: number;
   totalOwedByMe: number;
   totalOwedToMe: number;
   categorySummary: { [key: string]: number };
+  categoryRollup: { [key: string]: number };
 }
 
 @Injectable({
@@ -134,10 +134,12 @@ export class GroupsService {
 
   @runInContext()
   async deleteExpense(groupId: string, expenseId: string): Promise<void> {
+    const expense = this.getGroupById(groupId)?.expenses?.find(e => e.id === expenseId)
     const resp = await fetch(`https://smart-finance-groups-production.up.railway.app/api/groups/${groupId}/expenses/${expenseId}`, {
       method: "DELETE",
       headers: {
-        "Authorization": "Bearer " + this.authService.token
+        "Authorization": "Bearer " + this.authService.token,
+        "If-Match": `"${expense?.version ?? 0}"`
       }
     })
 
@@ -192,10 +194,12 @@ export class GroupsService {
 
   @runInContext()
   async deletePayment(groupId: string, paymentId: string): Promise<void> {
+    const payment = Object.values(this.getGroupById(groupId)?.payments ?? {}).find(p => p.id === paymentId)
     const resp = await fetch(`https://smart-finance-groups-production.up.railway.app/api/groups/${groupId}/payments/${paymentId}`, {
       method: "DELETE",
       headers: {
-        "Authorization": "Bearer " + this.authService.token
+        "Authorization": "Bearer " + this.authService.token,
+        "If-Match": `"${payment?.version ?? 0}"`
       }
     })
 
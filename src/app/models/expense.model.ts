@@ -6,4 +6,35 @@ export interface Expense {
     value: number;
     description: string;
     category: string;
+    version?: number;
+    recordedBy?: string;
+    contestedAt?: string;
+    contestReason?: string;
+    payers?: { [userId: string]: number };
+    receipt?: Receipt;
+    attachments?: { [id: string]: Attachment };
+}
+
+export interface ReceiptItem {
+    name: string;
+    quantity: number;
+    price: number;
+    participants: string[];
+}
+
+export interface Receipt {
+    items: ReceiptItem[];
+    tax?: number;
+    tip?: number;
+    service?: number;
+}
+
+export interface Attachment {
+    id: string;
+    name: string;
+    contentType: string;
+    size: number;
+    thumbnail?: boolean;
+    uploadedBy: string;
+    uploadedAt: string;
 }
\ No newline at end of file
@@ -8,4 +8,6 @@ export interface Group {
   ownerId: string;
   expenses?: Expense[];
   payments?: Payment[];
+  version?: number;
+  roles?: { [userId: string]: 'treasurer' };
 }
\ No newline at end of file
@@ -5,4 +5,10 @@ export interface Payment {
     payerId: string;
     groupId: string;
     targetId: string;
+    version?: number;
+    status?: 'pending' | 'confirmed' | 'disputed' | 'cancelled';
+    statusAt?: string;
+    statusBy?: string;
+    disputeReason?: string;
+    recordedBy?: string;
 }
\ No newline at end of file